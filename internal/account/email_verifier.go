@@ -0,0 +1,306 @@
+package account
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/v2code/b16/internal/database"
+	"github.com/v2code/b16/internal/domain"
+	"github.com/v2code/b16/internal/mailer"
+)
+
+var (
+	ErrInvalidCode     = errors.New("invalid verification code")
+	ErrCodeExpired     = errors.New("verification code expired")
+	ErrTooManyAttempts = errors.New("too many verification attempts")
+	ErrResendCooldown  = errors.New("verification code sent recently")
+	ErrAlreadyVerified = errors.New("email already verified")
+)
+
+// CooldownError is returned while a new code cannot be sent yet. It matches
+// ErrResendCooldown with errors.Is.
+type CooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrResendCooldown, e.RetryAfter)
+}
+
+func (e *CooldownError) Is(target error) bool {
+	return target == ErrResendCooldown
+}
+
+type EmailVerifierParams struct {
+	DB    database.Database
+	Users domain.UserRepository
+	// Catalogue renders the email, which is stored in Outbox and sent by
+	// an OutboxRelay.
+	Catalogue *mailer.Catalogue
+	Outbox    *mailer.Outbox
+	// Secret keys the HMAC stored in place of each code, so a copy of the
+	// table is not enough to brute-force the short codes offline.
+	Secret []byte
+	// CodeLength defaults to 6 digits.
+	CodeLength int
+	// ExpireAt defaults to 10 minutes.
+	ExpireAt time.Duration
+	// MaxAttempts defaults to 5 wrong guesses. The count belongs to the
+	// user, not to the code, so sending a new code does not reset it.
+	MaxAttempts int
+	// LockoutDuration is how long Verify refuses every code once
+	// MaxAttempts is reached. Defaults to 15 minutes.
+	LockoutDuration time.Duration
+	// ResendCooldown defaults to 1 minute.
+	ResendCooldown time.Duration
+}
+
+// EmailVerifier sends one-time numeric codes to confirm that a user owns
+// their email address. Each user has at most one pending code in
+// email_verifications; sending a new one replaces it.
+type EmailVerifier struct {
+	db              database.Database
+	users           domain.UserRepository
+	catalogue       *mailer.Catalogue
+	outbox          *mailer.Outbox
+	secret          []byte
+	codeLength      int
+	expireAt        time.Duration
+	maxAttempts     int
+	lockoutDuration time.Duration
+	resendCooldown  time.Duration
+	now             func() time.Time
+}
+
+func NewEmailVerifier(params EmailVerifierParams) *EmailVerifier {
+	v := &EmailVerifier{
+		db:              params.DB,
+		users:           params.Users,
+		catalogue:       params.Catalogue,
+		outbox:          params.Outbox,
+		secret:          params.Secret,
+		codeLength:      params.CodeLength,
+		expireAt:        params.ExpireAt,
+		maxAttempts:     params.MaxAttempts,
+		lockoutDuration: params.LockoutDuration,
+		resendCooldown:  params.ResendCooldown,
+		now:             time.Now,
+	}
+
+	if v.codeLength <= 0 {
+		v.codeLength = 6
+	}
+	if v.expireAt <= 0 {
+		v.expireAt = 10 * time.Minute
+	}
+	if v.maxAttempts <= 0 {
+		v.maxAttempts = 5
+	}
+	if v.lockoutDuration <= 0 {
+		v.lockoutDuration = 15 * time.Minute
+	}
+	if v.resendCooldown <= 0 {
+		v.resendCooldown = time.Minute
+	}
+
+	return v
+}
+
+// Send emails a new code to user, replacing the pending one but keeping its
+// attempt count. It fails with a *CooldownError when the previous code was
+// sent less than ResendCooldown ago. The email is enqueued in the outbox in
+// the same transaction as the code, so a code is only delivered if it was
+// stored and no row stays locked during the SMTP exchange.
+func (v *EmailVerifier) Send(ctx context.Context, user *domain.User, locale string) error {
+	if user.EmailVerified {
+		return ErrAlreadyVerified
+	}
+
+	code, err := newNumericCode(v.codeLength)
+	if err != nil {
+		return err
+	}
+
+	now := v.now().UTC()
+
+	return v.db.WithTransaction(ctx, func(ctx context.Context) error {
+		executor := v.db.Executor(ctx)
+
+		result, err := executor.ExecContext(ctx,
+			`INSERT INTO email_verifications (user_id, code_hash, attempts, expires_at, sent_at) VALUES ($1, $2, 0, $3, $4)
+			ON CONFLICT (user_id) DO UPDATE SET code_hash = EXCLUDED.code_hash, expires_at = EXCLUDED.expires_at, sent_at = EXCLUDED.sent_at
+			WHERE email_verifications.sent_at <= $5`,
+			user.ID, v.hash(user.ID, code), now.Add(v.expireAt), now, now.Add(-v.resendCooldown),
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			var sentAt time.Time
+			err := executor.QueryRowContext(ctx,
+				`SELECT sent_at FROM email_verifications WHERE user_id = $1`,
+				user.ID,
+			).Scan(&sentAt)
+			if err != nil {
+				return err
+			}
+			return &CooldownError{RetryAfter: sentAt.Add(v.resendCooldown).Sub(now)}
+		}
+
+		message, err := v.catalogue.Message(mailer.VerificationCodeEmail{
+			Code:      code,
+			ExpiresIn: v.expireAt,
+		}, locale, user.Email)
+		if err != nil {
+			return err
+		}
+
+		_, err = v.outbox.EnqueueMessage(ctx, message)
+		return err
+	})
+}
+
+// Resend sends a new code to the user with the given email. Unknown and
+// already verified addresses, and requests during the resend cooldown, are
+// silently ignored so callers cannot probe which accounts exist.
+func (v *EmailVerifier) Resend(ctx context.Context, email string, locale string) error {
+	user, err := v.users.GetByEmail(ctx, email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = v.Send(ctx, user, locale)
+	if errors.Is(err, ErrAlreadyVerified) || errors.Is(err, ErrResendCooldown) {
+		return nil
+	}
+	return err
+}
+
+// Verify checks code against the pending code of the user with the given
+// email and marks the user as verified on success. Every guess counts
+// towards MaxAttempts, even concurrent ones, because the attempt is
+// recorded before the comparison. Reaching MaxAttempts locks the user out
+// for LockoutDuration, after which the count starts over.
+func (v *EmailVerifier) Verify(ctx context.Context, email string, code string) error {
+	var result error
+
+	err := v.db.WithTransaction(ctx, func(ctx context.Context) error {
+		user, err := v.users.GetByEmail(ctx, email)
+		if errors.Is(err, domain.ErrUserNotFound) {
+			result = ErrInvalidCode
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		executor := v.db.Executor(ctx)
+		now := v.now().UTC()
+
+		_, err = executor.ExecContext(ctx,
+			`UPDATE email_verifications SET attempts = 0, locked_until = NULL WHERE user_id = $1 AND locked_until <= $2`,
+			user.ID, now,
+		)
+		if err != nil {
+			return err
+		}
+
+		counted, err := executor.ExecContext(ctx,
+			`UPDATE email_verifications SET attempts = attempts + 1 WHERE user_id = $1 AND attempts < $2`,
+			user.ID, v.maxAttempts,
+		)
+		if err != nil {
+			return err
+		}
+
+		var (
+			codeHash  string
+			expiresAt time.Time
+			attempts  int
+		)
+		err = executor.QueryRowContext(ctx,
+			`SELECT code_hash, expires_at, attempts FROM email_verifications WHERE user_id = $1`,
+			user.ID,
+		).Scan(&codeHash, &expiresAt, &attempts)
+		if errors.Is(err, sql.ErrNoRows) {
+			result = ErrInvalidCode
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		affected, err := counted.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case affected == 0:
+			result = ErrTooManyAttempts
+		case !now.Before(expiresAt):
+			result = ErrCodeExpired
+		case !hmac.Equal([]byte(codeHash), []byte(v.hash(user.ID, code))):
+			result = ErrInvalidCode
+		}
+
+		if result != nil {
+			if affected == 0 || attempts < v.maxAttempts {
+				return nil
+			}
+
+			_, err := executor.ExecContext(ctx,
+				`UPDATE email_verifications SET locked_until = $2 WHERE user_id = $1`,
+				user.ID, now.Add(v.lockoutDuration),
+			)
+			return err
+		}
+
+		if _, err := executor.ExecContext(ctx, `DELETE FROM email_verifications WHERE user_id = $1`, user.ID); err != nil {
+			return err
+		}
+
+		user.EmailVerified = true
+		return v.users.Update(ctx, user)
+	})
+	if err != nil {
+		return err
+	}
+
+	return result
+}
+
+func (v *EmailVerifier) hash(userID string, code string) string {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(userID + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newNumericCode returns length uniformly random decimal digits.
+func newNumericCode(length int) (string, error) {
+	digits := make([]byte, length)
+	for i := range digits {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		digits[i] = byte('0' + n.Int64())
+	}
+	return string(digits), nil
+}
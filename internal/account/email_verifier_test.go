@@ -0,0 +1,155 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/v2code/b16/internal/database"
+	"github.com/v2code/b16/internal/domain"
+	"github.com/v2code/b16/internal/mailer"
+	"github.com/v2code/b16/internal/repository"
+)
+
+type testEmailVerifier struct {
+	db       database.Database
+	verifier *EmailVerifier
+	users    domain.UserRepository
+	client   *mailer.RecordingClient
+	now      *time.Time
+}
+
+func newTestEmailVerifier(t *testing.T) *testEmailVerifier {
+	db := newTestDatabase(t)
+	users := repository.NewSQLUserRepository(db)
+	catalogue, client := newTestCatalogue(t)
+
+	verifier := NewEmailVerifier(EmailVerifierParams{
+		DB:             db,
+		Users:          users,
+		Catalogue:      catalogue,
+		Outbox:         mailer.NewOutbox(db),
+		Secret:         []byte("secret"),
+		MaxAttempts:    3,
+		ResendCooldown: time.Minute,
+	})
+
+	now := time.Now().UTC()
+	verifier.now = func() time.Time { return now }
+
+	return &testEmailVerifier{db: db, verifier: verifier, users: users, client: client, now: &now}
+}
+
+var sentCodePattern = regexp.MustCompile(`\b\d{6}\b`)
+
+func (v *testEmailVerifier) sentCode(t *testing.T) string {
+	t.Helper()
+
+	deliverOutbox(t, v.db, v.client)
+
+	sent, ok := v.client.Last()
+	require.True(t, ok)
+
+	code := sentCodePattern.FindString(sent.Body("text/plain"))
+	require.NotEmpty(t, code)
+	return code
+}
+
+func TestEmailVerifier_Verify(t *testing.T) {
+	ctx := context.Background()
+	v := newTestEmailVerifier(t)
+	user := createTestUser(t, v.users, "user@email.com")
+
+	require.NoError(t, v.verifier.Send(ctx, user, "en"))
+	code := v.sentCode(t)
+
+	sent, _ := v.client.Last()
+	assert.Equal(t, "Verification Code", sent.Subject())
+	assert.Equal(t, []string{"user@email.com"}, sent.To)
+	assert.Contains(t, sent.Body("text/plain"), "This code expires in 10 minutes.")
+
+	require.ErrorIs(t, v.verifier.Verify(ctx, "user@email.com", "000000x"), ErrInvalidCode)
+	require.ErrorIs(t, v.verifier.Verify(ctx, "unknown@email.com", code), ErrInvalidCode)
+	require.NoError(t, v.verifier.Verify(ctx, "user@email.com", code))
+
+	found, err := v.users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.True(t, found.EmailVerified)
+
+	require.ErrorIs(t, v.verifier.Verify(ctx, "user@email.com", code), ErrInvalidCode)
+	require.ErrorIs(t, v.verifier.Send(ctx, found, "en"), ErrAlreadyVerified)
+}
+
+func TestEmailVerifier_Limits(t *testing.T) {
+	ctx := context.Background()
+	v := newTestEmailVerifier(t)
+	user := createTestUser(t, v.users, "user@email.com")
+
+	require.NoError(t, v.verifier.Send(ctx, user, ""))
+	code := v.sentCode(t)
+
+	for range 3 {
+		require.ErrorIs(t, v.verifier.Verify(ctx, "user@email.com", "wrong"), ErrInvalidCode)
+	}
+	require.ErrorIs(t, v.verifier.Verify(ctx, "user@email.com", code), ErrTooManyAttempts)
+
+	err := v.verifier.Send(ctx, user, "")
+	require.ErrorIs(t, err, ErrResendCooldown)
+
+	var cooldownErr *CooldownError
+	require.ErrorAs(t, err, &cooldownErr)
+	require.Equal(t, time.Minute, cooldownErr.RetryAfter)
+
+	require.NoError(t, v.verifier.Resend(ctx, "user@email.com", ""), "Resend hides the cooldown")
+	deliverOutbox(t, v.db, v.client)
+	require.Len(t, v.client.Mails(), 1)
+
+	*v.now = v.now.Add(time.Minute)
+	require.NoError(t, v.verifier.Resend(ctx, "user@email.com", ""))
+	code = v.sentCode(t)
+	require.Len(t, v.client.Mails(), 2)
+	require.ErrorIs(t, v.verifier.Verify(ctx, "user@email.com", code), ErrTooManyAttempts, "a new code does not reset the count")
+
+	*v.now = v.now.Add(15 * time.Minute)
+	require.NoError(t, v.verifier.Resend(ctx, "user@email.com", ""))
+	code = v.sentCode(t)
+	require.ErrorIs(t, v.verifier.Verify(ctx, "user@email.com", "wrong"), ErrInvalidCode, "the count starts over after the lockout")
+
+	*v.now = v.now.Add(10 * time.Minute)
+	require.ErrorIs(t, v.verifier.Verify(ctx, "user@email.com", code), ErrCodeExpired)
+
+	found, err := v.users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.False(t, found.EmailVerified)
+}
+
+func TestEmailVerifier_Resend(t *testing.T) {
+	ctx := context.Background()
+	v := newTestEmailVerifier(t)
+	user := createTestUser(t, v.users, "user@email.com")
+
+	require.NoError(t, v.verifier.Resend(ctx, "unknown@email.com", ""))
+	deliverOutbox(t, v.db, v.client)
+	require.Empty(t, v.client.Mails())
+
+	// The SMTP exchange happens in the relay, so its failures never reach
+	// the caller.
+	v.client.FailWith(errors.New("smtp unavailable"))
+	require.NoError(t, v.verifier.Resend(ctx, "user@email.com", ""))
+	deliverOutbox(t, v.db, v.client)
+	require.Empty(t, v.client.Mails())
+
+	v.client.FailWith(nil)
+	*v.now = v.now.Add(time.Minute)
+	require.NoError(t, v.verifier.Resend(ctx, "user@email.com", ""))
+	code := v.sentCode(t)
+	require.NoError(t, v.verifier.Verify(ctx, "user@email.com", code))
+
+	require.NoError(t, v.verifier.Resend(ctx, user.Email, ""))
+	deliverOutbox(t, v.db, v.client)
+	require.Len(t, v.client.Mails(), 1)
+}
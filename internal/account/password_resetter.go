@@ -0,0 +1,225 @@
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/v2code/b16/internal/database"
+	"github.com/v2code/b16/internal/domain"
+	"github.com/v2code/b16/internal/mailer"
+	"github.com/v2code/b16/internal/security"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid password reset token")
+	ErrResetTokenExpired = errors.New("password reset token expired")
+	ErrWeakPassword      = errors.New("password too short")
+)
+
+const resetTokenSize = 32
+
+// SessionRevoker ends every session of a subject issued before the given
+// instant. *manager.TokenAuthManager implements it.
+type SessionRevoker interface {
+	RevokeSubject(ctx context.Context, subject string, before time.Time) error
+}
+
+type PasswordResetterParams struct {
+	DB             database.Database
+	Users          domain.UserRepository
+	PasswordHasher security.PasswordHasher
+	// Catalogue renders the email, which is stored in Outbox and sent by
+	// an OutboxRelay.
+	Catalogue *mailer.Catalogue
+	Outbox    *mailer.Outbox
+	Sessions  SessionRevoker
+	// ResetURL is the page that receives the token in its "token" query
+	// parameter, e.g. https://b16.example.com/reset-password.
+	ResetURL string
+	// ExpireAt defaults to 30 minutes.
+	ExpireAt time.Duration
+	// MinPasswordLength defaults to 8.
+	MinPasswordLength int
+}
+
+// PasswordResetter lets a user who forgot their password choose a new one
+// through an emailed link. Tokens are random, stored as their SHA-256 hash
+// in password_resets, single-use and short-lived; requesting a new one
+// discards the pending ones.
+type PasswordResetter struct {
+	db                database.Database
+	users             domain.UserRepository
+	passwordHasher    security.PasswordHasher
+	catalogue         *mailer.Catalogue
+	outbox            *mailer.Outbox
+	sessions          SessionRevoker
+	resetURL          string
+	expireAt          time.Duration
+	minPasswordLength int
+	now               func() time.Time
+}
+
+func NewPasswordResetter(params PasswordResetterParams) *PasswordResetter {
+	p := &PasswordResetter{
+		db:                params.DB,
+		users:             params.Users,
+		passwordHasher:    params.PasswordHasher,
+		catalogue:         params.Catalogue,
+		outbox:            params.Outbox,
+		sessions:          params.Sessions,
+		resetURL:          params.ResetURL,
+		expireAt:          params.ExpireAt,
+		minPasswordLength: params.MinPasswordLength,
+		now:               time.Now,
+	}
+
+	if p.expireAt <= 0 {
+		p.expireAt = 30 * time.Minute
+	}
+	if p.minPasswordLength <= 0 {
+		p.minPasswordLength = 8
+	}
+
+	return p
+}
+
+// Request emails a reset link to the user with the given email. Unknown
+// addresses are silently ignored so callers cannot probe which accounts
+// exist. The email is only enqueued in the outbox, in the same transaction
+// as the token, so the response time does not depend on an SMTP round-trip
+// either.
+func (p *PasswordResetter) Request(ctx context.Context, email string, locale string) error {
+	buffer := make([]byte, resetTokenSize)
+	if _, err := rand.Read(buffer); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buffer)
+
+	link, err := url.Parse(p.resetURL)
+	if err != nil {
+		return err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	now := p.now().UTC()
+
+	return p.db.WithTransaction(ctx, func(ctx context.Context) error {
+		user, err := p.users.GetByEmail(ctx, email)
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		executor := p.db.Executor(ctx)
+
+		if _, err := executor.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = $1 AND used_at IS NULL`, user.ID); err != nil {
+			return err
+		}
+
+		_, err = executor.ExecContext(ctx,
+			`INSERT INTO password_resets (token_hash, user_id, expires_at, created_at) VALUES ($1, $2, $3, $4)`,
+			hashResetToken(token), user.ID, now.Add(p.expireAt), now,
+		)
+		if err != nil {
+			return err
+		}
+
+		message, err := p.catalogue.Message(mailer.PasswordResetEmail{
+			ResetURL:  link.String(),
+			ExpiresIn: p.expireAt,
+		}, locale, user.Email)
+		if err != nil {
+			return err
+		}
+
+		_, err = p.outbox.EnqueueMessage(ctx, message)
+		return err
+	})
+}
+
+// Reset consumes token and replaces the password of its user, then revokes
+// every token issued to the user before the reset. All of it happens in one
+// transaction, so a failure leaves the token usable.
+func (p *PasswordResetter) Reset(ctx context.Context, token string, password string) error {
+	if len(password) < p.minPasswordLength {
+		return fmt.Errorf("%w: minimum is %d characters", ErrWeakPassword, p.minPasswordLength)
+	}
+
+	hashedPassword, err := p.passwordHasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	now := p.now().UTC()
+
+	return p.db.WithTransaction(ctx, func(ctx context.Context) error {
+		executor := p.db.Executor(ctx)
+
+		var (
+			userID    string
+			expiresAt time.Time
+		)
+		err := executor.QueryRowContext(ctx,
+			`SELECT user_id, expires_at FROM password_resets WHERE token_hash = $1 AND used_at IS NULL`,
+			hashResetToken(token),
+		).Scan(&userID, &expiresAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if !now.Before(expiresAt) {
+			return ErrResetTokenExpired
+		}
+
+		result, err := executor.ExecContext(ctx,
+			`UPDATE password_resets SET used_at = $2 WHERE token_hash = $1 AND used_at IS NULL`,
+			hashResetToken(token), now,
+		)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		user, err := p.users.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		user.Password = hashedPassword
+		if err := p.users.Update(ctx, user); err != nil {
+			return err
+		}
+
+		if _, err := executor.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+			return err
+		}
+
+		return p.sessions.RevokeSubject(ctx, userID, now)
+	})
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,156 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/v2code/b16/internal/database"
+	"github.com/v2code/b16/internal/domain"
+	"github.com/v2code/b16/internal/mailer"
+	"github.com/v2code/b16/internal/repository"
+	"github.com/v2code/b16/internal/security"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeSessionRevoker struct {
+	subjects []string
+	err      error
+}
+
+func (r *fakeSessionRevoker) RevokeSubject(ctx context.Context, subject string, before time.Time) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.subjects = append(r.subjects, subject)
+	return nil
+}
+
+type testPasswordResetter struct {
+	db       database.Database
+	resetter *PasswordResetter
+	users    domain.UserRepository
+	hasher   security.PasswordHasher
+	sessions *fakeSessionRevoker
+	client   *mailer.RecordingClient
+	now      *time.Time
+}
+
+func newTestPasswordResetter(t *testing.T) *testPasswordResetter {
+	db := newTestDatabase(t)
+	users := repository.NewSQLUserRepository(db)
+	catalogue, client := newTestCatalogue(t)
+	hasher := security.NewBCryptPasswordHasher(bcrypt.MinCost)
+	sessions := &fakeSessionRevoker{}
+
+	resetter := NewPasswordResetter(PasswordResetterParams{
+		DB:             db,
+		Users:          users,
+		PasswordHasher: hasher,
+		Catalogue:      catalogue,
+		Outbox:         mailer.NewOutbox(db),
+		Sessions:       sessions,
+		ResetURL:       "https://b16.example.com/reset-password?source=email",
+	})
+
+	now := time.Now().UTC()
+	resetter.now = func() time.Time { return now }
+
+	return &testPasswordResetter{
+		db:       db,
+		resetter: resetter,
+		users:    users,
+		hasher:   hasher,
+		sessions: sessions,
+		client:   client,
+		now:      &now,
+	}
+}
+
+var resetLinkPattern = regexp.MustCompile(`https://b16\.example\.com/\S+`)
+
+func (p *testPasswordResetter) sentToken(t *testing.T) string {
+	t.Helper()
+
+	deliverOutbox(t, p.db, p.client)
+
+	sent, ok := p.client.Last()
+	require.True(t, ok)
+
+	link, err := url.Parse(resetLinkPattern.FindString(sent.Body("text/plain")))
+	require.NoError(t, err)
+	require.Equal(t, "email", link.Query().Get("source"))
+
+	token := link.Query().Get("token")
+	require.NotEmpty(t, token)
+	return token
+}
+
+func TestPasswordResetter_Reset(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPasswordResetter(t)
+	user := createTestUser(t, p.users, "user@email.com")
+
+	require.NoError(t, p.resetter.Request(ctx, "user@email.com", "en"))
+	token := p.sentToken(t)
+
+	sent, _ := p.client.Last()
+	assert.Equal(t, "Password reset", sent.Subject())
+	assert.Contains(t, sent.Body("text/plain"), "This link expires in 30 minutes")
+
+	require.ErrorIs(t, p.resetter.Reset(ctx, token, "short"), ErrWeakPassword)
+	require.ErrorIs(t, p.resetter.Reset(ctx, "unknown", "new-password"), ErrInvalidResetToken)
+	require.NoError(t, p.resetter.Reset(ctx, token, "new-password"))
+
+	found, err := p.users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.NoError(t, p.hasher.Compare("new-password", found.Password))
+	require.Equal(t, []string{user.ID}, p.sessions.subjects)
+
+	require.ErrorIs(t, p.resetter.Reset(ctx, token, "other-password"), ErrInvalidResetToken)
+}
+
+func TestPasswordResetter_Request(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPasswordResetter(t)
+	createTestUser(t, p.users, "user@email.com")
+
+	require.NoError(t, p.resetter.Request(ctx, "unknown@email.com", ""))
+	deliverOutbox(t, p.db, p.client)
+	require.Empty(t, p.client.Mails())
+
+	require.NoError(t, p.resetter.Request(ctx, "user@email.com", ""))
+	first := p.sentToken(t)
+	require.NoError(t, p.resetter.Request(ctx, "user@email.com", ""))
+	second := p.sentToken(t)
+
+	require.ErrorIs(t, p.resetter.Reset(ctx, first, "new-password"), ErrInvalidResetToken)
+
+	*p.now = p.now.Add(30 * time.Minute)
+	require.ErrorIs(t, p.resetter.Reset(ctx, second, "new-password"), ErrResetTokenExpired)
+}
+
+func TestPasswordResetter_RevokeFailure(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPasswordResetter(t)
+	user := createTestUser(t, p.users, "user@email.com")
+
+	require.NoError(t, p.resetter.Request(ctx, "user@email.com", ""))
+	token := p.sentToken(t)
+
+	errRevoke := errors.New("revocation store unavailable")
+	p.sessions.err = errRevoke
+	require.ErrorIs(t, p.resetter.Reset(ctx, token, "new-password"), errRevoke)
+
+	found, err := p.users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, "hash", found.Password)
+
+	p.sessions.err = nil
+	require.NoError(t, p.resetter.Reset(ctx, token, "new-password"))
+}
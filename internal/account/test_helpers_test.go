@@ -0,0 +1,73 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/v2code/b16/internal/database"
+	"github.com/v2code/b16/internal/domain"
+	"github.com/v2code/b16/internal/mailer"
+	_ "modernc.org/sqlite"
+)
+
+func newTestDatabase(t *testing.T) database.Database {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite", "file::memory:?_time_format=sqlite")
+	require.NoError(t, err)
+
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db := database.NewDatabase(sqlDB)
+
+	migrator, err := database.NewMigrator(db, database.SQLiteDialect, database.Migrations)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Up(context.Background()))
+
+	return db
+}
+
+func newTestCatalogue(t *testing.T) (*mailer.Catalogue, *mailer.RecordingClient) {
+	t.Helper()
+
+	templates, err := mailer.DefaultTemplates()
+	require.NoError(t, err)
+
+	client := mailer.NewRecordingClient()
+	m := mailer.NewDefaultMailer(mailer.MailerParams{
+		Host: "localhost",
+		Port: 25,
+		From: "b16@email.com",
+	}, client)
+
+	return mailer.NewCatalogue(templates, m), client
+}
+
+// deliverOutbox sends the pending messages of the outbox through client.
+func deliverOutbox(t *testing.T, db database.Database, client *mailer.RecordingClient) {
+	t.Helper()
+
+	relay := mailer.NewOutboxRelay(mailer.OutboxRelayParams{
+		DB:      db,
+		Dialect: database.SQLiteDialect,
+		Mailer: mailer.NewDefaultMailer(mailer.MailerParams{
+			Host: "localhost",
+			Port: 25,
+			From: "b16@email.com",
+		}, client),
+	})
+
+	_, err := relay.ProcessBatch(context.Background())
+	require.NoError(t, err)
+}
+
+func createTestUser(t *testing.T, users domain.UserRepository, email string) *domain.User {
+	t.Helper()
+
+	user := &domain.User{Email: email, Password: "hash"}
+	require.NoError(t, users.Create(context.Background(), user))
+	return user
+}
@@ -0,0 +1,474 @@
+package account
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/v2code/b16/internal/database"
+	"github.com/v2code/b16/internal/security"
+)
+
+var (
+	ErrMFANotEnabled      = errors.New("two-factor authentication not enabled")
+	ErrMFAAlreadyEnabled  = errors.New("two-factor authentication already enabled")
+	ErrInvalidMFACode     = errors.New("invalid two-factor code")
+	ErrTooManyMFAAttempts = errors.New("too many two-factor attempts")
+)
+
+type TwoFactorParams struct {
+	DB   database.Database
+	TOTP *security.TOTP
+	// Key encrypts the TOTP secrets at rest with AES-GCM, so a copy of
+	// user_mfa is not enough to generate codes. It must be 16, 24 or 32
+	// bytes long.
+	Key []byte
+	// RecoveryCodes is how many recovery codes are issued on confirmation.
+	// Defaults to 10.
+	RecoveryCodes int
+	// MaxAttempts defaults to 5 wrong codes in a row, after which Verify
+	// refuses every code for LockoutDuration.
+	MaxAttempts int
+	// LockoutDuration defaults to 15 minutes.
+	LockoutDuration time.Duration
+}
+
+// Enrollment is what the user needs to add the account to an authenticator
+// app: the secret, for manual entry, and the otpauth:// URI for a QR code.
+type Enrollment struct {
+	Secret string
+	URI    string
+}
+
+// TwoFactor manages TOTP second factors. Enrollment is two-step: Enroll
+// stores a pending secret and Confirm activates it once the user proves the
+// app produces valid codes, returning the recovery codes. Only their SHA-256
+// hashes are stored, and each can replace a TOTP code once.
+type TwoFactor struct {
+	db              database.Database
+	totp            *security.TOTP
+	aead            cipher.AEAD
+	recoveryCodes   int
+	maxAttempts     int
+	lockoutDuration time.Duration
+	now             func() time.Time
+}
+
+func NewTwoFactor(params TwoFactorParams) (*TwoFactor, error) {
+	block, err := aes.NewCipher(params.Key)
+	if err != nil {
+		return nil, fmt.Errorf("two-factor key: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &TwoFactor{
+		db:              params.DB,
+		totp:            params.TOTP,
+		aead:            aead,
+		recoveryCodes:   params.RecoveryCodes,
+		maxAttempts:     params.MaxAttempts,
+		lockoutDuration: params.LockoutDuration,
+		now:             time.Now,
+	}
+
+	if f.recoveryCodes <= 0 {
+		f.recoveryCodes = 10
+	}
+	if f.maxAttempts <= 0 {
+		f.maxAttempts = 5
+	}
+	if f.lockoutDuration <= 0 {
+		f.lockoutDuration = 15 * time.Minute
+	}
+
+	return f, nil
+}
+
+// Enroll generates a new secret for the user, replacing any enrollment that
+// was not confirmed. accountName labels the entry in the authenticator app,
+// usually the user's email.
+func (f *TwoFactor) Enroll(ctx context.Context, userID string, accountName string) (*Enrollment, error) {
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedSecret, err := f.seal(userID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := f.db.Executor(ctx).ExecContext(ctx,
+		`INSERT INTO user_mfa (user_id, secret, encrypted_secret, last_used_step, created_at) VALUES ($1, '', $2, 0, $3)
+		ON CONFLICT (user_id) DO UPDATE SET secret = '', encrypted_secret = EXCLUDED.encrypted_secret, last_used_step = 0, created_at = EXCLUDED.created_at
+		WHERE user_mfa.confirmed_at IS NULL`,
+		userID, encryptedSecret, f.now().UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	return &Enrollment{
+		Secret: secret,
+		URI:    f.totp.URI(secret, accountName),
+	}, nil
+}
+
+// Confirm activates a pending enrollment with a code from the authenticator
+// app and returns the recovery codes, which are never shown again.
+func (f *TwoFactor) Confirm(ctx context.Context, userID string, code string) ([]string, error) {
+	codes, err := security.GenerateRecoveryCodes(f.recoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := f.now().UTC()
+
+	err = f.db.WithTransaction(ctx, func(ctx context.Context) error {
+		executor := f.db.Executor(ctx)
+
+		var (
+			plaintextSecret string
+			encryptedSecret sql.NullString
+			lastStep        int64
+			confirmedAt     sql.NullTime
+		)
+		err := executor.QueryRowContext(ctx,
+			`SELECT secret, encrypted_secret, last_used_step, confirmed_at FROM user_mfa WHERE user_id = $1`,
+			userID,
+		).Scan(&plaintextSecret, &encryptedSecret, &lastStep, &confirmedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMFANotEnabled
+		}
+		if err != nil {
+			return err
+		}
+
+		if confirmedAt.Valid {
+			return ErrMFAAlreadyEnabled
+		}
+
+		secret, err := f.secret(ctx, userID, plaintextSecret, encryptedSecret)
+		if err != nil {
+			return err
+		}
+
+		step, err := f.totp.Verify(secret, code, lastStep)
+		if err != nil {
+			return ErrInvalidMFACode
+		}
+
+		_, err = executor.ExecContext(ctx,
+			`UPDATE user_mfa SET confirmed_at = $2, last_used_step = $3 WHERE user_id = $1`,
+			userID, now, step,
+		)
+		if err != nil {
+			return err
+		}
+
+		if _, err := executor.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		for _, code := range codes {
+			_, err := executor.ExecContext(ctx,
+				`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+				userID, security.HashRecoveryCode(code),
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Enabled reports whether the user has a confirmed second factor.
+func (f *TwoFactor) Enabled(ctx context.Context, userID string) (bool, error) {
+	var enabled bool
+	err := f.db.Executor(ctx).QueryRowContext(ctx,
+		`SELECT confirmed_at IS NOT NULL FROM user_mfa WHERE user_id = $1`,
+		userID,
+	).Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return enabled, nil
+}
+
+// Verify accepts either a TOTP code or an unused recovery code. A TOTP code
+// is accepted only if its time step is newer than the last one used, so an
+// intercepted code cannot be replayed; recovery codes are marked used.
+//
+// After MaxAttempts wrong codes in a row every code is refused with
+// ErrTooManyMFAAttempts for LockoutDuration. The failure count is kept per
+// user, so logging in again for a new mfa_pending token does not reset it,
+// and each attempt is recorded before the comparison so concurrent guesses
+// count too.
+func (f *TwoFactor) Verify(ctx context.Context, userID string, code string) error {
+	var result error
+
+	now := f.now().UTC()
+
+	err := f.db.WithTransaction(ctx, func(ctx context.Context) error {
+		executor := f.db.Executor(ctx)
+
+		_, err := executor.ExecContext(ctx,
+			`UPDATE user_mfa SET failed_attempts = 0, locked_until = NULL WHERE user_id = $1 AND locked_until <= $2`,
+			userID, now,
+		)
+		if err != nil {
+			return err
+		}
+
+		counted, err := executor.ExecContext(ctx,
+			`UPDATE user_mfa SET failed_attempts = failed_attempts + 1 WHERE user_id = $1 AND confirmed_at IS NOT NULL AND locked_until IS NULL`,
+			userID,
+		)
+		if err != nil {
+			return err
+		}
+
+		var (
+			plaintextSecret string
+			encryptedSecret sql.NullString
+			lastStep        int64
+		)
+		err = executor.QueryRowContext(ctx,
+			`SELECT secret, encrypted_secret, last_used_step FROM user_mfa WHERE user_id = $1 AND confirmed_at IS NOT NULL`,
+			userID,
+		).Scan(&plaintextSecret, &encryptedSecret, &lastStep)
+		if errors.Is(err, sql.ErrNoRows) {
+			result = ErrMFANotEnabled
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		affected, err := counted.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			result = ErrTooManyMFAAttempts
+			return nil
+		}
+
+		secret, err := f.secret(ctx, userID, plaintextSecret, encryptedSecret)
+		if err != nil {
+			return err
+		}
+
+		accepted, err := f.accept(ctx, userID, secret, code, lastStep, now)
+		if err != nil {
+			return err
+		}
+
+		if accepted {
+			_, err := executor.ExecContext(ctx, `UPDATE user_mfa SET failed_attempts = 0 WHERE user_id = $1`, userID)
+			return err
+		}
+
+		locked, err := executor.ExecContext(ctx,
+			`UPDATE user_mfa SET locked_until = $2 WHERE user_id = $1 AND failed_attempts >= $3`,
+			userID, now.Add(f.lockoutDuration), f.maxAttempts,
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err = locked.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		result = ErrInvalidMFACode
+		if affected > 0 {
+			result = ErrTooManyMFAAttempts
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return result
+}
+
+// accept consumes code as a TOTP code newer than lastStep or, failing that,
+// as an unused recovery code.
+func (f *TwoFactor) accept(ctx context.Context, userID string, secret string, code string, lastStep int64, now time.Time) (bool, error) {
+	executor := f.db.Executor(ctx)
+
+	if step, err := f.totp.Verify(secret, code, lastStep); err == nil {
+		// The condition on last_used_step makes concurrent submissions of
+		// the same code race for a single row update.
+		result, err := executor.ExecContext(ctx,
+			`UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`,
+			userID, step,
+		)
+		if err != nil {
+			return false, err
+		}
+		return isAffected(result)
+	}
+
+	result, err := executor.ExecContext(ctx,
+		`UPDATE mfa_recovery_codes SET used_at = $3 WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, security.HashRecoveryCode(code), now,
+	)
+	if err != nil {
+		return false, err
+	}
+	return isAffected(result)
+}
+
+// Disable removes the second factor and the recovery codes of the user.
+func (f *TwoFactor) Disable(ctx context.Context, userID string) error {
+	return f.db.WithTransaction(ctx, func(ctx context.Context) error {
+		executor := f.db.Executor(ctx)
+
+		if _, err := executor.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		_, err := executor.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID)
+		return err
+	})
+}
+
+// EncryptSecrets encrypts the plaintext secrets left by enrollments made
+// before secrets were encrypted at rest and returns how many it converted.
+// Such secrets are also encrypted the first time they are used, so calling
+// it once after upgrading is enough to leave no plaintext copy behind.
+func (f *TwoFactor) EncryptSecrets(ctx context.Context) (int, error) {
+	var converted int
+
+	err := f.db.WithTransaction(ctx, func(ctx context.Context) error {
+		converted = 0
+
+		rows, err := f.db.Executor(ctx).QueryContext(ctx,
+			`SELECT user_id, secret FROM user_mfa WHERE encrypted_secret IS NULL`,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		secrets := map[string]string{}
+		for rows.Next() {
+			var userID, secret string
+			if err := rows.Scan(&userID, &secret); err != nil {
+				return err
+			}
+			secrets[userID] = secret
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		for userID, secret := range secrets {
+			if _, err := f.secret(ctx, userID, secret, sql.NullString{}); err != nil {
+				return err
+			}
+			converted++
+		}
+
+		return nil
+	})
+
+	return converted, err
+}
+
+// secret decrypts encryptedSecret or, for rows enrolled before secrets were
+// encrypted, encrypts plaintextSecret in place and returns it.
+func (f *TwoFactor) secret(ctx context.Context, userID string, plaintextSecret string, encryptedSecret sql.NullString) (string, error) {
+	if encryptedSecret.Valid {
+		return f.open(userID, encryptedSecret.String)
+	}
+
+	sealed, err := f.seal(userID, plaintextSecret)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.db.Executor(ctx).ExecContext(ctx,
+		`UPDATE user_mfa SET secret = '', encrypted_secret = $2 WHERE user_id = $1`,
+		userID, sealed,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return plaintextSecret, nil
+}
+
+// seal encrypts secret with the user ID as additional data, so a ciphertext
+// copied to another user's row does not decrypt.
+func (f *TwoFactor) seal(userID string, secret string) (string, error) {
+	nonce := make([]byte, f.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := f.aead.Seal(nonce, nonce, []byte(secret), []byte(userID))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (f *TwoFactor) open(userID string, encryptedSecret string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encryptedSecret)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < f.aead.NonceSize() {
+		return "", errors.New("two-factor secret: ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:f.aead.NonceSize()], sealed[f.aead.NonceSize():]
+
+	secret, err := f.aead.Open(nil, nonce, ciphertext, []byte(userID))
+	if err != nil {
+		return "", fmt.Errorf("two-factor secret: %w", err)
+	}
+
+	return string(secret), nil
+}
+
+func isAffected(result sql.Result) (bool, error) {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
@@ -0,0 +1,209 @@
+package account
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/v2code/b16/internal/repository"
+	"github.com/v2code/b16/internal/security"
+)
+
+func newTestTwoFactor(t *testing.T) (*TwoFactor, *security.TOTP, string) {
+	t.Helper()
+
+	db := newTestDatabase(t)
+	user := createTestUser(t, repository.NewSQLUserRepository(db), "user@email.com")
+
+	totp := security.NewTOTP(security.TOTPParams{Issuer: "b16", Skew: 1})
+	twoFactor, err := NewTwoFactor(TwoFactorParams{
+		DB:            db,
+		TOTP:          totp,
+		Key:           []byte("0123456789abcdef0123456789abcdef"),
+		RecoveryCodes: 3,
+		MaxAttempts:   3,
+	})
+	require.NoError(t, err)
+
+	return twoFactor, totp, user.ID
+}
+
+func enrollTestTwoFactor(t *testing.T, twoFactor *TwoFactor, totp *security.TOTP, userID string) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+
+	enrollment, err := twoFactor.Enroll(ctx, userID, "user@email.com")
+	require.NoError(t, err)
+	require.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+
+	recoveryCodes, err := twoFactor.Confirm(ctx, userID, code)
+	require.NoError(t, err)
+	require.Len(t, recoveryCodes, 3)
+
+	return enrollment.Secret, recoveryCodes
+}
+
+func TestTwoFactor_Enrollment(t *testing.T) {
+	ctx := context.Background()
+	twoFactor, totp, userID := newTestTwoFactor(t)
+
+	enabled, err := twoFactor.Enabled(ctx, userID)
+	require.NoError(t, err)
+	require.False(t, enabled)
+
+	_, err = twoFactor.Confirm(ctx, userID, "123456")
+	require.ErrorIs(t, err, ErrMFANotEnabled)
+
+	enrollment, err := twoFactor.Enroll(ctx, userID, "user@email.com")
+	require.NoError(t, err)
+
+	_, err = twoFactor.Confirm(ctx, userID, "000000")
+	require.ErrorIs(t, err, ErrInvalidMFACode)
+
+	enabled, err = twoFactor.Enabled(ctx, userID)
+	require.NoError(t, err)
+	require.False(t, enabled, "an unconfirmed enrollment does not enable the second factor")
+
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+
+	_, err = twoFactor.Confirm(ctx, userID, code)
+	require.NoError(t, err)
+
+	enabled, err = twoFactor.Enabled(ctx, userID)
+	require.NoError(t, err)
+	require.True(t, enabled)
+
+	_, err = twoFactor.Enroll(ctx, userID, "user@email.com")
+	require.ErrorIs(t, err, ErrMFAAlreadyEnabled)
+}
+
+func TestTwoFactor_Verify(t *testing.T) {
+	ctx := context.Background()
+	twoFactor, totp, userID := newTestTwoFactor(t)
+	secret, recoveryCodes := enrollTestTwoFactor(t, twoFactor, totp, userID)
+
+	err := twoFactor.Verify(ctx, userID, "000000")
+	require.ErrorIs(t, err, ErrInvalidMFACode)
+
+	next, err := totp.Code(secret, time.Now().Add(30*time.Second))
+	require.NoError(t, err)
+
+	require.NoError(t, twoFactor.Verify(ctx, userID, next))
+	require.ErrorIs(t, twoFactor.Verify(ctx, userID, next), ErrInvalidMFACode, "a code cannot be replayed")
+
+	require.NoError(t, twoFactor.Verify(ctx, userID, recoveryCodes[0]))
+	require.ErrorIs(t, twoFactor.Verify(ctx, userID, recoveryCodes[0]), ErrInvalidMFACode, "recovery codes are single-use")
+	require.NoError(t, twoFactor.Verify(ctx, userID, recoveryCodes[1]))
+
+	require.NoError(t, twoFactor.Disable(ctx, userID))
+	require.ErrorIs(t, twoFactor.Verify(ctx, userID, recoveryCodes[2]), ErrMFANotEnabled)
+
+	enabled, err := twoFactor.Enabled(ctx, userID)
+	require.NoError(t, err)
+	require.False(t, enabled)
+}
+
+func TestTwoFactor_NewRequiresKey(t *testing.T) {
+	_, err := NewTwoFactor(TwoFactorParams{Key: []byte("short")})
+	require.Error(t, err)
+}
+
+func TestTwoFactor_SecretEncryptedAtRest(t *testing.T) {
+	ctx := context.Background()
+	twoFactor, totp, userID := newTestTwoFactor(t)
+	secret, _ := enrollTestTwoFactor(t, twoFactor, totp, userID)
+
+	var stored string
+	err := twoFactor.db.Executor(ctx).QueryRowContext(ctx,
+		`SELECT encrypted_secret FROM user_mfa WHERE user_id = $1`,
+		userID,
+	).Scan(&stored)
+	require.NoError(t, err)
+	require.NotContains(t, stored, secret)
+
+	_, err = twoFactor.open("another-user", stored)
+	require.Error(t, err, "the ciphertext is bound to its user")
+}
+
+func TestTwoFactor_PlaintextSecretsFromBeforeEncryption(t *testing.T) {
+	ctx := context.Background()
+	twoFactor, totp, userID := newTestTwoFactor(t)
+	other := createTestUser(t, repository.NewSQLUserRepository(twoFactor.db), "other@email.com")
+
+	secret, err := security.GenerateTOTPSecret()
+	require.NoError(t, err)
+
+	for _, id := range []string{userID, other.ID} {
+		_, err := twoFactor.db.Executor(ctx).ExecContext(ctx,
+			`INSERT INTO user_mfa (user_id, secret, last_used_step, created_at, confirmed_at) VALUES ($1, $2, 0, $3, $3)`,
+			id, secret, time.Now().UTC(),
+		)
+		require.NoError(t, err)
+	}
+
+	stored := func(id string) (string, bool) {
+		var (
+			plaintext string
+			encrypted *string
+		)
+		err := twoFactor.db.Executor(ctx).QueryRowContext(ctx,
+			`SELECT secret, encrypted_secret FROM user_mfa WHERE user_id = $1`, id,
+		).Scan(&plaintext, &encrypted)
+		require.NoError(t, err)
+		return plaintext, encrypted != nil
+	}
+
+	code, err := totp.Code(secret, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, twoFactor.Verify(ctx, userID, code), "legacy secrets keep working")
+
+	plaintext, encrypted := stored(userID)
+	require.Empty(t, plaintext, "the secret is encrypted on first use")
+	require.True(t, encrypted)
+
+	converted, err := twoFactor.EncryptSecrets(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, converted)
+
+	plaintext, encrypted = stored(other.ID)
+	require.Empty(t, plaintext)
+	require.True(t, encrypted)
+
+	next, err := totp.Code(secret, time.Now().Add(30*time.Second))
+	require.NoError(t, err)
+	require.NoError(t, twoFactor.Verify(ctx, other.ID, next))
+}
+
+func TestTwoFactor_Lockout(t *testing.T) {
+	ctx := context.Background()
+	twoFactor, totp, userID := newTestTwoFactor(t)
+	secret, recoveryCodes := enrollTestTwoFactor(t, twoFactor, totp, userID)
+
+	now := time.Now()
+	twoFactor.now = func() time.Time { return now }
+
+	require.ErrorIs(t, twoFactor.Verify(ctx, userID, "000000"), ErrInvalidMFACode)
+	require.ErrorIs(t, twoFactor.Verify(ctx, userID, "000001"), ErrInvalidMFACode)
+	require.ErrorIs(t, twoFactor.Verify(ctx, userID, "000002"), ErrTooManyMFAAttempts)
+
+	next, err := totp.Code(secret, time.Now().Add(30*time.Second))
+	require.NoError(t, err)
+
+	require.ErrorIs(t, twoFactor.Verify(ctx, userID, next), ErrTooManyMFAAttempts, "valid codes are refused while locked")
+	require.ErrorIs(t, twoFactor.Verify(ctx, userID, recoveryCodes[0]), ErrTooManyMFAAttempts)
+
+	now = now.Add(15 * time.Minute)
+
+	require.NoError(t, twoFactor.Verify(ctx, userID, recoveryCodes[0]))
+
+	// A success resets the count, so only consecutive failures lock.
+	require.ErrorIs(t, twoFactor.Verify(ctx, userID, "000000"), ErrInvalidMFACode)
+	require.ErrorIs(t, twoFactor.Verify(ctx, userID, "000001"), ErrInvalidMFACode)
+	require.NoError(t, twoFactor.Verify(ctx, userID, recoveryCodes[1]))
+	require.ErrorIs(t, twoFactor.Verify(ctx, userID, "000002"), ErrInvalidMFACode)
+}
@@ -8,3 +8,6 @@ var ErrUnauthorized = errors.New("unauthorized")
 var ErrTokenMissing = errors.New("token missing")
 var ErrNoPrincipalFound = errors.New("no principal found")
 var ErrForbidden = errors.New("forbidden")
+var ErrRefreshNotConfigured = errors.New("refresh tokens not configured")
+var ErrRevocationNotConfigured = errors.New("token revocation not configured")
+var ErrMFANotConfigured = errors.New("two-factor authentication not configured")
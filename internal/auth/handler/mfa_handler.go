@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/v2code/b16/internal/account"
+	"github.com/v2code/b16/internal/auth"
+	"github.com/v2code/b16/internal/auth/manager"
+	"github.com/v2code/b16/internal/auth/middleware"
+	"github.com/v2code/b16/internal/logger"
+)
+
+type MFAHandler struct {
+	twoFactor    *account.TwoFactor
+	tokenManager *manager.TokenAuthManager
+}
+
+type MFAHandlerParams struct {
+	TwoFactor    *account.TwoFactor
+	TokenManager *manager.TokenAuthManager
+}
+
+func NewMFAHandler(params MFAHandlerParams) *MFAHandler {
+	return &MFAHandler{
+		twoFactor:    params.TwoFactor,
+		tokenManager: params.TokenManager,
+	}
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type MFAEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Register mounts POST /auth/mfa/enroll, /auth/mfa/confirm and
+// /auth/mfa/disable on mux. All of them require an access token.
+func (h *MFAHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /auth/mfa/enroll", middleware.WithAuth(h.tokenManager, h.Enroll))
+	mux.HandleFunc("POST /auth/mfa/confirm", middleware.WithAuth(h.tokenManager, h.Confirm))
+	mux.HandleFunc("POST /auth/mfa/disable", middleware.WithAuth(h.tokenManager, h.Disable))
+}
+
+// Enroll returns a new secret and its otpauth:// URI. The second factor is
+// only required on login after Confirm.
+func (h *MFAHandler) Enroll(w http.ResponseWriter, r *http.Request, principal auth.Principal[*manager.TokenPrincipal]) {
+	claims := principal.Principal().Claims
+
+	enrollment, err := h.twoFactor.Enroll(r.Context(), claims.Subject, claims.Email)
+	switch {
+	case errors.Is(err, account.ErrMFAAlreadyEnabled):
+		WriteError(w, http.StatusConflict, "mfa_already_enabled")
+		return
+	case err != nil:
+		logger.Error(LOG_AUTH_PREFIX, "Error enrolling two-factor authentication", err.Error())
+		WriteError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, MFAEnrollmentResponse{Secret: enrollment.Secret, URI: enrollment.URI})
+}
+
+func (h *MFAHandler) Confirm(w http.ResponseWriter, r *http.Request, principal auth.Principal[*manager.TokenPrincipal]) {
+	var req MFACodeRequest
+	if err := DecodeJSON(r, &req); err != nil || req.Code == "" {
+		WriteError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	codes, err := h.twoFactor.Confirm(r.Context(), principal.Principal().Subject, req.Code)
+	switch {
+	case errors.Is(err, account.ErrInvalidMFACode):
+		WriteError(w, http.StatusBadRequest, "invalid_mfa_code")
+		return
+	case errors.Is(err, account.ErrMFANotEnabled):
+		WriteError(w, http.StatusBadRequest, "mfa_not_enrolled")
+		return
+	case errors.Is(err, account.ErrMFAAlreadyEnabled):
+		WriteError(w, http.StatusConflict, "mfa_already_enabled")
+		return
+	case err != nil:
+		logger.Error(LOG_AUTH_PREFIX, "Error confirming two-factor authentication", err.Error())
+		WriteError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Disable requires a current TOTP or recovery code, so a stolen access token
+// alone cannot turn the second factor off.
+func (h *MFAHandler) Disable(w http.ResponseWriter, r *http.Request, principal auth.Principal[*manager.TokenPrincipal]) {
+	var req MFACodeRequest
+	if err := DecodeJSON(r, &req); err != nil || req.Code == "" {
+		WriteError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	subject := principal.Principal().Subject
+
+	err := h.twoFactor.Verify(r.Context(), subject, req.Code)
+	switch {
+	case errors.Is(err, account.ErrTooManyMFAAttempts):
+		WriteError(w, http.StatusTooManyRequests, "too_many_attempts")
+		return
+	case errors.Is(err, account.ErrInvalidMFACode):
+		WriteError(w, http.StatusBadRequest, "invalid_mfa_code")
+		return
+	case errors.Is(err, account.ErrMFANotEnabled):
+		WriteError(w, http.StatusBadRequest, "mfa_not_enabled")
+		return
+	case err != nil:
+		logger.Error(LOG_AUTH_PREFIX, "Error verifying two-factor code", err.Error())
+		WriteError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	if err := h.twoFactor.Disable(r.Context(), subject); err != nil {
+		logger.Error(LOG_AUTH_PREFIX, "Error disabling two-factor authentication", err.Error())
+		WriteError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
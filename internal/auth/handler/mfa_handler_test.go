@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/v2code/b16/internal/account"
+	"github.com/v2code/b16/internal/auth/manager"
+	"github.com/v2code/b16/internal/domain"
+	"github.com/v2code/b16/internal/repository"
+	"github.com/v2code/b16/internal/security"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMFAHandler(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+	hasher := security.NewBCryptPasswordHasher(bcrypt.MinCost)
+
+	users := repository.NewSQLUserRepository(db)
+	password, err := hasher.Hash("secret")
+	require.NoError(t, err)
+	require.NoError(t, users.Create(ctx, &domain.User{Email: "user@email.com", Password: password}))
+
+	tokenManager := manager.NewTokenAuthManager(
+		security.NewJwtIssuer(security.JwtIssuerParams{
+			SecretKey: []byte("secret"),
+			ExpireAt:  time.Hour,
+			Issuer:    "b16",
+		}),
+		manager.WithMFAPendingIssuer(security.JwtIssuerParams{
+			SecretKey: []byte("secret"),
+			ExpireAt:  5 * time.Minute,
+			Issuer:    "b16",
+		}),
+		manager.WithRevocationStore(security.NewSQLRevocationStore(db, time.Hour)),
+	)
+
+	totp := security.NewTOTP(security.TOTPParams{Issuer: "b16", Skew: 1})
+	twoFactor, err := account.NewTwoFactor(account.TwoFactorParams{
+		DB:          db,
+		TOTP:        totp,
+		Key:         []byte("0123456789abcdef0123456789abcdef"),
+		MaxAttempts: 3,
+	})
+	require.NoError(t, err)
+
+	tokenHandler, err := NewTokenHandler(TokenHandlerParams{
+		Users:          users,
+		PasswordHasher: hasher,
+		TokenManager:   tokenManager,
+		TwoFactor:      twoFactor,
+	})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	tokenHandler.Register(mux)
+	NewMFAHandler(MFAHandlerParams{
+		TwoFactor:    twoFactor,
+		TokenManager: tokenManager,
+	}).Register(mux)
+
+	do := func(path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	requireError := func(rec *httptest.ResponseRecorder, status int, code string) {
+		t.Helper()
+
+		require.Equal(t, status, rec.Code)
+
+		var res ErrorResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		require.Equal(t, code, res.Error)
+	}
+
+	login := `{"email":"user@email.com","password":"secret"}`
+
+	rec := do("/auth/login", login, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var tokens TokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tokens))
+	require.Equal(t, "Bearer", tokens.TokenType, "users without a second factor get a token pair")
+
+	rec = do("/auth/mfa/enroll", "", "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = do("/auth/mfa/enroll", "", tokens.AccessToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var enrollment MFAEnrollmentResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &enrollment))
+	require.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/b16:user@email.com?"))
+
+	requireError(do("/auth/mfa/confirm", `{"code":"000000"}`, tokens.AccessToken), http.StatusBadRequest, "invalid_mfa_code")
+
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+
+	rec = do("/auth/mfa/confirm", `{"code":"`+code+`"}`, tokens.AccessToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var recovery RecoveryCodesResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &recovery))
+	require.Len(t, recovery.RecoveryCodes, 10)
+
+	rec = do("/auth/login", login, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var pending MFAPendingResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pending))
+	require.Equal(t, "mfa_pending", pending.TokenType)
+
+	rec = do("/auth/mfa/enroll", "", pending.MFAToken)
+	require.Equal(t, http.StatusUnauthorized, rec.Code, "mfa_pending tokens cannot reach authenticated routes")
+
+	requireError(do("/auth/mfa", `{"mfa_token":"`+pending.MFAToken+`","code":"`+code+`"}`, ""), http.StatusUnauthorized, "invalid_mfa_code")
+	requireError(do("/auth/mfa", `{"mfa_token":"`+tokens.AccessToken+`","code":"`+code+`"}`, ""), http.StatusUnauthorized, "invalid_mfa_token")
+
+	next, err := totp.Code(enrollment.Secret, time.Now().Add(30*time.Second))
+	require.NoError(t, err)
+
+	rec = do("/auth/mfa", `{"mfa_token":"`+pending.MFAToken+`","code":"`+next+`"}`, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var upgraded TokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &upgraded))
+	require.Equal(t, "Bearer", upgraded.TokenType)
+
+	requireError(do("/auth/mfa", `{"mfa_token":"`+pending.MFAToken+`","code":"`+recovery.RecoveryCodes[0]+`"}`, ""), http.StatusUnauthorized, "invalid_mfa_token")
+
+	rec = do("/auth/mfa/disable", `{"code":"`+recovery.RecoveryCodes[0]+`"}`, upgraded.AccessToken)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = do("/auth/login", login, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tokens))
+	require.Equal(t, "Bearer", tokens.TokenType)
+
+	// Wrong codes lock the user out and revoke the pending token; logging in
+	// again does not reset the count.
+	rec = do("/auth/mfa/enroll", "", tokens.AccessToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &enrollment))
+
+	code, err = totp.Code(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, do("/auth/mfa/confirm", `{"code":"`+code+`"}`, tokens.AccessToken).Code)
+
+	rec = do("/auth/login", login, "")
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pending))
+
+	requireError(do("/auth/mfa", `{"mfa_token":"`+pending.MFAToken+`","code":"000000"}`, ""), http.StatusUnauthorized, "invalid_mfa_code")
+	requireError(do("/auth/mfa", `{"mfa_token":"`+pending.MFAToken+`","code":"000001"}`, ""), http.StatusUnauthorized, "invalid_mfa_code")
+	requireError(do("/auth/mfa", `{"mfa_token":"`+pending.MFAToken+`","code":"000002"}`, ""), http.StatusTooManyRequests, "too_many_attempts")
+	requireError(do("/auth/mfa", `{"mfa_token":"`+pending.MFAToken+`","code":"000003"}`, ""), http.StatusUnauthorized, "invalid_mfa_token")
+
+	rec = do("/auth/login", login, "")
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pending))
+
+	requireError(do("/auth/mfa", `{"mfa_token":"`+pending.MFAToken+`","code":"000004"}`, ""), http.StatusTooManyRequests, "too_many_attempts")
+}
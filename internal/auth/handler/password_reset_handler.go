@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/v2code/b16/internal/account"
+	"github.com/v2code/b16/internal/logger"
+)
+
+type PasswordResetHandler struct {
+	resetter *account.PasswordResetter
+}
+
+type PasswordResetHandlerParams struct {
+	Resetter *account.PasswordResetter
+}
+
+func NewPasswordResetHandler(params PasswordResetHandlerParams) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		resetter: params.Resetter,
+	}
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// Register mounts POST /auth/password-reset and
+// /auth/password-reset/confirm on mux.
+func (h *PasswordResetHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /auth/password-reset", h.Request)
+	mux.HandleFunc("POST /auth/password-reset/confirm", h.Confirm)
+}
+
+// Request always answers 202 once the body is valid, whether the email
+// exists or the link could be sent, so it cannot be used to probe accounts.
+func (h *PasswordResetHandler) Request(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetRequest
+	if err := DecodeJSON(r, &req); err != nil || req.Email == "" {
+		WriteError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	if err := h.resetter.Request(r.Context(), req.Email, RequestLocale(r)); err != nil {
+		logger.Error(LOG_AUTH_PREFIX, "Error requesting password reset", err.Error())
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *PasswordResetHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetConfirmRequest
+	if err := DecodeJSON(r, &req); err != nil || req.Token == "" || req.Password == "" {
+		WriteError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	err := h.resetter.Reset(r.Context(), req.Token, req.Password)
+	switch {
+	case errors.Is(err, account.ErrInvalidResetToken):
+		WriteError(w, http.StatusBadRequest, "invalid_token")
+		return
+	case errors.Is(err, account.ErrResetTokenExpired):
+		WriteError(w, http.StatusBadRequest, "expired_token")
+		return
+	case errors.Is(err, account.ErrWeakPassword):
+		WriteError(w, http.StatusBadRequest, "weak_password")
+		return
+	case err != nil:
+		logger.Error(LOG_AUTH_PREFIX, "Error resetting password", err.Error())
+		WriteError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/v2code/b16/internal/account"
+	"github.com/v2code/b16/internal/auth/manager"
+	"github.com/v2code/b16/internal/domain"
+	"github.com/v2code/b16/internal/mailer"
+	"github.com/v2code/b16/internal/repository"
+	"github.com/v2code/b16/internal/security"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordResetHandler(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+	catalogue, client := newTestCatalogue(t)
+	hasher := security.NewBCryptPasswordHasher(bcrypt.MinCost)
+
+	users := repository.NewSQLUserRepository(db)
+	password, err := hasher.Hash("old-password")
+	require.NoError(t, err)
+	require.NoError(t, users.Create(ctx, &domain.User{Email: "user@email.com", Password: password}))
+
+	tokenManager := manager.NewTokenAuthManager(
+		security.NewJwtIssuer(security.JwtIssuerParams{
+			SecretKey: []byte("secret"),
+			ExpireAt:  time.Hour,
+			Issuer:    "b16",
+		}),
+		manager.WithRefreshTokenIssuer(security.NewRefreshTokenIssuer(
+			security.RefreshTokenIssuerParams{ExpireAt: time.Hour},
+			security.NewSQLRefreshTokenStore(db),
+		)),
+		manager.WithRevocationStore(security.NewSQLRevocationStore(db, time.Hour)),
+	)
+
+	tokenHandler, err := NewTokenHandler(TokenHandlerParams{
+		Users:          users,
+		PasswordHasher: hasher,
+		TokenManager:   tokenManager,
+	})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	tokenHandler.Register(mux)
+	NewPasswordResetHandler(PasswordResetHandlerParams{
+		Resetter: account.NewPasswordResetter(account.PasswordResetterParams{
+			DB:             db,
+			Users:          users,
+			PasswordHasher: hasher,
+			Catalogue:      catalogue,
+			Outbox:         mailer.NewOutbox(db),
+			Sessions:       tokenManager,
+			ResetURL:       "https://b16.example.com/reset-password",
+		}),
+	}).Register(mux)
+
+	do := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do("/auth/login", `{"email":"user@email.com","password":"old-password"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var session TokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &session))
+
+	rec = do("/auth/password-reset", `{"email":"unknown@email.com"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	deliverOutbox(t, db, client)
+	require.Empty(t, client.Mails())
+
+	rec = do("/auth/password-reset", `{"email":"user@email.com"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Empty(t, client.Mails(), "the email is only enqueued during the request")
+	deliverOutbox(t, db, client)
+
+	sent, ok := client.Last()
+	require.True(t, ok)
+	link, err := url.Parse(regexp.MustCompile(`https://\S+`).FindString(sent.Body("text/plain")))
+	require.NoError(t, err)
+	token := link.Query().Get("token")
+
+	rec = do("/auth/password-reset/confirm", `{"token":"`+token+`","password":"short"}`)
+	requireErrorResponse(t, rec, http.StatusBadRequest, "weak_password")
+
+	rec = do("/auth/password-reset/confirm", `{"token":"unknown","password":"new-password"}`)
+	requireErrorResponse(t, rec, http.StatusBadRequest, "invalid_token")
+
+	// Tokens issued during the second of the reset stay valid, so let the
+	// session's second pass first.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	rec = do("/auth/password-reset/confirm", `{"token":"`+token+`","password":"new-password"}`)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = do("/auth/password-reset/confirm", `{"token":"`+token+`","password":"new-password"}`)
+	requireErrorResponse(t, rec, http.StatusBadRequest, "invalid_token")
+
+	rec = do("/auth/refresh", `{"refresh_token":"`+session.RefreshToken+`"}`)
+	requireErrorResponse(t, rec, http.StatusUnauthorized, "invalid_grant")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+session.AccessToken)
+	_, err = tokenManager.Authenticate(req)
+	require.Error(t, err)
+
+	rec = do("/auth/login", `{"email":"user@email.com","password":"old-password"}`)
+	requireErrorResponse(t, rec, http.StatusUnauthorized, "invalid_credentials")
+
+	rec = do("/auth/login", `{"email":"user@email.com","password":"new-password"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &session))
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+session.AccessToken)
+	_, err = tokenManager.Authenticate(req)
+	require.NoError(t, err, "a login right after the reset is not revoked")
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const maxRequestBodySize = 1 << 20
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func DecodeJSON(r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func WriteError(w http.ResponseWriter, status int, code string) {
+	WriteJSON(w, status, ErrorResponse{Error: code})
+}
@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/v2code/b16/internal/account"
+	"github.com/v2code/b16/internal/auth"
+	"github.com/v2code/b16/internal/auth/manager"
+	"github.com/v2code/b16/internal/domain"
+	"github.com/v2code/b16/internal/logger"
+	"github.com/v2code/b16/internal/security"
+)
+
+const LOG_AUTH_PREFIX = "AUTH"
+
+// dummyPassword is hashed once and compared against when the email is
+// unknown, so both failure paths cost the same and do not reveal whether the
+// account exists.
+const dummyPassword = "b16-dummy-password"
+
+// TwoFactorVerifier checks the second factor of users who enabled one.
+// *account.TwoFactor implements it.
+type TwoFactorVerifier interface {
+	Enabled(ctx context.Context, userID string) (bool, error)
+	Verify(ctx context.Context, userID string, code string) error
+}
+
+type TokenHandler struct {
+	users          domain.UserRepository
+	passwordHasher security.PasswordHasher
+	tokenManager   *manager.TokenAuthManager
+	twoFactor      TwoFactorVerifier
+	dummyHash      string
+}
+
+type TokenHandlerParams struct {
+	Users          domain.UserRepository
+	PasswordHasher security.PasswordHasher
+	TokenManager   *manager.TokenAuthManager
+	// TwoFactor is optional. When set, users with a second factor receive an
+	// mfa_pending token on login instead of a token pair; the manager must
+	// then be configured with manager.WithMFAPendingIssuer.
+	TwoFactor TwoFactorVerifier
+}
+
+// NewTokenHandler hashes dummyPassword up front and returns the hasher's
+// error, so a misconfigured hasher fails at startup instead of on login.
+func NewTokenHandler(params TokenHandlerParams) (*TokenHandler, error) {
+	dummyHash, err := params.PasswordHasher.Hash(dummyPassword)
+	if err != nil {
+		return nil, fmt.Errorf("dummy password hash: %w", err)
+	}
+
+	return &TokenHandler{
+		users:          params.Users,
+		passwordHasher: params.PasswordHasher,
+		tokenManager:   params.TokenManager,
+		twoFactor:      params.TwoFactor,
+		dummyHash:      dummyHash,
+	}, nil
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type MFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type MFAPendingResponse struct {
+	MFAToken  string `json:"mfa_token"`
+	TokenType string `json:"token_type"`
+}
+
+type TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token,omitempty"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in,omitempty"`
+}
+
+// Register mounts POST /auth/login, /auth/mfa, /auth/refresh and
+// /auth/logout on mux.
+func (h *TokenHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /auth/login", h.Login)
+	mux.HandleFunc("POST /auth/mfa", h.VerifyMFA)
+	mux.HandleFunc("POST /auth/refresh", h.Refresh)
+	mux.HandleFunc("POST /auth/logout", h.Logout)
+}
+
+func (h *TokenHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := DecodeJSON(r, &req); err != nil || req.Email == "" || req.Password == "" {
+		WriteError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	user, err := h.users.GetByEmail(r.Context(), req.Email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		h.passwordHasher.Compare(req.Password, h.dummyHash)
+		WriteError(w, http.StatusUnauthorized, "invalid_credentials")
+		return
+	}
+	if err != nil {
+		logger.Error(LOG_AUTH_PREFIX, "Error loading user", err.Error())
+		WriteError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	if err := h.passwordHasher.Compare(req.Password, user.Password); err != nil {
+		WriteError(w, http.StatusUnauthorized, "invalid_credentials")
+		return
+	}
+
+	if h.twoFactor != nil {
+		enabled, err := h.twoFactor.Enabled(r.Context(), user.ID)
+		if err != nil {
+			logger.Error(LOG_AUTH_PREFIX, "Error loading two-factor settings", err.Error())
+			WriteError(w, http.StatusInternalServerError, "server_error")
+			return
+		}
+
+		if enabled {
+			token, err := h.tokenManager.IssueMFAPending(user.ID)
+			if err != nil {
+				logger.Error(LOG_AUTH_PREFIX, "Error issuing mfa_pending token", err.Error())
+				WriteError(w, http.StatusInternalServerError, "server_error")
+				return
+			}
+
+			WriteJSON(w, http.StatusOK, MFAPendingResponse{MFAToken: token, TokenType: "mfa_pending"})
+			return
+		}
+	}
+
+	pair, err := h.tokenManager.Issue(r.Context(), ClaimsForUser(user))
+	if err != nil {
+		logger.Error(LOG_AUTH_PREFIX, "Error issuing token", err.Error())
+		WriteError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewTokenResponse(pair))
+}
+
+// VerifyMFA exchanges an mfa_pending token and a TOTP or recovery code for a
+// token pair. When revocation is configured the pending token is revoked on
+// success, so it cannot be exchanged twice, and once the user is locked out
+// after too many wrong codes.
+func (h *TokenHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req MFARequest
+	if err := DecodeJSON(r, &req); err != nil || req.MFAToken == "" || req.Code == "" {
+		WriteError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	if h.twoFactor == nil {
+		WriteError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	pending, err := h.tokenManager.AuthenticateMFAPending(r.Context(), req.MFAToken)
+	switch {
+	case errors.Is(err, auth.ErrMFANotConfigured):
+		WriteError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	case err != nil:
+		WriteError(w, http.StatusUnauthorized, "invalid_mfa_token")
+		return
+	}
+
+	err = h.twoFactor.Verify(r.Context(), pending.Subject, req.Code)
+	switch {
+	case errors.Is(err, account.ErrTooManyMFAAttempts):
+		err := h.tokenManager.Revoke(r.Context(), pending)
+		if err != nil && !errors.Is(err, auth.ErrRevocationNotConfigured) {
+			logger.Error(LOG_AUTH_PREFIX, "Error revoking mfa_pending token", err.Error())
+		}
+		WriteError(w, http.StatusTooManyRequests, "too_many_attempts")
+		return
+	case errors.Is(err, account.ErrInvalidMFACode):
+		WriteError(w, http.StatusUnauthorized, "invalid_mfa_code")
+		return
+	case errors.Is(err, account.ErrMFANotEnabled):
+		WriteError(w, http.StatusUnauthorized, "invalid_mfa_token")
+		return
+	case err != nil:
+		logger.Error(LOG_AUTH_PREFIX, "Error verifying two-factor code", err.Error())
+		WriteError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	err = h.tokenManager.Revoke(r.Context(), pending)
+	if err != nil && !errors.Is(err, auth.ErrRevocationNotConfigured) {
+		logger.Error(LOG_AUTH_PREFIX, "Error revoking mfa_pending token", err.Error())
+		WriteError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	user, err := h.users.GetByID(r.Context(), pending.Subject)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		WriteError(w, http.StatusUnauthorized, "invalid_mfa_token")
+		return
+	}
+	if err != nil {
+		logger.Error(LOG_AUTH_PREFIX, "Error loading user", err.Error())
+		WriteError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	pair, err := h.tokenManager.Issue(r.Context(), ClaimsForUser(user))
+	if err != nil {
+		logger.Error(LOG_AUTH_PREFIX, "Error issuing token", err.Error())
+		WriteError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewTokenResponse(pair))
+}
+
+func (h *TokenHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := DecodeJSON(r, &req); err != nil || req.RefreshToken == "" {
+		WriteError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	pair, err := h.tokenManager.Refresh(r.Context(), req.RefreshToken)
+	switch {
+	case errors.Is(err, auth.ErrRefreshNotConfigured):
+		WriteError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	case errors.Is(err, security.ErrInvalidRefreshToken),
+		errors.Is(err, security.ErrRefreshTokenExpired),
+		errors.Is(err, security.ErrRefreshTokenReused):
+		WriteError(w, http.StatusUnauthorized, "invalid_grant")
+		return
+	case err != nil:
+		logger.Error(LOG_AUTH_PREFIX, "Error refreshing token", err.Error())
+		WriteError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, NewTokenResponse(pair))
+}
+
+// Logout revokes the bearer access token, if any, and the family of the
+// refresh token sent in the body. It always answers 204 for tokens that are
+// already invalid.
+func (h *TokenHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if r.ContentLength != 0 {
+		if err := DecodeJSON(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid_request")
+			return
+		}
+	}
+
+	if r.Header.Get("Authorization") != "" {
+		if principal, err := h.tokenManager.Authenticate(r); err == nil {
+			err := h.tokenManager.Revoke(r.Context(), principal.Principal().Claims)
+			if err != nil && !errors.Is(err, auth.ErrRevocationNotConfigured) {
+				logger.Error(LOG_AUTH_PREFIX, "Error revoking access token", err.Error())
+				WriteError(w, http.StatusInternalServerError, "server_error")
+				return
+			}
+		}
+	}
+
+	if req.RefreshToken != "" {
+		err := h.tokenManager.RevokeRefreshToken(r.Context(), req.RefreshToken)
+		if err != nil && !errors.Is(err, security.ErrInvalidRefreshToken) && !errors.Is(err, auth.ErrRefreshNotConfigured) {
+			logger.Error(LOG_AUTH_PREFIX, "Error revoking refresh token", err.Error())
+			WriteError(w, http.StatusInternalServerError, "server_error")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ClaimsForUser maps a user to the claims of its access token.
+func ClaimsForUser(user *domain.User) *security.Claims {
+	return &security.Claims{
+		Subject: user.ID,
+		Email:   user.Email,
+		Roles:   user.RoleNames(),
+	}
+}
+
+func NewTokenResponse(pair *security.TokenPair) TokenResponse {
+	res := TokenResponse{
+		AccessToken:  pair.AccessToken,
+		TokenType:    "Bearer",
+		RefreshToken: pair.RefreshToken,
+	}
+
+	if !pair.RefreshExpiresAt.IsZero() {
+		res.RefreshExpiresIn = int64(time.Until(pair.RefreshExpiresAt).Seconds())
+	}
+
+	return res
+}
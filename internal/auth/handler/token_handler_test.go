@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/v2code/b16/internal/auth/manager"
+	"github.com/v2code/b16/internal/domain"
+	"github.com/v2code/b16/internal/security"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeUserRepository struct {
+	domain.UserRepository
+	users map[string]*domain.User
+	err   error
+}
+
+func (r *fakeUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	user, ok := r.users[email]
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+type testTokenHandler struct {
+	handler      *TokenHandler
+	tokenManager *manager.TokenAuthManager
+	users        *fakeUserRepository
+	mux          *http.ServeMux
+}
+
+func newTestTokenHandler(t *testing.T) *testTokenHandler {
+	t.Helper()
+
+	hasher := security.NewBCryptPasswordHasher(bcrypt.MinCost)
+
+	password, err := hasher.Hash("secret")
+	require.NoError(t, err)
+
+	users := &fakeUserRepository{users: map[string]*domain.User{
+		"admin@email.com": {
+			ID:       "user-1",
+			Email:    "admin@email.com",
+			Password: password,
+			Roles:    []domain.Role{{ID: "role-1", Name: "ADMIN"}},
+		},
+	}}
+
+	tokenManager := manager.NewTokenAuthManager(
+		security.NewJwtIssuer(security.JwtIssuerParams{
+			SecretKey: []byte("secret"),
+			ExpireAt:  time.Hour,
+			Issuer:    "b16",
+		}),
+		manager.WithRefreshTokenIssuer(security.NewRefreshTokenIssuer(
+			security.RefreshTokenIssuerParams{ExpireAt: time.Hour},
+			security.NewMemoryRefreshTokenStore(),
+		)),
+		manager.WithRevocationStore(security.NewMemoryRevocationStore(time.Hour)),
+	)
+
+	handler, err := NewTokenHandler(TokenHandlerParams{
+		Users:          users,
+		PasswordHasher: hasher,
+		TokenManager:   tokenManager,
+	})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	handler.Register(mux)
+
+	return &testTokenHandler{handler: handler, tokenManager: tokenManager, users: users, mux: mux}
+}
+
+func (h *testTokenHandler) do(method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	h.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+type TestLoginParams struct {
+	Name         string
+	Body         string
+	RepoErr      error
+	ExpectStatus int
+	ExpectError  string
+}
+
+func TestTokenHandler_Login(t *testing.T) {
+	cases := []TestLoginParams{
+		{
+			Name:         "valid credentials",
+			Body:         `{"email":"admin@email.com","password":"secret"}`,
+			ExpectStatus: http.StatusOK,
+		},
+		{
+			Name:         "wrong password",
+			Body:         `{"email":"admin@email.com","password":"wrong"}`,
+			ExpectStatus: http.StatusUnauthorized,
+			ExpectError:  "invalid_credentials",
+		},
+		{
+			Name:         "unknown email",
+			Body:         `{"email":"unknown@email.com","password":"secret"}`,
+			ExpectStatus: http.StatusUnauthorized,
+			ExpectError:  "invalid_credentials",
+		},
+		{
+			Name:         "malformed body",
+			Body:         `{"email":`,
+			ExpectStatus: http.StatusBadRequest,
+			ExpectError:  "invalid_request",
+		},
+		{
+			Name:         "repository failure",
+			Body:         `{"email":"admin@email.com","password":"secret"}`,
+			RepoErr:      errors.New("connection refused"),
+			ExpectStatus: http.StatusInternalServerError,
+			ExpectError:  "server_error",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			h := newTestTokenHandler(t)
+			h.users.err = tt.RepoErr
+
+			rec := h.do(http.MethodPost, "/auth/login", tt.Body, "")
+			require.Equal(t, tt.ExpectStatus, rec.Code)
+			require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+			if tt.ExpectError != "" {
+				var res ErrorResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+				require.Equal(t, tt.ExpectError, res.Error)
+				return
+			}
+
+			var res TokenResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			require.Equal(t, "Bearer", res.TokenType)
+			require.NotEmpty(t, res.RefreshToken)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+res.AccessToken)
+
+			principal, err := h.tokenManager.Authenticate(req)
+			require.NoError(t, err)
+			require.Equal(t, "user-1", principal.Principal().Subject)
+			require.Equal(t, []string{"ADMIN"}, principal.Principal().Roles)
+		})
+	}
+}
+
+func TestTokenHandler_RefreshAndLogout(t *testing.T) {
+	h := newTestTokenHandler(t)
+
+	rec := h.do(http.MethodPost, "/auth/login", `{"email":"admin@email.com","password":"secret"}`, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var login TokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &login))
+
+	rec = h.do(http.MethodPost, "/auth/refresh", `{"refresh_token":"`+login.RefreshToken+`"}`, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var refreshed TokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &refreshed))
+	require.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+
+	rec = h.do(http.MethodPost, "/auth/refresh", `{"refresh_token":"unknown"}`, "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = h.do(http.MethodPost, "/auth/logout", `{"refresh_token":"`+refreshed.RefreshToken+`"}`, refreshed.AccessToken)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = h.do(http.MethodPost, "/auth/refresh", `{"refresh_token":"`+refreshed.RefreshToken+`"}`, "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+refreshed.AccessToken)
+
+	_, err := h.tokenManager.Authenticate(req)
+	require.Error(t, err)
+}
+
+func TestNewTokenHandler_HasherError(t *testing.T) {
+	_, err := NewTokenHandler(TokenHandlerParams{
+		PasswordHasher: security.NewBCryptPasswordHasher(bcrypt.MaxCost + 1),
+	})
+	require.Error(t, err)
+}
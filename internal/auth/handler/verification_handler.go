@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/v2code/b16/internal/account"
+	"github.com/v2code/b16/internal/logger"
+)
+
+type VerificationHandler struct {
+	verifier *account.EmailVerifier
+}
+
+type VerificationHandlerParams struct {
+	Verifier *account.EmailVerifier
+}
+
+func NewVerificationHandler(params VerificationHandlerParams) *VerificationHandler {
+	return &VerificationHandler{
+		verifier: params.Verifier,
+	}
+}
+
+type VerifyEmailRequest struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+// Register mounts POST /auth/verify-email and /auth/verify-email/resend on
+// mux.
+func (h *VerificationHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /auth/verify-email", h.Verify)
+	mux.HandleFunc("POST /auth/verify-email/resend", h.Resend)
+}
+
+func (h *VerificationHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if err := DecodeJSON(r, &req); err != nil || req.Email == "" || req.Code == "" {
+		WriteError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	err := h.verifier.Verify(r.Context(), req.Email, req.Code)
+	switch {
+	case errors.Is(err, account.ErrInvalidCode):
+		WriteError(w, http.StatusBadRequest, "invalid_code")
+		return
+	case errors.Is(err, account.ErrCodeExpired):
+		WriteError(w, http.StatusBadRequest, "expired_code")
+		return
+	case errors.Is(err, account.ErrTooManyAttempts):
+		WriteError(w, http.StatusTooManyRequests, "too_many_attempts")
+		return
+	case err != nil:
+		logger.Error(LOG_AUTH_PREFIX, "Error verifying email", err.Error())
+		WriteError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Resend always answers 202 once the body is valid, whether the email
+// exists, is already verified or got a code moments ago, so it cannot be
+// used to probe accounts.
+func (h *VerificationHandler) Resend(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationRequest
+	if err := DecodeJSON(r, &req); err != nil || req.Email == "" {
+		WriteError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	if err := h.verifier.Resend(r.Context(), req.Email, RequestLocale(r)); err != nil {
+		logger.Error(LOG_AUTH_PREFIX, "Error sending verification code", err.Error())
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// RequestLocale returns the first language of the Accept-Language header,
+// or an empty string for the default locale.
+func RequestLocale(r *http.Request) string {
+	language, _, _ := strings.Cut(r.Header.Get("Accept-Language"), ",")
+	language, _, _ = strings.Cut(language, ";")
+	language = strings.TrimSpace(language)
+
+	if language == "*" {
+		return ""
+	}
+	return language
+}
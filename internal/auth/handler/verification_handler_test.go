@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/v2code/b16/internal/account"
+	"github.com/v2code/b16/internal/database"
+	"github.com/v2code/b16/internal/domain"
+	"github.com/v2code/b16/internal/mailer"
+	"github.com/v2code/b16/internal/repository"
+)
+
+type testVerificationHandler struct {
+	db     database.Database
+	users  domain.UserRepository
+	client *mailer.RecordingClient
+	mux    *http.ServeMux
+}
+
+func newTestVerificationHandler(t *testing.T) *testVerificationHandler {
+	t.Helper()
+
+	db := newTestDatabase(t)
+	catalogue, client := newTestCatalogue(t)
+
+	users := repository.NewSQLUserRepository(db)
+	require.NoError(t, users.Create(context.Background(), &domain.User{Email: "user@email.com", Password: "hash"}))
+
+	handler := NewVerificationHandler(VerificationHandlerParams{
+		Verifier: account.NewEmailVerifier(account.EmailVerifierParams{
+			DB:        db,
+			Users:     users,
+			Catalogue: catalogue,
+			Outbox:    mailer.NewOutbox(db),
+			Secret:    []byte("secret"),
+		}),
+	})
+
+	mux := http.NewServeMux()
+	handler.Register(mux)
+
+	return &testVerificationHandler{db: db, users: users, client: client, mux: mux}
+}
+
+func (h *testVerificationHandler) do(path, body, language string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if language != "" {
+		req.Header.Set("Accept-Language", language)
+	}
+
+	rec := httptest.NewRecorder()
+	h.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func requireErrorResponse(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+
+	require.Equal(t, status, rec.Code)
+
+	var res ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.Equal(t, code, res.Error)
+}
+
+func TestVerificationHandler(t *testing.T) {
+	h := newTestVerificationHandler(t)
+
+	rec := h.do("/auth/verify-email/resend", `{"email":"user@email.com"}`, "en-US,en;q=0.9")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Empty(t, h.client.Mails(), "the email is only enqueued during the request")
+
+	deliverOutbox(t, h.db, h.client)
+
+	sent, ok := h.client.Last()
+	require.True(t, ok)
+	require.Equal(t, "Verification Code", sent.Subject())
+	code := regexp.MustCompile(`\b\d{6}\b`).FindString(sent.Body("text/plain"))
+
+	// Neither the cooldown nor an unknown address is visible to the caller.
+	rec = h.do("/auth/verify-email/resend", `{"email":"user@email.com"}`, "")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Empty(t, rec.Header().Get("Retry-After"))
+
+	rec = h.do("/auth/verify-email/resend", `{"email":"unknown@email.com"}`, "")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	deliverOutbox(t, h.db, h.client)
+	require.Len(t, h.client.Mails(), 1)
+
+	rec = h.do("/auth/verify-email", `{"email":"user@email.com","code":"wrong"}`, "")
+	requireErrorResponse(t, rec, http.StatusBadRequest, "invalid_code")
+
+	rec = h.do("/auth/verify-email", `{"email":"user@email.com"}`, "")
+	requireErrorResponse(t, rec, http.StatusBadRequest, "invalid_request")
+
+	rec = h.do("/auth/verify-email", `{"email":"user@email.com","code":"`+code+`"}`, "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	user, err := h.users.GetByEmail(context.Background(), "user@email.com")
+	require.NoError(t, err)
+	require.True(t, user.EmailVerified)
+}
+
+func TestRequestLocale(t *testing.T) {
+	for header, expected := range map[string]string{
+		"":                      "",
+		"*":                     "",
+		"en-US,en;q=0.9":        "en-US",
+		"pt-BR;q=0.8, en;q=0.5": "pt-BR",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Language", header)
+		require.Equal(t, expected, RequestLocale(req), header)
+	}
+}
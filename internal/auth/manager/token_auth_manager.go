@@ -1,23 +1,73 @@
 package manager
 
 import (
+	"context"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/v2code/b16/internal/auth"
 	"github.com/v2code/b16/internal/security"
 )
 
+// MFAPendingTokenType is the typ header of mfa_pending tokens, which only
+// prove the password was checked. Access token issuers require their own
+// type, so these tokens are rejected as access tokens by construction, also
+// by other services verifying signatures through the JWKS endpoint.
+const MFAPendingTokenType = "mfa-pending+jwt"
+
+// MFAPendingAudience is the only audience of mfa_pending tokens.
+const MFAPendingAudience = "b16-mfa"
+
 type TokenAuthManager struct {
-	jwtIssuer security.TokenIssuer[*security.Claims]
+	jwtIssuer          security.TokenIssuer[*security.Claims]
+	refreshTokenIssuer *security.RefreshTokenIssuer
+	revocationStore    security.RevocationStore
+	mfaPendingIssuer   security.TokenIssuer[*security.Claims]
+}
+
+type TokenAuthManagerOption func(m *TokenAuthManager)
+
+func WithRefreshTokenIssuer(refreshTokenIssuer *security.RefreshTokenIssuer) TokenAuthManagerOption {
+	return func(m *TokenAuthManager) {
+		m.refreshTokenIssuer = refreshTokenIssuer
+	}
+}
+
+func WithRevocationStore(revocationStore security.RevocationStore) TokenAuthManagerOption {
+	return func(m *TokenAuthManager) {
+		m.revocationStore = revocationStore
+	}
 }
 
-func NewTokenAuthManager(jwtIssuer security.TokenIssuer[*security.Claims]) *TokenAuthManager {
-	return &TokenAuthManager{
+// WithMFAPendingIssuer enables two-factor logins. mfa_pending tokens are
+// signed with params, whose Type and Audience are replaced by
+// MFAPendingTokenType and MFAPendingAudience. ExpireAt should be a few
+// minutes at most.
+func WithMFAPendingIssuer(params security.JwtIssuerParams) TokenAuthManagerOption {
+	params.Type = MFAPendingTokenType
+	params.Audience = []string{MFAPendingAudience}
+	mfaPendingIssuer := security.NewJwtIssuer(params)
+
+	return func(m *TokenAuthManager) {
+		m.mfaPendingIssuer = mfaPendingIssuer
+	}
+}
+
+func NewTokenAuthManager(jwtIssuer security.TokenIssuer[*security.Claims], opts ...TokenAuthManagerOption) *TokenAuthManager {
+	m := &TokenAuthManager{
 		jwtIssuer: jwtIssuer,
 	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
 }
 
+// TokenPrincipal exposes every decoded claim (registered and custom) to
+// policies through the embedded security.Claims.
 type TokenPrincipal struct {
 	*security.Claims
 }
@@ -43,7 +93,132 @@ func (m *TokenAuthManager) Authenticate(req *http.Request) (auth.Principal[*Toke
 		return nil, auth.ErrUnauthorized
 	}
 
+	if claims.HasAudience(MFAPendingAudience) {
+		return nil, auth.ErrUnauthorized
+	}
+
+	if m.revocationStore != nil {
+		revoked, err := m.revocationStore.IsRevoked(req.Context(), claims)
+		if err != nil || revoked {
+			return nil, auth.ErrUnauthorized
+		}
+	}
+
 	return &TokenPrincipal{
 		Claims: claims,
 	}, nil
 }
+
+// Issue creates an access token for claims and, when a refresh token issuer
+// is configured, the first refresh token of a new family.
+func (m *TokenAuthManager) Issue(ctx context.Context, claims *security.Claims) (*security.TokenPair, error) {
+	accessToken, err := m.jwtIssuer.Create(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	pair := &security.TokenPair{AccessToken: accessToken}
+
+	if m.refreshTokenIssuer == nil {
+		return pair, nil
+	}
+
+	pair.RefreshToken, pair.RefreshExpiresAt, err = m.refreshTokenIssuer.Issue(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// IssueMFAPending creates an mfa_pending token for subject, to be exchanged
+// for a full token pair once the second factor is verified. It carries no
+// email or roles; those are loaded again when the full token is issued.
+func (m *TokenAuthManager) IssueMFAPending(subject string) (string, error) {
+	if m.mfaPendingIssuer == nil {
+		return "", auth.ErrMFANotConfigured
+	}
+
+	return m.mfaPendingIssuer.Create(&security.Claims{Subject: subject})
+}
+
+// AuthenticateMFAPending decodes an mfa_pending token and returns its
+// claims. Tokens of another type or audience, revoked or expired ones are
+// rejected with auth.ErrUnauthorized.
+func (m *TokenAuthManager) AuthenticateMFAPending(ctx context.Context, token string) (*security.Claims, error) {
+	if m.mfaPendingIssuer == nil {
+		return nil, auth.ErrMFANotConfigured
+	}
+
+	claims, err := m.mfaPendingIssuer.Decode(token)
+	if err != nil {
+		return nil, auth.ErrUnauthorized
+	}
+
+	if m.revocationStore != nil {
+		revoked, err := m.revocationStore.IsRevoked(ctx, claims)
+		if err != nil || revoked {
+			return nil, auth.ErrUnauthorized
+		}
+	}
+
+	return claims, nil
+}
+
+// Refresh rotates refreshToken and returns a fresh access/refresh pair.
+func (m *TokenAuthManager) Refresh(ctx context.Context, refreshToken string) (*security.TokenPair, error) {
+	if m.refreshTokenIssuer == nil {
+		return nil, auth.ErrRefreshNotConfigured
+	}
+
+	rotated, expiresAt, claims, err := m.refreshTokenIssuer.Rotate(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := m.jwtIssuer.Create(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &security.TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     rotated,
+		RefreshExpiresAt: expiresAt,
+	}, nil
+}
+
+// RevokeRefreshToken revokes the whole family of refreshToken.
+func (m *TokenAuthManager) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	if m.refreshTokenIssuer == nil {
+		return auth.ErrRefreshNotConfigured
+	}
+
+	return m.refreshTokenIssuer.Revoke(ctx, refreshToken)
+}
+
+// Revoke denylists the access token described by claims until it expires.
+func (m *TokenAuthManager) Revoke(ctx context.Context, claims *security.Claims) error {
+	if m.revocationStore == nil {
+		return auth.ErrRevocationNotConfigured
+	}
+
+	return m.revocationStore.Revoke(ctx, claims.ID, claims.ExpiresAt)
+}
+
+// RevokeSubject rejects every access token of subject issued before the given
+// instant and, when refresh tokens are enabled, revokes all of its refresh
+// token families, ending every session of the subject.
+func (m *TokenAuthManager) RevokeSubject(ctx context.Context, subject string, before time.Time) error {
+	if m.revocationStore == nil {
+		return auth.ErrRevocationNotConfigured
+	}
+
+	if m.refreshTokenIssuer != nil {
+		if err := m.refreshTokenIssuer.RevokeSubject(ctx, subject); err != nil {
+			return err
+		}
+	}
+
+	return m.revocationStore.RevokeSubject(ctx, subject, before)
+}
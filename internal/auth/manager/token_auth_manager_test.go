@@ -1,9 +1,11 @@
 package manager
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/v2code/b16/internal/auth"
@@ -34,8 +36,11 @@ type TokenAuthTestParams struct {
 
 func TestTokenAuthManager_Authenticate(t *testing.T) {
 	validClaims := &security.Claims{
-		Email: "admin@email.com",
-		Roles: []string{"ADMIN"},
+		Subject:  "user-1",
+		Audience: []string{"b16-api"},
+		Email:    "admin@email.com",
+		Roles:    []string{"ADMIN"},
+		Custom:   map[string]any{"tenant": "acme"},
 	}
 
 	cases := []TokenAuthTestParams{
@@ -92,6 +97,174 @@ func TestTokenAuthManager_Authenticate(t *testing.T) {
 			p := principal.Principal()
 			require.Equal(t, tt.ExpectEmail, p.Email)
 			require.Contains(t, p.Roles, tt.ExpectRole)
+			require.Equal(t, "user-1", p.Subject)
+			require.True(t, p.HasAudience("b16-api"))
+
+			tenant, ok := p.Claim("tenant")
+			require.True(t, ok)
+			require.Equal(t, "acme", tenant)
 		})
 	}
 }
+
+func TestTokenAuthManager_Refresh(t *testing.T) {
+	ctx := context.Background()
+
+	claims := &security.Claims{
+		Email: "admin@email.com",
+		Roles: []string{"ADMIN"},
+	}
+
+	t.Run("refresh not configured", func(t *testing.T) {
+		manager := NewTokenAuthManager(&fakeTokenIssuer{})
+
+		pair, err := manager.Issue(ctx, claims)
+		require.NoError(t, err)
+		require.Equal(t, "fake-token", pair.AccessToken)
+		require.Empty(t, pair.RefreshToken)
+
+		_, err = manager.Refresh(ctx, "refresh-token")
+		require.ErrorIs(t, err, auth.ErrRefreshNotConfigured)
+	})
+
+	t.Run("issue and rotate", func(t *testing.T) {
+		refreshTokenIssuer := security.NewRefreshTokenIssuer(
+			security.RefreshTokenIssuerParams{ExpireAt: time.Hour},
+			security.NewMemoryRefreshTokenStore(),
+		)
+		manager := NewTokenAuthManager(&fakeTokenIssuer{}, WithRefreshTokenIssuer(refreshTokenIssuer))
+
+		pair, err := manager.Issue(ctx, claims)
+		require.NoError(t, err)
+		require.NotEmpty(t, pair.RefreshToken)
+
+		refreshed, err := manager.Refresh(ctx, pair.RefreshToken)
+		require.NoError(t, err)
+		require.Equal(t, "fake-token", refreshed.AccessToken)
+		require.NotEqual(t, pair.RefreshToken, refreshed.RefreshToken)
+
+		_, err = manager.Refresh(ctx, pair.RefreshToken)
+		require.ErrorIs(t, err, security.ErrRefreshTokenReused)
+
+		_, err = manager.Refresh(ctx, refreshed.RefreshToken)
+		require.ErrorIs(t, err, security.ErrInvalidRefreshToken)
+	})
+}
+
+func TestTokenAuthManager_Revocation(t *testing.T) {
+	ctx := context.Background()
+
+	claims := &security.Claims{
+		ID:        "token-id",
+		Subject:   "user-1",
+		Email:     "admin@email.com",
+		IssuedAt:  time.Now().Add(-time.Minute),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	authenticate := func(manager *TokenAuthManager) error {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer valid-token")
+		_, err := manager.Authenticate(req)
+		return err
+	}
+
+	t.Run("revocation not configured", func(t *testing.T) {
+		manager := NewTokenAuthManager(&fakeTokenIssuer{claims: claims})
+		require.ErrorIs(t, manager.Revoke(ctx, claims), auth.ErrRevocationNotConfigured)
+	})
+
+	t.Run("revoked token", func(t *testing.T) {
+		manager := NewTokenAuthManager(
+			&fakeTokenIssuer{claims: claims},
+			WithRevocationStore(security.NewMemoryRevocationStore(time.Hour)),
+		)
+
+		require.NoError(t, authenticate(manager))
+		require.NoError(t, manager.Revoke(ctx, claims))
+		require.ErrorIs(t, authenticate(manager), auth.ErrUnauthorized)
+	})
+
+	t.Run("revoked subject", func(t *testing.T) {
+		manager := NewTokenAuthManager(
+			&fakeTokenIssuer{claims: claims},
+			WithRevocationStore(security.NewMemoryRevocationStore(time.Hour)),
+			WithRefreshTokenIssuer(security.NewRefreshTokenIssuer(
+				security.RefreshTokenIssuerParams{ExpireAt: time.Hour},
+				security.NewMemoryRefreshTokenStore(),
+			)),
+		)
+
+		pair, err := manager.Issue(ctx, claims)
+		require.NoError(t, err)
+
+		require.NoError(t, manager.RevokeSubject(ctx, "user-1", time.Now()))
+		require.ErrorIs(t, authenticate(manager), auth.ErrUnauthorized)
+
+		_, err = manager.Refresh(ctx, pair.RefreshToken)
+		require.ErrorIs(t, err, security.ErrInvalidRefreshToken)
+	})
+}
+
+func TestTokenAuthManager_MFAPending(t *testing.T) {
+	ctx := context.Background()
+
+	params := security.JwtIssuerParams{
+		SecretKey: []byte("secret"),
+		ExpireAt:  time.Hour,
+		Issuer:    "b16",
+	}
+
+	t.Run("mfa not configured", func(t *testing.T) {
+		manager := NewTokenAuthManager(security.NewJwtIssuer(params))
+
+		_, err := manager.IssueMFAPending("user-1")
+		require.ErrorIs(t, err, auth.ErrMFANotConfigured)
+
+		_, err = manager.AuthenticateMFAPending(ctx, "token")
+		require.ErrorIs(t, err, auth.ErrMFANotConfigured)
+	})
+
+	t.Run("pending token is not an access token", func(t *testing.T) {
+		accessIssuer := security.NewJwtIssuer(params)
+
+		pendingParams := params
+		pendingParams.ExpireAt = 5 * time.Minute
+
+		manager := NewTokenAuthManager(
+			accessIssuer,
+			WithMFAPendingIssuer(pendingParams),
+			WithRevocationStore(security.NewMemoryRevocationStore(time.Hour)),
+		)
+
+		pending, err := manager.IssueMFAPending("user-1")
+		require.NoError(t, err)
+
+		// The pending token shares the signing key, yet a plain access
+		// token issuer refuses it because of its type.
+		_, err = accessIssuer.Decode(pending)
+		require.ErrorIs(t, err, security.ErrInvalidTokenType)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+pending)
+		_, err = manager.Authenticate(req)
+		require.ErrorIs(t, err, auth.ErrUnauthorized)
+
+		pendingClaims, err := manager.AuthenticateMFAPending(ctx, pending)
+		require.NoError(t, err)
+		require.Equal(t, "user-1", pendingClaims.Subject)
+		require.Equal(t, []string{MFAPendingAudience}, pendingClaims.Audience)
+		require.Empty(t, pendingClaims.Email)
+		require.Empty(t, pendingClaims.Roles)
+
+		pair, err := manager.Issue(ctx, &security.Claims{Subject: "user-1", Roles: []string{"ADMIN"}})
+		require.NoError(t, err)
+
+		_, err = manager.AuthenticateMFAPending(ctx, pair.AccessToken)
+		require.ErrorIs(t, err, auth.ErrUnauthorized)
+
+		require.NoError(t, manager.Revoke(ctx, pendingClaims))
+		_, err = manager.AuthenticateMFAPending(ctx, pending)
+		require.ErrorIs(t, err, auth.ErrUnauthorized)
+	})
+}
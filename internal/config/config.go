@@ -1,12 +1,15 @@
 package config
 
 import (
+	"crypto"
+	"encoding/hex"
 	"encoding/json"
 	"os"
 	"strconv"
 
 	"github.com/joho/godotenv"
 	"github.com/v2code/b16/internal/logger"
+	"github.com/v2code/b16/internal/security"
 )
 
 type BasicAuth struct {
@@ -14,12 +17,31 @@ type BasicAuth struct {
 }
 
 type TokenAuth struct {
-	Secret []byte
+	Secret     []byte
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+// Account configures the database-backed endpoints: login, refresh,
+// email verification, password reset and two-factor authentication.
+type Account struct {
+	DatabaseDSN  string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPFrom     string
+	SMTPUsername string
+	SMTPPassword string
+	MFAKey       []byte
+	// VerificationSecret keys the HMAC of email verification codes.
+	VerificationSecret []byte
+	PasswordResetURL   string
 }
 
 type Environment struct {
 	TokenAuthEnv *TokenAuth
 	BasicAuthEnv *BasicAuth
+	// AccountEnv is nil when B16_DATABASE_DSN is not set.
+	AccountEnv *Account
 }
 
 func LoadEnvironment() *Environment {
@@ -35,9 +57,13 @@ func LoadEnvironment() *Environment {
 	}
 
 	env.TokenAuthEnv = &TokenAuth{
-		Secret: []byte(os.Getenv("B16_TOKEN_SECRET")),
+		Secret:     []byte(os.Getenv("B16_TOKEN_SECRET")),
+		PrivateKey: LoadTokenPrivateKey(),
+		PublicKey:  LoadTokenPublicKey(),
 	}
 
+	env.AccountEnv = LoadAccount()
+
 	return env
 }
 
@@ -62,3 +88,96 @@ func LoadBasicAuthUsers() map[string]string {
 
 	return users
 }
+
+// LoadPEM reads a PEM document from the environment variable name, or from
+// the file pointed to by name+"_FILE". It returns nil if neither is set.
+func LoadPEM(name string) []byte {
+	if value := os.Getenv(name); value != "" {
+		return []byte(value)
+	}
+
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic("error reading " + name + "_FILE: " + err.Error())
+	}
+
+	return data
+}
+
+func LoadTokenPrivateKey() crypto.PrivateKey {
+	data := LoadPEM("B16_TOKEN_PRIVATE_KEY")
+	if data == nil {
+		return nil
+	}
+
+	key, err := security.ParsePrivateKeyPEM(data)
+	if err != nil {
+		panic("error parsing B16_TOKEN_PRIVATE_KEY: " + err.Error())
+	}
+
+	return key
+}
+
+func LoadTokenPublicKey() crypto.PublicKey {
+	data := LoadPEM("B16_TOKEN_PUBLIC_KEY")
+	if data == nil {
+		return nil
+	}
+
+	key, err := security.ParsePublicKeyPEM(data)
+	if err != nil {
+		panic("error parsing B16_TOKEN_PUBLIC_KEY: " + err.Error())
+	}
+
+	return key
+}
+
+// LoadAccount returns nil when B16_DATABASE_DSN is not set. Otherwise the
+// SMTP settings, B16_PASSWORD_RESET_URL, B16_VERIFICATION_SECRET and
+// B16_MFA_KEY, a hex-encoded AES key, are required.
+func LoadAccount() *Account {
+	dsn := os.Getenv("B16_DATABASE_DSN")
+	if dsn == "" {
+		return nil
+	}
+
+	account := &Account{
+		DatabaseDSN:        dsn,
+		SMTPHost:           os.Getenv("B16_SMTP_HOST"),
+		SMTPPort:           25,
+		SMTPFrom:           os.Getenv("B16_SMTP_FROM"),
+		SMTPUsername:       os.Getenv("B16_SMTP_USERNAME"),
+		SMTPPassword:       os.Getenv("B16_SMTP_PASSWORD"),
+		PasswordResetURL:   os.Getenv("B16_PASSWORD_RESET_URL"),
+		VerificationSecret: []byte(os.Getenv("B16_VERIFICATION_SECRET")),
+	}
+
+	if account.SMTPHost == "" || account.SMTPFrom == "" {
+		panic("B16_SMTP_HOST and B16_SMTP_FROM environment variables are required with B16_DATABASE_DSN")
+	}
+
+	if port := os.Getenv("B16_SMTP_PORT"); port != "" {
+		account.SMTPPort = ParseInt(port)
+	}
+
+	if account.PasswordResetURL == "" {
+		panic("B16_PASSWORD_RESET_URL environment variable is required with B16_DATABASE_DSN")
+	}
+
+	if len(account.VerificationSecret) == 0 {
+		panic("B16_VERIFICATION_SECRET environment variable is required with B16_DATABASE_DSN")
+	}
+
+	key, err := hex.DecodeString(os.Getenv("B16_MFA_KEY"))
+	if err != nil {
+		panic("error parsing B16_MFA_KEY: " + err.Error())
+	}
+	account.MFAKey = key
+
+	return account
+}
@@ -9,34 +9,24 @@ type database struct {
 	db *sql.DB
 }
 
-type databaseTransactionKeyType struct{}
-
-var databaseTransactionKey = databaseTransactionKeyType{}
-
 func NewDatabase(db *sql.DB) Database {
 	return &database{db: db}
 }
 
 func (db *database) Executor(ctx context.Context) QueryExecutor {
-	if tx, ok := ctx.Value(databaseTransactionKey).(*sql.Tx); ok {
-		return tx
+	if t, ok := transactionFromContext(ctx); ok {
+		return t.tx
 	}
 	return db.db
 }
 
-func (db *database) WithTransaction(ctx context.Context, fn TransactionFunc) error {
-	tx, err := db.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-
-	ctx = context.WithValue(ctx, databaseTransactionKey, tx)
-
-	defer tx.Rollback()
-
-	if err := fn(ctx); err != nil {
-		return err
+// WithTransaction runs fn in a transaction. When ctx already carries one, fn
+// runs in a savepoint of it instead and the outermost call keeps ownership of
+// the commit or rollback, and of the options.
+func (db *database) WithTransaction(ctx context.Context, fn TransactionFunc, opts ...TransactionOption) error {
+	if t, ok := transactionFromContext(ctx); ok {
+		return withSavepoint(ctx, t, t.tx, fn)
 	}
 
-	return tx.Commit()
+	return runTransaction(ctx, db.db.BeginTx, fn, opts)
 }
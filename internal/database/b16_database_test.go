@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errTestTransaction = errors.New("test transaction error")
+
+func newTestItemsDatabase(t *testing.T) (Database, *sql.DB) {
+	t.Helper()
+
+	sqlDB := newTestSQLDB(t)
+	_, err := sqlDB.Exec(`CREATE TABLE items (name TEXT PRIMARY KEY)`)
+	require.NoError(t, err)
+
+	return NewDatabase(sqlDB), sqlDB
+}
+
+func insertItem(db Database, name string) TransactionFunc {
+	return func(ctx context.Context) error {
+		_, err := db.Executor(ctx).ExecContext(ctx, `INSERT INTO items (name) VALUES ($1)`, name)
+		return err
+	}
+}
+
+func itemNames(t *testing.T, sqlDB *sql.DB) []string {
+	t.Helper()
+
+	rows, err := sqlDB.Query(`SELECT name FROM items ORDER BY name`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		names = append(names, name)
+	}
+	require.NoError(t, rows.Err())
+	return names
+}
+
+type TestWithTransactionParams struct {
+	Name          string
+	Fn            func(db Database) TransactionFunc
+	ExpectError   bool
+	ExpectedError error
+	ExpectedItems []string
+}
+
+func TestDatabase_WithTransaction_Nested(t *testing.T) {
+	cases := []TestWithTransactionParams{
+		{
+			Name: "nested calls commit with the outermost",
+			Fn: func(db Database) TransactionFunc {
+				return func(ctx context.Context) error {
+					if err := insertItem(db, "a")(ctx); err != nil {
+						return err
+					}
+					return db.WithTransaction(ctx, func(ctx context.Context) error {
+						if err := insertItem(db, "b")(ctx); err != nil {
+							return err
+						}
+						return db.WithTransaction(ctx, insertItem(db, "c"))
+					})
+				}
+			},
+			ExpectedItems: []string{"a", "b", "c"},
+		},
+		{
+			Name: "failed nested call rolls back to its savepoint",
+			Fn: func(db Database) TransactionFunc {
+				return func(ctx context.Context) error {
+					if err := insertItem(db, "a")(ctx); err != nil {
+						return err
+					}
+
+					err := db.WithTransaction(ctx, func(ctx context.Context) error {
+						if err := insertItem(db, "b")(ctx); err != nil {
+							return err
+						}
+						return errTestTransaction
+					})
+					if !errors.Is(err, errTestTransaction) {
+						return err
+					}
+
+					return insertItem(db, "c")(ctx)
+				}
+			},
+			ExpectedItems: []string{"a", "c"},
+		},
+		{
+			Name: "failed outer call rolls back committed savepoints",
+			Fn: func(db Database) TransactionFunc {
+				return func(ctx context.Context) error {
+					if err := db.WithTransaction(ctx, insertItem(db, "a")); err != nil {
+						return err
+					}
+					return errTestTransaction
+				}
+			},
+			ExpectError:   true,
+			ExpectedError: errTestTransaction,
+			ExpectedItems: []string{},
+		},
+		{
+			Name: "nested error propagated to outer call rolls back everything",
+			Fn: func(db Database) TransactionFunc {
+				return func(ctx context.Context) error {
+					if err := insertItem(db, "a")(ctx); err != nil {
+						return err
+					}
+					return db.WithTransaction(ctx, insertItem(db, "a"))
+				}
+			},
+			ExpectError:   true,
+			ExpectedItems: []string{},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			db, sqlDB := newTestItemsDatabase(t)
+
+			err := db.WithTransaction(context.Background(), tt.Fn(db))
+			if tt.ExpectError {
+				require.Error(t, err)
+				if tt.ExpectedError != nil {
+					require.ErrorIs(t, err, tt.ExpectedError)
+				}
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.Equal(t, tt.ExpectedItems, itemNames(t, sqlDB))
+		})
+	}
+}
+
+func TestDatabase_Executor(t *testing.T) {
+	db, sqlDB := newTestItemsDatabase(t)
+	ctx := context.Background()
+
+	require.Equal(t, sqlDB, db.Executor(ctx))
+
+	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+		outer := db.Executor(ctx)
+		require.IsType(t, &sql.Tx{}, outer)
+
+		return db.WithTransaction(ctx, func(ctx context.Context) error {
+			require.Same(t, outer, db.Executor(ctx))
+			return nil
+		})
+	})
+	require.NoError(t, err)
+}
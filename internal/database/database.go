@@ -6,7 +6,7 @@ import (
 
 type Database interface {
 	Executor(ctx context.Context) QueryExecutor
-	WithTransaction(ctx context.Context, fn TransactionFunc) error
+	WithTransaction(ctx context.Context, fn TransactionFunc, opts ...TransactionOption) error
 }
 
 type TransactionFunc func(ctx context.Context) error
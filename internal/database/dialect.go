@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+)
+
+// Dialect captures the SQL differences between the supported databases.
+type Dialect interface {
+	Name() string
+	// Lock takes an exclusive lock that is released when the surrounding
+	// transaction ends, so concurrent migrators wait for each other.
+	Lock(ctx context.Context, executor QueryExecutor, key int64) error
+	// TransactionalDDL reports whether schema changes can be rolled back.
+	TransactionalDDL() bool
+	// SkipLocked returns the clause appended to a SELECT so that concurrent
+	// workers lock different rows, or an empty string when unsupported.
+	SkipLocked() string
+}
+
+type postgresDialect struct{}
+
+var PostgresDialect Dialect = postgresDialect{}
+
+func (postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (postgresDialect) Lock(ctx context.Context, executor QueryExecutor, key int64) error {
+	_, err := executor.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, key)
+	return err
+}
+
+func (postgresDialect) TransactionalDDL() bool {
+	return true
+}
+
+func (postgresDialect) SkipLocked() string {
+	return "FOR UPDATE SKIP LOCKED"
+}
+
+type sqliteDialect struct{}
+
+// SQLiteDialect relies on SQLite's database-wide write lock, which already
+// serializes concurrent migrators.
+var SQLiteDialect Dialect = sqliteDialect{}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) Lock(ctx context.Context, executor QueryExecutor, key int64) error {
+	return nil
+}
+
+func (sqliteDialect) TransactionalDDL() bool {
+	return true
+}
+
+// SkipLocked is empty: SQLite has no row locks and its write lock already
+// keeps a single worker in the critical section.
+func (sqliteDialect) SkipLocked() string {
+	return ""
+}
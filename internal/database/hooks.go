@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type HookFunc func(ctx context.Context) error
+
+// HookError collects the errors returned by commit or rollback hooks. When
+// returned from a committed WithTransaction, the transaction itself
+// succeeded and only the hooks failed.
+type HookError struct {
+	Errors []error
+}
+
+func (e *HookError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("transaction hooks failed: %s", strings.Join(messages, "; "))
+}
+
+func (e *HookError) Unwrap() []error {
+	return e.Errors
+}
+
+type hook struct {
+	fn       HookFunc
+	onCommit bool
+	// undone marks rollback hooks of a savepoint that was rolled back; they
+	// run when the outermost transaction ends, whatever its outcome.
+	undone bool
+}
+
+// OnCommit registers fn to run after the transaction in ctx commits. Hooks
+// registered inside a nested call wait for the outermost transaction and are
+// dropped if their savepoint rolls back. Without a transaction, fn runs
+// immediately and its error is returned.
+func OnCommit(ctx context.Context, fn HookFunc) error {
+	t, ok := transactionFromContext(ctx)
+	if !ok {
+		return fn(ctx)
+	}
+
+	t.hooks = append(t.hooks, hook{fn: fn, onCommit: true})
+	return nil
+}
+
+// OnRollback registers fn to run after the transaction in ctx rolls back,
+// or after the outermost transaction ends when only the savepoint fn was
+// registered in rolls back. Without a transaction it does nothing.
+func OnRollback(ctx context.Context, fn HookFunc) {
+	t, ok := transactionFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	t.hooks = append(t.hooks, hook{fn: fn})
+}
+
+// rollbackHooks drops the commit hooks registered since the given position
+// and keeps the rollback ones to run once the transaction ends.
+func (t *transaction) rollbackHooks(from int) {
+	hooks := t.hooks[:from]
+	for _, h := range t.hooks[from:] {
+		if !h.onCommit {
+			h.undone = true
+			hooks = append(hooks, h)
+		}
+	}
+	t.hooks = hooks
+}
+
+// runHooks runs the hooks matching the outcome of the outermost transaction,
+// in registration order, with a context that no longer carries it.
+func (t *transaction) runHooks(ctx context.Context, committed bool) error {
+	var errs []error
+
+	for _, h := range t.hooks {
+		if h.onCommit != committed && !h.undone {
+			continue
+		}
+		if err := h.fn(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &HookError{Errors: errs}
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type TestTransactionHooksParams struct {
+	Name          string
+	Fn            func(db Database, record func(name string) HookFunc) TransactionFunc
+	ExpectedError error
+	ExpectedCalls []string
+}
+
+func TestDatabase_WithTransaction_Hooks(t *testing.T) {
+	cases := []TestTransactionHooksParams{
+		{
+			Name: "commit runs commit hooks in order",
+			Fn: func(db Database, record func(string) HookFunc) TransactionFunc {
+				return func(ctx context.Context) error {
+					OnCommit(ctx, record("commit-1"))
+					OnRollback(ctx, record("rollback"))
+					OnCommit(ctx, record("commit-2"))
+					return nil
+				}
+			},
+			ExpectedCalls: []string{"commit-1", "commit-2"},
+		},
+		{
+			Name: "rollback runs rollback hooks",
+			Fn: func(db Database, record func(string) HookFunc) TransactionFunc {
+				return func(ctx context.Context) error {
+					OnCommit(ctx, record("commit"))
+					OnRollback(ctx, record("rollback"))
+					return errTestTransaction
+				}
+			},
+			ExpectedError: errTestTransaction,
+			ExpectedCalls: []string{"rollback"},
+		},
+		{
+			Name: "nested hooks wait for the outermost commit",
+			Fn: func(db Database, record func(string) HookFunc) TransactionFunc {
+				return func(ctx context.Context) error {
+					err := db.WithTransaction(ctx, func(ctx context.Context) error {
+						OnCommit(ctx, record("nested-commit"))
+						return nil
+					})
+					if err != nil {
+						return err
+					}
+					OnCommit(ctx, record("outer-commit"))
+					return nil
+				}
+			},
+			ExpectedCalls: []string{"nested-commit", "outer-commit"},
+		},
+		{
+			Name: "nested hooks are dropped when the outermost rolls back",
+			Fn: func(db Database, record func(string) HookFunc) TransactionFunc {
+				return func(ctx context.Context) error {
+					err := db.WithTransaction(ctx, func(ctx context.Context) error {
+						OnCommit(ctx, record("nested-commit"))
+						OnRollback(ctx, record("nested-rollback"))
+						return nil
+					})
+					if err != nil {
+						return err
+					}
+					return errTestTransaction
+				}
+			},
+			ExpectedError: errTestTransaction,
+			ExpectedCalls: []string{"nested-rollback"},
+		},
+		{
+			Name: "rolled back savepoint drops its commit hooks",
+			Fn: func(db Database, record func(string) HookFunc) TransactionFunc {
+				return func(ctx context.Context) error {
+					db.WithTransaction(ctx, func(ctx context.Context) error {
+						OnCommit(ctx, record("nested-commit"))
+						OnRollback(ctx, record("nested-rollback"))
+						return errTestTransaction
+					})
+					OnCommit(ctx, record("outer-commit"))
+					OnRollback(ctx, record("outer-rollback"))
+					return nil
+				}
+			},
+			ExpectedCalls: []string{"nested-rollback", "outer-commit"},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			db, _ := newTestItemsDatabase(t)
+			calls := []string{}
+
+			record := func(name string) HookFunc {
+				return func(ctx context.Context) error {
+					calls = append(calls, name)
+					return nil
+				}
+			}
+
+			err := db.WithTransaction(context.Background(), tt.Fn(db, record))
+			if tt.ExpectedError != nil {
+				require.ErrorIs(t, err, tt.ExpectedError)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.ExpectedCalls, calls)
+		})
+	}
+}
+
+func TestDatabase_WithTransaction_HookErrors(t *testing.T) {
+	db, sqlDB := newTestItemsDatabase(t)
+	errHook := errors.New("hook error")
+	calls := 0
+
+	err := db.WithTransaction(context.Background(), func(ctx context.Context) error {
+		OnCommit(ctx, func(ctx context.Context) error { return errHook })
+		OnCommit(ctx, func(ctx context.Context) error {
+			calls++
+			return nil
+		})
+		return insertItem(db, "a")(ctx)
+	})
+
+	var hookErr *HookError
+	require.ErrorAs(t, err, &hookErr)
+	require.ErrorIs(t, err, errHook)
+	require.Len(t, hookErr.Errors, 1)
+	require.Equal(t, 1, calls)
+	require.Equal(t, []string{"a"}, itemNames(t, sqlDB))
+}
+
+func TestDatabase_WithTransaction_HookContext(t *testing.T) {
+	db, sqlDB := newTestItemsDatabase(t)
+	var names []string
+
+	err := db.WithTransaction(context.Background(), func(ctx context.Context) error {
+		OnCommit(ctx, func(ctx context.Context) error {
+			require.Equal(t, sqlDB, db.Executor(ctx))
+			names = itemNames(t, sqlDB)
+			return nil
+		})
+		return insertItem(db, "a")(ctx)
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, names)
+}
+
+func TestOnCommit_WithoutTransaction(t *testing.T) {
+	ctx := context.Background()
+	called := false
+
+	err := OnCommit(ctx, func(ctx context.Context) error {
+		called = true
+		return errTestTransaction
+	})
+
+	require.ErrorIs(t, err, errTestTransaction)
+	require.True(t, called)
+
+	OnRollback(ctx, func(ctx context.Context) error {
+		t.Fatal("rollback hook must not run without a transaction")
+		return nil
+	})
+}
@@ -0,0 +1,255 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/v2code/b16/internal/logger"
+)
+
+var DefaultQueryBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// QueryEvent describes one statement run through an instrumented executor.
+// Rows is the number of affected rows for ExecContext and -1 when unknown.
+type QueryEvent struct {
+	Query       string
+	Fingerprint string
+	Args        []any
+	Duration    time.Duration
+	Rows        int64
+	Err         error
+	Slow        bool
+}
+
+// QueryStats aggregates the events of a fingerprint. Buckets[i] counts the
+// queries that took at most Instrumentation's i-th bucket; the last entry
+// counts the ones slower than every bucket.
+type QueryStats struct {
+	Count         uint64
+	Errors        uint64
+	SlowCount     uint64
+	TotalDuration time.Duration
+	Buckets       []uint64
+}
+
+type InstrumentationParams struct {
+	// SlowQueryThreshold logs queries taking longer as warnings; zero
+	// disables it.
+	SlowQueryThreshold time.Duration
+	// Redact maps the query arguments before they are logged or handed to
+	// OnQuery. RedactArgs is used when nil.
+	Redact  func(args []any) []any
+	Buckets []time.Duration
+	// OnQuery, when set, receives every event, e.g. to feed an external
+	// metrics system.
+	OnQuery func(event QueryEvent)
+}
+
+// Instrumentation logs statements through the logger package and keeps
+// per-fingerprint stats. One Instrumentation is shared by every executor it
+// wraps.
+type Instrumentation struct {
+	slowQueryThreshold time.Duration
+	redact             func(args []any) []any
+	buckets            []time.Duration
+	onQuery            func(event QueryEvent)
+
+	mu    sync.Mutex
+	stats map[string]*QueryStats
+	now   func() time.Time
+}
+
+func NewInstrumentation(params InstrumentationParams) *Instrumentation {
+	i := &Instrumentation{
+		slowQueryThreshold: params.SlowQueryThreshold,
+		redact:             params.Redact,
+		buckets:            params.Buckets,
+		onQuery:            params.OnQuery,
+		stats:              map[string]*QueryStats{},
+		now:                time.Now,
+	}
+
+	if i.redact == nil {
+		i.redact = RedactArgs
+	}
+	if i.buckets == nil {
+		i.buckets = DefaultQueryBuckets
+	}
+
+	return i
+}
+
+// RedactArgs replaces every argument, keeping only how many were passed.
+func RedactArgs(args []any) []any {
+	redacted := make([]any, len(args))
+	for i := range args {
+		redacted[i] = "[REDACTED]"
+	}
+	return redacted
+}
+
+var (
+	fingerprintStrings      = regexp.MustCompile(`'(?:[^']|'')*'`)
+	fingerprintNumbers      = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	fingerprintPlaceholders = regexp.MustCompile(`\$\d+|\?`)
+	fingerprintLists        = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	fingerprintSpaces       = regexp.MustCompile(`\s+`)
+)
+
+// Fingerprint normalizes query so that statements differing only in literal
+// values, placeholder numbering, IN list length or whitespace share stats.
+func Fingerprint(query string) string {
+	query = fingerprintStrings.ReplaceAllString(query, "?")
+	query = fingerprintPlaceholders.ReplaceAllString(query, "?")
+	query = fingerprintNumbers.ReplaceAllString(query, "?")
+	query = fingerprintLists.ReplaceAllString(query, "(?)")
+	query = fingerprintSpaces.ReplaceAllString(query, " ")
+	return strings.TrimSpace(query)
+}
+
+// Stats returns a snapshot of the stats of every fingerprint seen so far.
+func (i *Instrumentation) Stats() map[string]QueryStats {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	stats := make(map[string]QueryStats, len(i.stats))
+	for fingerprint, s := range i.stats {
+		snapshot := *s
+		snapshot.Buckets = slices.Clone(s.Buckets)
+		stats[fingerprint] = snapshot
+	}
+	return stats
+}
+
+func (i *Instrumentation) record(query string, args []any, start time.Time, rows int64, err error) {
+	event := QueryEvent{
+		Query:       query,
+		Fingerprint: Fingerprint(query),
+		Args:        i.redact(args),
+		Duration:    i.now().Sub(start),
+		Rows:        rows,
+		Err:         err,
+	}
+	event.Slow = i.slowQueryThreshold > 0 && event.Duration > i.slowQueryThreshold
+
+	i.mu.Lock()
+	stats, ok := i.stats[event.Fingerprint]
+	if !ok {
+		stats = &QueryStats{Buckets: make([]uint64, len(i.buckets)+1)}
+		i.stats[event.Fingerprint] = stats
+	}
+
+	stats.Count++
+	stats.TotalDuration += event.Duration
+	if err != nil {
+		stats.Errors++
+	}
+	if event.Slow {
+		stats.SlowCount++
+	}
+
+	bucket, _ := slices.BinarySearch(i.buckets, event.Duration)
+	stats.Buckets[bucket]++
+	i.mu.Unlock()
+
+	switch {
+	case err != nil:
+		logger.Error(LOG_DATABASE_PREFIX, "Query failed", query, "duration", event.Duration, "args", event.Args, "error", err.Error())
+	case event.Slow:
+		logger.Warn(LOG_DATABASE_PREFIX, "Slow query", query, "duration", event.Duration, "rows", rows, "args", event.Args)
+	default:
+		logger.Debug(LOG_DATABASE_PREFIX, "Query executed", query, "duration", event.Duration, "rows", rows, "args", event.Args)
+	}
+
+	if i.onQuery != nil {
+		i.onQuery(event)
+	}
+}
+
+type instrumentedExecutor struct {
+	executor        QueryExecutor
+	instrumentation *Instrumentation
+}
+
+// NewInstrumentedExecutor wraps executor so that every statement is
+// recorded by instrumentation. Rows returned by QueryContext and
+// QueryRowContext are not counted, as they are read after the call returns.
+func NewInstrumentedExecutor(executor QueryExecutor, instrumentation *Instrumentation) QueryExecutor {
+	return &instrumentedExecutor{
+		executor:        executor,
+		instrumentation: instrumentation,
+	}
+}
+
+func (e *instrumentedExecutor) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := e.instrumentation.now()
+	result, err := e.executor.ExecContext(ctx, query, args...)
+
+	rows := int64(-1)
+	if err == nil {
+		if affected, affectedErr := result.RowsAffected(); affectedErr == nil {
+			rows = affected
+		}
+	}
+
+	e.instrumentation.record(query, args, start, rows, err)
+	return result, err
+}
+
+func (e *instrumentedExecutor) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	start := e.instrumentation.now()
+	row := e.executor.QueryRowContext(ctx, query, args...)
+
+	e.instrumentation.record(query, args, start, -1, row.Err())
+	return row
+}
+
+func (e *instrumentedExecutor) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	start := e.instrumentation.now()
+	rows, err := e.executor.QueryContext(ctx, query, args...)
+
+	e.instrumentation.record(query, args, start, -1, err)
+	return rows, err
+}
+
+type instrumentedDatabase struct {
+	db              Database
+	instrumentation *Instrumentation
+}
+
+// NewInstrumentedDatabase wraps db so that Executor returns instrumented
+// executors, whether ctx carries a transaction or not.
+func NewInstrumentedDatabase(db Database, instrumentation *Instrumentation) Database {
+	return &instrumentedDatabase{
+		db:              db,
+		instrumentation: instrumentation,
+	}
+}
+
+func (db *instrumentedDatabase) Executor(ctx context.Context) QueryExecutor {
+	return NewInstrumentedExecutor(db.db.Executor(ctx), db.instrumentation)
+}
+
+// WithTransaction runs nested calls' savepoint statements through an
+// instrumented executor, so they are recorded like any other statement.
+func (db *instrumentedDatabase) WithTransaction(ctx context.Context, fn TransactionFunc, opts ...TransactionOption) error {
+	if t, ok := transactionFromContext(ctx); ok {
+		return withSavepoint(ctx, t, db.Executor(ctx), fn)
+	}
+
+	return db.db.WithTransaction(ctx, fn, opts...)
+}
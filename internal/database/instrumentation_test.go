@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type TestFingerprintParams struct {
+	Name     string
+	Query    string
+	Expected string
+}
+
+func TestFingerprint(t *testing.T) {
+	cases := []TestFingerprintParams{
+		{
+			Name:     "placeholders",
+			Query:    "SELECT id FROM users WHERE email = $1 AND id = $2",
+			Expected: "SELECT id FROM users WHERE email = ? AND id = ?",
+		},
+		{
+			Name:     "literals",
+			Query:    "SELECT id FROM users WHERE email = 'a''b@email.com' LIMIT 10",
+			Expected: "SELECT id FROM users WHERE email = ? LIMIT ?",
+		},
+		{
+			Name:     "in list",
+			Query:    "DELETE FROM roles WHERE id IN ($1, $2,  $3)",
+			Expected: "DELETE FROM roles WHERE id IN (?)",
+		},
+		{
+			Name:     "whitespace and identifiers with digits",
+			Query:    "SELECT a1\n\t FROM table2   WHERE b = ?",
+			Expected: "SELECT a1 FROM table2 WHERE b = ?",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			require.Equal(t, tt.Expected, Fingerprint(tt.Query))
+		})
+	}
+}
+
+func TestInstrumentedDatabase(t *testing.T) {
+	db, _ := newTestItemsDatabase(t)
+	ctx := context.Background()
+
+	var events []QueryEvent
+	instrumentation := NewInstrumentation(InstrumentationParams{
+		SlowQueryThreshold: 100 * time.Millisecond,
+		Buckets:            []time.Duration{10 * time.Millisecond, 100 * time.Millisecond},
+		OnQuery: func(event QueryEvent) {
+			events = append(events, event)
+		},
+	})
+
+	durations := []time.Duration{5 * time.Millisecond, 50 * time.Millisecond, 200 * time.Millisecond, time.Millisecond}
+	clock := time.Now()
+	calls := 0
+	instrumentation.now = func() time.Time {
+		if calls%2 == 1 {
+			clock = clock.Add(durations[calls/2%len(durations)])
+		}
+		calls++
+		return clock
+	}
+
+	instrumented := NewInstrumentedDatabase(db, instrumentation)
+	insert := `INSERT INTO items (name) VALUES ($1)`
+
+	_, err := instrumented.Executor(ctx).ExecContext(ctx, insert, "a")
+	require.NoError(t, err)
+
+	err = instrumented.WithTransaction(ctx, func(ctx context.Context) error {
+		executor := instrumented.Executor(ctx)
+
+		if _, err := executor.ExecContext(ctx, insert, "b"); err != nil {
+			return err
+		}
+
+		var count int
+		return executor.QueryRowContext(ctx, `SELECT COUNT(*) FROM items`).Scan(&count)
+	})
+	require.NoError(t, err)
+
+	_, err = instrumented.Executor(ctx).ExecContext(ctx, insert, "a")
+	require.Error(t, err)
+
+	require.Len(t, events, 4)
+	require.Equal(t, []any{"[REDACTED]"}, events[0].Args)
+	require.Equal(t, int64(1), events[0].Rows)
+	require.False(t, events[1].Slow)
+	require.True(t, events[2].Slow)
+	require.Equal(t, int64(-1), events[2].Rows)
+	require.Error(t, events[3].Err)
+
+	stats := instrumentation.Stats()
+	require.Len(t, stats, 2)
+
+	insertStats := stats["INSERT INTO items (name) VALUES (?)"]
+	require.Equal(t, uint64(3), insertStats.Count)
+	require.Equal(t, uint64(1), insertStats.Errors)
+	require.Equal(t, uint64(0), insertStats.SlowCount)
+	require.Equal(t, 56*time.Millisecond, insertStats.TotalDuration)
+	require.Equal(t, []uint64{2, 1, 0}, insertStats.Buckets)
+
+	selectStats := stats["SELECT COUNT(*) FROM items"]
+	require.Equal(t, uint64(1), selectStats.Count)
+	require.Equal(t, uint64(1), selectStats.SlowCount)
+	require.Equal(t, []uint64{0, 0, 1}, selectStats.Buckets)
+}
+
+func TestInstrumentation_Redact(t *testing.T) {
+	db, _ := newTestItemsDatabase(t)
+	ctx := context.Background()
+
+	var args []any
+	instrumentation := NewInstrumentation(InstrumentationParams{
+		Redact: func(args []any) []any { return args },
+		OnQuery: func(event QueryEvent) {
+			args = event.Args
+		},
+	})
+
+	executor := NewInstrumentedExecutor(db.Executor(ctx), instrumentation)
+	_, err := executor.ExecContext(ctx, `INSERT INTO items (name) VALUES ($1)`, "a")
+	require.NoError(t, err)
+	require.Equal(t, []any{"a"}, args)
+}
+
+func TestInstrumentedDatabase_Savepoints(t *testing.T) {
+	db, _ := newTestItemsDatabase(t)
+	ctx := context.Background()
+
+	var queries []string
+	instrumentation := NewInstrumentation(InstrumentationParams{
+		OnQuery: func(event QueryEvent) {
+			queries = append(queries, event.Query)
+		},
+	})
+
+	instrumented := NewInstrumentedDatabase(db, instrumentation)
+	insert := `INSERT INTO items (name) VALUES ($1)`
+
+	err := instrumented.WithTransaction(ctx, func(ctx context.Context) error {
+		err := instrumented.WithTransaction(ctx, func(ctx context.Context) error {
+			_, err := instrumented.Executor(ctx).ExecContext(ctx, insert, "a")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		return instrumented.WithTransaction(ctx, func(ctx context.Context) error {
+			return errors.New("rollback")
+		})
+	})
+	require.Error(t, err)
+
+	require.Equal(t, []string{
+		"SAVEPOINT b16_savepoint_1",
+		insert,
+		"RELEASE SAVEPOINT b16_savepoint_1",
+		"SAVEPOINT b16_savepoint_2",
+		"ROLLBACK TO SAVEPOINT b16_savepoint_2",
+		"RELEASE SAVEPOINT b16_savepoint_2",
+	}, queries)
+}
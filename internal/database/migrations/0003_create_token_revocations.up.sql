@@ -0,0 +1,10 @@
+CREATE TABLE revoked_tokens (
+    id TEXT PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE revoked_subjects (
+    subject TEXT PRIMARY KEY,
+    revoked_before TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,12 @@
+CREATE TABLE email_outbox (
+    id TEXT PRIMARY KEY,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX email_outbox_pending_idx ON email_outbox (status, next_attempt_at);
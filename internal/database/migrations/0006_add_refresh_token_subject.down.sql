@@ -0,0 +1,3 @@
+DROP INDEX refresh_tokens_subject_idx;
+
+ALTER TABLE refresh_tokens DROP COLUMN subject;
@@ -0,0 +1,5 @@
+-- Tokens issued before this migration keep an empty subject, so
+-- RevokeSubject does not reach them; they still expire normally.
+ALTER TABLE refresh_tokens ADD COLUMN subject TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX refresh_tokens_subject_idx ON refresh_tokens (subject);
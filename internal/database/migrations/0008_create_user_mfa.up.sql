@@ -0,0 +1,14 @@
+CREATE TABLE user_mfa (
+    user_id TEXT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    confirmed_at TIMESTAMP
+);
+
+CREATE TABLE mfa_recovery_codes (
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP,
+    PRIMARY KEY (user_id, code_hash)
+);
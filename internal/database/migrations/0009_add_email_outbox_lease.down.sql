@@ -0,0 +1,3 @@
+UPDATE email_outbox SET status = 'pending' WHERE status = 'sending';
+
+ALTER TABLE email_outbox DROP COLUMN lease_id;
@@ -0,0 +1,3 @@
+-- lease_id identifies the relay batch that claimed a message; outcomes are
+-- only recorded while it still matches.
+ALTER TABLE email_outbox ADD COLUMN lease_id TEXT;
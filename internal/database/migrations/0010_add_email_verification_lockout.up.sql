@@ -0,0 +1,3 @@
+-- attempts now counts wrong codes per user across resends; reaching the
+-- limit locks verification until locked_until.
+ALTER TABLE email_verifications ADD COLUMN locked_until TIMESTAMP;
@@ -0,0 +1,8 @@
+-- Encrypted secrets cannot be restored in SQL, so the second factors that
+-- only have one are removed and must be enrolled again.
+DELETE FROM mfa_recovery_codes WHERE user_id IN (SELECT user_id FROM user_mfa WHERE encrypted_secret IS NOT NULL);
+DELETE FROM user_mfa WHERE encrypted_secret IS NOT NULL;
+
+ALTER TABLE user_mfa DROP COLUMN locked_until;
+ALTER TABLE user_mfa DROP COLUMN failed_attempts;
+ALTER TABLE user_mfa DROP COLUMN encrypted_secret;
@@ -0,0 +1,7 @@
+-- New secrets are stored encrypted in encrypted_secret and leave secret
+-- empty. Rows enrolled before this migration keep their plaintext secret
+-- until account.TwoFactor encrypts it, on first use or through
+-- EncryptSecrets.
+ALTER TABLE user_mfa ADD COLUMN encrypted_secret TEXT;
+ALTER TABLE user_mfa ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_mfa ADD COLUMN locked_until TIMESTAMP;
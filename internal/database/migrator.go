@@ -0,0 +1,342 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var Migrations embed.FS
+
+var (
+	ErrInvalidMigration     = errors.New("invalid migration")
+	ErrChecksumMismatch     = errors.New("migration checksum mismatch")
+	ErrUnknownMigration     = errors.New("migration not found")
+	ErrMissingDownMigration = errors.New("down migration not found")
+)
+
+// migrationLockKey identifies the advisory lock shared by every migrator.
+const migrationLockKey int64 = 0x6231365f6d6967
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type appliedMigration struct {
+	version   int64
+	checksum  string
+	appliedAt time.Time
+}
+
+// Migrator applies versioned SQL files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql, recording them in schema_migrations. Each step
+// runs in its own Database.WithTransaction (when the dialect supports
+// transactional DDL) after taking the dialect lock and re-reading the applied
+// versions, so instances starting together apply every migration once.
+type Migrator struct {
+	db         Database
+	dialect    Dialect
+	migrations []Migration
+}
+
+func NewMigrator(db Database, dialect Dialect, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+// LoadMigrations reads every migration file found in the root of fsys, or in
+// its migrations directory when present.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	if sub, err := fs.Sub(fsys, "migrations"); err == nil {
+		if _, err := fs.Stat(sub, "."); err == nil {
+			fsys = sub
+		}
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("%w: version %d has two names", ErrInvalidMigration, version)
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+			sum := sha256.Sum256(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("%w: version %d has no up file", ErrInvalidMigration, migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return migrations, nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+	return m.To(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down reverts the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.step(ctx, func(applied []appliedMigration) (*Migration, bool, error) {
+		if len(applied) == 0 {
+			return nil, false, nil
+		}
+		migration, err := m.find(applied[len(applied)-1].version)
+		return migration, false, err
+	})
+}
+
+// To migrates up or down until version is the last applied migration.
+// Version 0 reverts everything.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version != 0 {
+		if _, err := m.find(version); err != nil {
+			return err
+		}
+	}
+
+	for {
+		done := false
+
+		err := m.step(ctx, func(applied []appliedMigration) (*Migration, bool, error) {
+			if len(applied) > 0 && applied[len(applied)-1].version > version {
+				migration, err := m.find(applied[len(applied)-1].version)
+				return migration, false, err
+			}
+
+			for i := range m.migrations {
+				migration := &m.migrations[i]
+				if migration.Version > version {
+					break
+				}
+				if !slices.ContainsFunc(applied, func(a appliedMigration) bool { return a.version == migration.Version }) {
+					return migration, true, nil
+				}
+			}
+
+			done = true
+			return nil, false, nil
+		})
+
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+
+	err := m.run(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		statuses = make([]MigrationStatus, 0, len(m.migrations))
+		for _, migration := range m.migrations {
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+
+			for _, a := range applied {
+				if a.version == migration.Version {
+					status.Applied = true
+					status.AppliedAt = a.appliedAt
+				}
+			}
+
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// step locks, verifies the applied migrations and runs the single migration
+// chosen by next, in the given direction. A nil migration means nothing to do.
+func (m *Migrator) step(ctx context.Context, next func(applied []appliedMigration) (*Migration, bool, error)) error {
+	return m.run(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		migration, up, err := next(applied)
+		if err != nil || migration == nil {
+			return err
+		}
+
+		executor := m.db.Executor(ctx)
+
+		if up {
+			if _, err := executor.ExecContext(ctx, migration.Up); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+
+			_, err := executor.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)`,
+				migration.Version, migration.Name, migration.Checksum, time.Now().UTC(),
+			)
+			return err
+		}
+
+		if migration.Down == "" {
+			return fmt.Errorf("%w: version %d", ErrMissingDownMigration, migration.Version)
+		}
+
+		if _, err := executor.ExecContext(ctx, migration.Down); err != nil {
+			return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+		}
+
+		_, err = executor.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		return err
+	})
+}
+
+// run executes fn holding the migration lock with schema_migrations in place.
+func (m *Migrator) run(ctx context.Context, fn TransactionFunc) error {
+	locked := func(ctx context.Context) error {
+		executor := m.db.Executor(ctx)
+
+		if err := m.dialect.Lock(ctx, executor, migrationLockKey); err != nil {
+			return err
+		}
+
+		_, err := executor.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+
+		return fn(ctx)
+	}
+
+	if !m.dialect.TransactionalDDL() {
+		return locked(ctx)
+	}
+
+	return m.db.WithTransaction(ctx, locked)
+}
+
+// applied returns the applied migrations in version order, after checking
+// that each one still matches its file.
+func (m *Migrator) applied(ctx context.Context) ([]appliedMigration, error) {
+	rows, err := m.db.Executor(ctx).QueryContext(ctx,
+		`SELECT version, checksum, applied_at FROM schema_migrations ORDER BY version`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []appliedMigration
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied = append(applied, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, a := range applied {
+		migration, err := m.find(a.version)
+		if err != nil {
+			return nil, err
+		}
+		if migration.Checksum != a.checksum {
+			return nil, fmt.Errorf("%w: version %d", ErrChecksumMismatch, a.version)
+		}
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) find(version int64) (*Migration, error) {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: version %d", ErrUnknownMigration, version)
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func newTestSQLDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", "file::memory:?_time_format=sqlite")
+	require.NoError(t, err)
+
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"migrations/0001_create_a.up.sql":   {Data: []byte(`CREATE TABLE a (id INTEGER PRIMARY KEY);`)},
+		"migrations/0001_create_a.down.sql": {Data: []byte(`DROP TABLE a;`)},
+		"migrations/0002_create_b.up.sql":   {Data: []byte(`CREATE TABLE b (id INTEGER PRIMARY KEY);`)},
+		"migrations/0002_create_b.down.sql": {Data: []byte(`DROP TABLE b;`)},
+		"migrations/0003_create_c.up.sql":   {Data: []byte(`CREATE TABLE c (id INTEGER PRIMARY KEY);`)},
+		"migrations/README.md":              {Data: []byte(`ignored`)},
+	}
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = $1`, name).Scan(&count)
+	require.NoError(t, err)
+	return count == 1
+}
+
+func appliedVersions(t *testing.T, migrator *Migrator) []int64 {
+	t.Helper()
+
+	statuses, err := migrator.Status(context.Background())
+	require.NoError(t, err)
+
+	versions := []int64{}
+	for _, status := range statuses {
+		if status.Applied {
+			versions = append(versions, status.Version)
+		}
+	}
+	return versions
+}
+
+func TestMigrator_UpDownTo(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := newTestSQLDB(t)
+
+	migrator, err := NewMigrator(NewDatabase(sqlDB), SQLiteDialect, testMigrations())
+	require.NoError(t, err)
+
+	require.NoError(t, migrator.Up(ctx))
+	require.Equal(t, []int64{1, 2, 3}, appliedVersions(t, migrator))
+	require.True(t, tableExists(t, sqlDB, "c"))
+
+	require.NoError(t, migrator.Up(ctx))
+
+	require.ErrorIs(t, migrator.Down(ctx), ErrMissingDownMigration)
+	require.True(t, tableExists(t, sqlDB, "c"))
+
+	require.ErrorIs(t, migrator.To(ctx, 1), ErrMissingDownMigration)
+
+	sqlDB.Exec(`DELETE FROM schema_migrations WHERE version = 3`)
+	sqlDB.Exec(`DROP TABLE c`)
+
+	require.NoError(t, migrator.To(ctx, 1))
+	require.Equal(t, []int64{1}, appliedVersions(t, migrator))
+	require.False(t, tableExists(t, sqlDB, "b"))
+
+	require.NoError(t, migrator.To(ctx, 2))
+	require.Equal(t, []int64{1, 2}, appliedVersions(t, migrator))
+
+	require.NoError(t, migrator.Down(ctx))
+	require.Equal(t, []int64{1}, appliedVersions(t, migrator))
+
+	require.NoError(t, migrator.To(ctx, 0))
+	require.Empty(t, appliedVersions(t, migrator))
+	require.False(t, tableExists(t, sqlDB, "a"))
+
+	require.ErrorIs(t, migrator.To(ctx, 42), ErrUnknownMigration)
+}
+
+func TestMigrator_ChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := newTestSQLDB(t)
+
+	migrator, err := NewMigrator(NewDatabase(sqlDB), SQLiteDialect, testMigrations())
+	require.NoError(t, err)
+	require.NoError(t, migrator.To(ctx, 1))
+
+	changed := testMigrations()
+	changed["migrations/0001_create_a.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE a (id TEXT);`)}
+
+	migrator, err = NewMigrator(NewDatabase(sqlDB), SQLiteDialect, changed)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, migrator.Up(ctx), ErrChecksumMismatch)
+	require.False(t, tableExists(t, sqlDB, "b"))
+}
+
+func TestMigrator_FailedMigrationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := newTestSQLDB(t)
+
+	broken := testMigrations()
+	broken["migrations/0002_create_b.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE b (id INTEGER); INSERT INTO missing VALUES (1);`)}
+
+	migrator, err := NewMigrator(NewDatabase(sqlDB), SQLiteDialect, broken)
+	require.NoError(t, err)
+
+	require.Error(t, migrator.Up(ctx))
+	require.Equal(t, []int64{1}, appliedVersions(t, migrator))
+	require.False(t, tableExists(t, sqlDB, "b"))
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	_, err := LoadMigrations(fstest.MapFS{
+		"0001_create_a.down.sql": {Data: []byte(`DROP TABLE a;`)},
+	})
+	require.ErrorIs(t, err, ErrInvalidMigration)
+}
+
+func TestMigrations_Embedded(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := newTestSQLDB(t)
+
+	migrator, err := NewMigrator(NewDatabase(sqlDB), SQLiteDialect, Migrations)
+	require.NoError(t, err)
+
+	require.NoError(t, migrator.Up(ctx))
+	require.True(t, tableExists(t, sqlDB, "users"))
+
+	require.NoError(t, migrator.To(ctx, 0))
+	require.False(t, tableExists(t, sqlDB, "users"))
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/v2code/b16/internal/logger"
+)
+
+const LOG_DATABASE_PREFIX = "DATABASE"
+
+type readOnlyKeyType struct{}
+
+var readOnlyKey = readOnlyKeyType{}
+
+// ReadOnly marks ctx as only reading, allowing a ReplicatedDatabase to serve
+// it from a replica. Reads that must see the caller's own writes should keep
+// an unmarked context.
+func ReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey, true)
+}
+
+func IsReadOnly(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyKey).(bool)
+	return readOnly
+}
+
+type ReplicaSelection int
+
+const (
+	RoundRobin ReplicaSelection = iota
+	// LeastConnections picks the healthy replica with the fewest connections
+	// in use.
+	LeastConnections
+)
+
+type ReplicatedDatabaseParams struct {
+	Primary   *sql.DB
+	Replicas  []*sql.DB
+	Selection ReplicaSelection
+	// HealthCheckInterval enables pinging the replicas in the background;
+	// zero disables it and CheckReplicas must be called explicitly.
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+}
+
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// ReplicatedDatabase sends transactions and unmarked contexts to the primary
+// and ReadOnly contexts to a healthy replica, falling back to the primary
+// when none is available.
+type ReplicatedDatabase struct {
+	primary   *sql.DB
+	replicas  []*replica
+	selection ReplicaSelection
+	timeout   time.Duration
+	next      atomic.Uint64
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewReplicatedDatabase(params ReplicatedDatabaseParams) *ReplicatedDatabase {
+	db := &ReplicatedDatabase{
+		primary:   params.Primary,
+		selection: params.Selection,
+		timeout:   params.HealthCheckTimeout,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	if db.timeout <= 0 {
+		db.timeout = 5 * time.Second
+	}
+
+	for _, replicaDB := range params.Replicas {
+		r := &replica{db: replicaDB}
+		r.healthy.Store(true)
+		db.replicas = append(db.replicas, r)
+	}
+
+	if params.HealthCheckInterval > 0 && len(db.replicas) > 0 {
+		go db.healthCheckLoop(params.HealthCheckInterval)
+	} else {
+		close(db.done)
+	}
+
+	return db
+}
+
+func (db *ReplicatedDatabase) Executor(ctx context.Context) QueryExecutor {
+	if t, ok := transactionFromContext(ctx); ok {
+		return t.tx
+	}
+	if IsReadOnly(ctx) {
+		return db.Replica()
+	}
+	return db.primary
+}
+
+// WithTransaction always runs on the primary, even for ReadOnly contexts.
+func (db *ReplicatedDatabase) WithTransaction(ctx context.Context, fn TransactionFunc, opts ...TransactionOption) error {
+	if t, ok := transactionFromContext(ctx); ok {
+		return withSavepoint(ctx, t, t.tx, fn)
+	}
+
+	return runTransaction(ctx, db.primary.BeginTx, fn, opts)
+}
+
+// Replica returns a healthy replica chosen by the selection strategy, or the
+// primary when every replica is out of rotation.
+func (db *ReplicatedDatabase) Replica() *sql.DB {
+	healthy := make([]*sql.DB, 0, len(db.replicas))
+	for _, r := range db.replicas {
+		if r.healthy.Load() {
+			healthy = append(healthy, r.db)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return db.primary
+	}
+
+	if db.selection == LeastConnections {
+		selected := healthy[0]
+		for _, replicaDB := range healthy[1:] {
+			if replicaDB.Stats().InUse < selected.Stats().InUse {
+				selected = replicaDB
+			}
+		}
+		return selected
+	}
+
+	return healthy[(db.next.Add(1)-1)%uint64(len(healthy))]
+}
+
+// CheckReplicas pings every replica, taking failing ones out of rotation
+// and returning recovered ones to it.
+func (db *ReplicatedDatabase) CheckReplicas(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for i, r := range db.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			pingCtx, cancel := context.WithTimeout(ctx, db.timeout)
+			defer cancel()
+
+			err := r.db.PingContext(pingCtx)
+			healthy := err == nil
+
+			if r.healthy.Swap(healthy) != healthy {
+				if healthy {
+					logger.Info(LOG_DATABASE_PREFIX, "Replica back in rotation", i)
+				} else {
+					logger.Warn(LOG_DATABASE_PREFIX, "Replica removed from rotation", i, "error", err.Error())
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Close stops the background health checks. The primary and replica pools
+// are left open for their owner to close.
+func (db *ReplicatedDatabase) Close() {
+	db.closeOnce.Do(func() {
+		close(db.stop)
+	})
+	<-db.done
+}
+
+func (db *ReplicatedDatabase) healthCheckLoop(interval time.Duration) {
+	defer close(db.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-db.stop
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-db.stop:
+			return
+		case <-ticker.C:
+			db.CheckReplicas(ctx)
+		}
+	}
+}
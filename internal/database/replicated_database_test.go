@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestNamedDB(t *testing.T, name string) *sql.DB {
+	t.Helper()
+
+	db := newTestSQLDB(t)
+	_, err := db.Exec(`CREATE TABLE node (name TEXT NOT NULL)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO node (name) VALUES ($1)`, name)
+	require.NoError(t, err)
+
+	return db
+}
+
+func nodeName(t *testing.T, executor QueryExecutor) string {
+	t.Helper()
+
+	var name string
+	require.NoError(t, executor.QueryRowContext(context.Background(), `SELECT name FROM node`).Scan(&name))
+	return name
+}
+
+func newTestReplicatedDatabase(t *testing.T, selection ReplicaSelection) (*ReplicatedDatabase, []*sql.DB) {
+	t.Helper()
+
+	replicas := []*sql.DB{newTestNamedDB(t, "replica-1"), newTestNamedDB(t, "replica-2")}
+
+	db := NewReplicatedDatabase(ReplicatedDatabaseParams{
+		Primary:   newTestNamedDB(t, "primary"),
+		Replicas:  replicas,
+		Selection: selection,
+	})
+	t.Cleanup(db.Close)
+
+	return db, replicas
+}
+
+func TestReplicatedDatabase_Executor(t *testing.T) {
+	db, _ := newTestReplicatedDatabase(t, RoundRobin)
+	ctx := context.Background()
+	readOnly := ReadOnly(ctx)
+
+	require.Equal(t, "primary", nodeName(t, db.Executor(ctx)))
+	require.Equal(t, "replica-1", nodeName(t, db.Executor(readOnly)))
+	require.Equal(t, "replica-2", nodeName(t, db.Executor(readOnly)))
+	require.Equal(t, "replica-1", nodeName(t, db.Executor(readOnly)))
+
+	err := db.WithTransaction(readOnly, func(ctx context.Context) error {
+		require.IsType(t, &sql.Tx{}, db.Executor(ctx))
+		require.Equal(t, "primary", nodeName(t, db.Executor(ctx)))
+
+		return db.WithTransaction(ctx, func(ctx context.Context) error {
+			require.Equal(t, "primary", nodeName(t, db.Executor(ctx)))
+			return nil
+		})
+	})
+	require.NoError(t, err)
+}
+
+func TestReplicatedDatabase_LeastConnections(t *testing.T) {
+	db, replicas := newTestReplicatedDatabase(t, LeastConnections)
+
+	rows, err := replicas[0].Query(`SELECT name FROM node`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	require.Equal(t, replicas[1], db.Replica())
+	require.Equal(t, replicas[1], db.Replica())
+}
+
+func TestReplicatedDatabase_CheckReplicas(t *testing.T) {
+	db, replicas := newTestReplicatedDatabase(t, RoundRobin)
+	ctx := context.Background()
+
+	require.NoError(t, replicas[0].Close())
+	db.CheckReplicas(ctx)
+
+	for range 3 {
+		require.Equal(t, "replica-2", nodeName(t, db.Executor(ReadOnly(ctx))))
+	}
+
+	require.NoError(t, replicas[1].Close())
+	db.CheckReplicas(ctx)
+
+	require.Equal(t, "primary", nodeName(t, db.Executor(ReadOnly(ctx))))
+}
+
+func TestReplicatedDatabase_HealthCheckLoop(t *testing.T) {
+	replica := newTestNamedDB(t, "replica-1")
+
+	db := NewReplicatedDatabase(ReplicatedDatabaseParams{
+		Primary:             newTestNamedDB(t, "primary"),
+		Replicas:            []*sql.DB{replica},
+		HealthCheckInterval: time.Millisecond,
+	})
+
+	require.NoError(t, replica.Close())
+
+	require.Eventually(t, func() bool {
+		return db.Replica() != replica
+	}, time.Second, time.Millisecond)
+
+	db.Close()
+	db.Close()
+}
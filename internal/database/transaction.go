@@ -0,0 +1,235 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// transaction is the state carried by the context of a WithTransaction call.
+// Nested calls share the same *sql.Tx and only add a savepoint, so the
+// outermost call alone commits or rolls back and runs the hooks.
+type transaction struct {
+	tx         *sql.Tx
+	savepoints int
+	hooks      []hook
+}
+
+type databaseTransactionKeyType struct{}
+
+var databaseTransactionKey = databaseTransactionKeyType{}
+
+func transactionFromContext(ctx context.Context) (*transaction, bool) {
+	t, ok := ctx.Value(databaseTransactionKey).(*transaction)
+	return t, ok
+}
+
+// RetryPolicy controls how an outermost WithTransaction call is re-run when
+// it fails with a retryable error. MaxAttempts counts the first attempt.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Retryable reports whether err is worth retrying. IsRetryable is used
+	// when nil.
+	Retryable func(err error) bool
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     time.Second,
+}
+
+// backoff returns the wait before the given retry, doubling from
+// InitialBackoff up to MaxBackoff with up to half of it as jitter.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	wait := p.InitialBackoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || wait < p.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait/2 + rand.N(wait/2+1)
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// IsRetryable reports whether err is a serialization failure (40001) or a
+// deadlock (40P01), as exposed by drivers implementing SQLState.
+func IsRetryable(err error) bool {
+	var sqlStateErr interface{ SQLState() string }
+	if !errors.As(err, &sqlStateErr) {
+		return false
+	}
+
+	switch sqlStateErr.SQLState() {
+	case "40001", "40P01":
+		return true
+	}
+	return false
+}
+
+type transactionOptions struct {
+	txOptions sql.TxOptions
+	retry     *RetryPolicy
+}
+
+// TransactionOption configures a WithTransaction call. Options only apply to
+// the outermost call; nested calls run in a savepoint of the transaction
+// already started and ignore them.
+type TransactionOption func(*transactionOptions)
+
+func WithIsolationLevel(level sql.IsolationLevel) TransactionOption {
+	return func(o *transactionOptions) {
+		o.txOptions.Isolation = level
+	}
+}
+
+func WithReadOnly() TransactionOption {
+	return func(o *transactionOptions) {
+		o.txOptions.ReadOnly = true
+	}
+}
+
+func WithRetry(policy RetryPolicy) TransactionOption {
+	return func(o *transactionOptions) {
+		o.retry = &policy
+	}
+}
+
+func newTransactionOptions(opts []TransactionOption) transactionOptions {
+	var o transactionOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// runTransaction runs fn in a new transaction started by begin, retrying it
+// according to the retry option. Each attempt gets a fresh transaction.
+func runTransaction(ctx context.Context, begin func(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error), fn TransactionFunc, opts []TransactionOption) error {
+	o := newTransactionOptions(opts)
+
+	attempts := 1
+	if o.retry != nil && o.retry.MaxAttempts > 1 {
+		attempts = o.retry.MaxAttempts
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			timer := time.NewTimer(o.retry.backoff(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return errors.Join(err, ctx.Err())
+			case <-timer.C:
+			}
+		}
+
+		var committed bool
+		committed, err = runTransactionOnce(ctx, begin, &o.txOptions, fn)
+		// Once committed, errors come from the commit hooks alone: retrying
+		// would apply fn's writes twice.
+		if err == nil || committed || o.retry == nil || !o.retry.retryable(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// runTransactionOnce commits when fn succeeds and rolls back when it fails
+// or panics, re-panicking afterwards. Hooks run once the outcome is known;
+// their errors are joined to fn's error but never undo a commit. committed
+// reports whether the commit went through, whatever the hooks returned.
+func runTransactionOnce(ctx context.Context, begin func(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error), txOptions *sql.TxOptions, fn TransactionFunc) (committed bool, err error) {
+	tx, err := begin(ctx, txOptions)
+	if err != nil {
+		return false, err
+	}
+
+	t := &transaction{tx: tx}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			t.runHooks(ctx, false)
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, databaseTransactionKey, t)); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+			err = errors.Join(err, rollbackErr)
+		}
+		if hookErr := t.runHooks(ctx, false); hookErr != nil {
+			err = errors.Join(err, hookErr)
+		}
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		if hookErr := t.runHooks(ctx, false); hookErr != nil {
+			err = errors.Join(err, hookErr)
+		}
+		return false, err
+	}
+
+	return true, t.runHooks(ctx, true)
+}
+
+// withSavepoint runs fn inside a savepoint of the transaction in ctx. An
+// error or panic rolls back to the savepoint only, leaving the outer
+// transaction usable; success releases it. The savepoint statements run on
+// executor, which must use t.tx, so wrappers such as the instrumented
+// database see them.
+func withSavepoint(ctx context.Context, t *transaction, executor QueryExecutor, fn TransactionFunc) error {
+	t.savepoints++
+	name := fmt.Sprintf("b16_savepoint_%d", t.savepoints)
+	hooks := len(t.hooks)
+
+	if _, err := executor.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+
+	rollback := func() error {
+		t.rollbackHooks(hooks)
+
+		if _, err := executor.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); err != nil {
+			return err
+		}
+		_, err := executor.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(ctx); err != nil {
+		if rollbackErr := rollback(); rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	_, err := executor.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
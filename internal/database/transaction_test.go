@@ -0,0 +1,224 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testSQLStateError struct {
+	state string
+}
+
+func (e *testSQLStateError) Error() string {
+	return "sql state " + e.state
+}
+
+func (e *testSQLStateError) SQLState() string {
+	return e.state
+}
+
+type TestIsRetryableParams struct {
+	Name     string
+	Err      error
+	Expected bool
+}
+
+func TestIsRetryable(t *testing.T) {
+	cases := []TestIsRetryableParams{
+		{Name: "serialization failure", Err: &testSQLStateError{state: "40001"}, Expected: true},
+		{Name: "deadlock", Err: &testSQLStateError{state: "40P01"}, Expected: true},
+		{Name: "wrapped serialization failure", Err: fmt.Errorf("update: %w", &testSQLStateError{state: "40001"}), Expected: true},
+		{Name: "unique violation", Err: &testSQLStateError{state: "23505"}, Expected: false},
+		{Name: "plain error", Err: errTestTransaction, Expected: false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			require.Equal(t, tt.Expected, IsRetryable(tt.Err))
+		})
+	}
+}
+
+type TestWithRetryParams struct {
+	Name             string
+	Errors           []error
+	ExpectedError    error
+	ExpectedAttempts int
+	ExpectedItems    []string
+}
+
+func TestDatabase_WithTransaction_Retry(t *testing.T) {
+	serializationFailure := &testSQLStateError{state: "40001"}
+
+	cases := []TestWithRetryParams{
+		{
+			Name:             "retries until success",
+			Errors:           []error{serializationFailure, serializationFailure, nil},
+			ExpectedAttempts: 3,
+			ExpectedItems:    []string{"item-3"},
+		},
+		{
+			Name:             "gives up after max attempts",
+			Errors:           []error{serializationFailure, serializationFailure, serializationFailure, nil},
+			ExpectedError:    serializationFailure,
+			ExpectedAttempts: 3,
+			ExpectedItems:    []string{},
+		},
+		{
+			Name:             "does not retry other errors",
+			Errors:           []error{errTestTransaction, nil},
+			ExpectedError:    errTestTransaction,
+			ExpectedAttempts: 1,
+			ExpectedItems:    []string{},
+		},
+	}
+
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			db, sqlDB := newTestItemsDatabase(t)
+			attempts := 0
+
+			err := db.WithTransaction(context.Background(), func(ctx context.Context) error {
+				attempts++
+				if err := insertItem(db, fmt.Sprintf("item-%d", attempts))(ctx); err != nil {
+					return err
+				}
+				return tt.Errors[attempts-1]
+			}, WithRetry(policy))
+
+			if tt.ExpectedError != nil {
+				require.ErrorIs(t, err, tt.ExpectedError)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.ExpectedAttempts, attempts)
+			require.Equal(t, tt.ExpectedItems, itemNames(t, sqlDB))
+		})
+	}
+}
+
+func TestDatabase_WithTransaction_RetryOnlyOutermost(t *testing.T) {
+	db, _ := newTestItemsDatabase(t)
+	outer, inner := 0, 0
+	policy := WithRetry(RetryPolicy{MaxAttempts: 2})
+
+	err := db.WithTransaction(context.Background(), func(ctx context.Context) error {
+		outer++
+		return db.WithTransaction(ctx, func(ctx context.Context) error {
+			inner++
+			return &testSQLStateError{state: "40001"}
+		}, policy)
+	}, policy)
+
+	require.Error(t, err)
+	require.Equal(t, 2, outer)
+	require.Equal(t, 2, inner)
+}
+
+func TestDatabase_WithTransaction_NoRetryAfterCommit(t *testing.T) {
+	db, sqlDB := newTestItemsDatabase(t)
+	serializationFailure := &testSQLStateError{state: "40001"}
+	attempts := 0
+
+	err := db.WithTransaction(context.Background(), func(ctx context.Context) error {
+		attempts++
+		if err := insertItem(db, fmt.Sprintf("item-%d", attempts))(ctx); err != nil {
+			return err
+		}
+		return OnCommit(ctx, func(ctx context.Context) error {
+			return serializationFailure
+		})
+	}, WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+
+	var hookErr *HookError
+	require.ErrorAs(t, err, &hookErr)
+	require.ErrorIs(t, err, serializationFailure)
+	require.Equal(t, 1, attempts, "a failing commit hook must not re-run a committed transaction")
+	require.Equal(t, []string{"item-1"}, itemNames(t, sqlDB))
+}
+
+func TestDatabase_WithTransaction_RetryContextCanceled(t *testing.T) {
+	db, _ := newTestItemsDatabase(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+
+	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+		attempts++
+		cancel()
+		return &testSQLStateError{state: "40001"}
+	}, WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute}))
+
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, attempts)
+}
+
+func TestDatabase_WithTransaction_Panic(t *testing.T) {
+	db, sqlDB := newTestItemsDatabase(t)
+	ctx := context.Background()
+
+	require.PanicsWithValue(t, "boom", func() {
+		db.WithTransaction(ctx, func(ctx context.Context) error {
+			if err := insertItem(db, "a")(ctx); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	})
+	require.Equal(t, []string{}, itemNames(t, sqlDB))
+
+	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := insertItem(db, "a")(ctx); err != nil {
+			return err
+		}
+
+		func() {
+			defer func() { recover() }()
+
+			db.WithTransaction(ctx, func(ctx context.Context) error {
+				if err := insertItem(db, "b")(ctx); err != nil {
+					return err
+				}
+				panic("boom")
+			})
+		}()
+
+		return insertItem(db, "c")(ctx)
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "c"}, itemNames(t, sqlDB))
+}
+
+func TestDatabase_WithTransaction_Options(t *testing.T) {
+	db, sqlDB := newTestItemsDatabase(t)
+	ctx := context.Background()
+
+	require.NoError(t, insertItem(db, "a")(ctx))
+
+	var count int
+	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+		return db.Executor(ctx).QueryRowContext(ctx, `SELECT COUNT(*) FROM items`).Scan(&count)
+	}, WithIsolationLevel(sql.LevelSerializable), WithReadOnly())
+
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.Equal(t, []string{"a"}, itemNames(t, sqlDB))
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+
+	for retry, max := range []time.Duration{10, 20, 40, 40} {
+		wait := policy.backoff(retry + 1)
+		require.GreaterOrEqual(t, wait, max*time.Millisecond/2)
+		require.LessOrEqual(t, wait, max*time.Millisecond)
+	}
+
+	require.Zero(t, RetryPolicy{}.backoff(1))
+}
@@ -1,13 +1,22 @@
 package domain
 
 type User struct {
-	ID       string
-	Email    string
-	Password string
-	Roles    []Role
+	ID            string
+	Email         string
+	Password      string
+	EmailVerified bool
+	Roles         []Role
 }
 
 type Role struct {
 	ID   string
 	Name string
 }
+
+func (u *User) RoleNames() []string {
+	names := make([]string, 0, len(u.Roles))
+	for _, role := range u.Roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
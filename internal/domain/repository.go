@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserAlreadyExists = errors.New("user already exists")
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleAlreadyExists = errors.New("role already exists")
+)
+
+const DefaultPageLimit = 50
+
+// Page selects a window of a listing. A zero Limit means DefaultPageLimit.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+func (p Page) Normalize() Page {
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageLimit
+	}
+	if p.Offset < 0 {
+		p.Offset = 0
+	}
+	return p
+}
+
+type UserRepository interface {
+	Create(ctx context.Context, user *User) error
+	GetByID(ctx context.Context, id string) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	Update(ctx context.Context, user *User) error
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context, page Page) ([]User, error)
+	AssignRole(ctx context.Context, userID, roleID string) error
+	RemoveRole(ctx context.Context, userID, roleID string) error
+}
+
+type RoleRepository interface {
+	Create(ctx context.Context, role *Role) error
+	GetByID(ctx context.Context, id string) (*Role, error)
+	GetByName(ctx context.Context, name string) (*Role, error)
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context, page Page) ([]Role, error)
+}
@@ -0,0 +1,194 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrUnsupportedAuth  = errors.New("unsupported smtp auth mechanism")
+	ErrNoAuthMechanism  = errors.New("no usable smtp auth mechanism offered by the server")
+	ErrUnencryptedAuth  = errors.New("smtp auth would send credentials unencrypted")
+	ErrMissingTokenAuth = errors.New("XOAUTH2 requires a token source")
+)
+
+type AuthMechanism string
+
+const (
+	// AuthAuto picks the first mechanism offered by the server among
+	// XOAUTH2 (when a TokenSource is set), PLAIN, LOGIN and CRAM-MD5. Without
+	// a username no authentication is done.
+	AuthAuto    AuthMechanism = ""
+	AuthNone    AuthMechanism = "NONE"
+	AuthPlain   AuthMechanism = "PLAIN"
+	AuthLogin   AuthMechanism = "LOGIN"
+	AuthCRAMMD5 AuthMechanism = "CRAM-MD5"
+	AuthXOAUTH2 AuthMechanism = "XOAUTH2"
+)
+
+// TokenSource returns the OAuth2 access token used by XOAUTH2. It is called
+// on every authentication, so it may refresh the token.
+type TokenSource func() (string, error)
+
+// NewAuth returns the smtp.Auth for mechanism, or nil when no
+// authentication must be done. host is the server name expected by PLAIN.
+// AuthAuto keeps the negotiated mechanism for the rest of the exchange, so
+// the SMTP clients of this package give each connection its own copy.
+func NewAuth(mechanism AuthMechanism, host string, username string, password string, tokenSource TokenSource) (smtp.Auth, error) {
+	switch mechanism {
+	case AuthAuto:
+		if username == "" {
+			return nil, nil
+		}
+		return &autoAuth{host: host, username: username, password: password, tokenSource: tokenSource}, nil
+	case AuthNone:
+		return nil, nil
+	case AuthPlain:
+		return smtp.PlainAuth("", username, password, host), nil
+	case AuthLogin:
+		return &loginAuth{username: username, password: password}, nil
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(username, password), nil
+	case AuthXOAUTH2:
+		if tokenSource == nil {
+			return nil, ErrMissingTokenAuth
+		}
+		return &xoauth2Auth{username: username, tokenSource: tokenSource}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedAuth, mechanism)
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+// connectionAuth is implemented by smtp.Auth values that keep state between
+// Start and Next.
+type connectionAuth interface {
+	forConnection() smtp.Auth
+}
+
+// authForConnection returns an smtp.Auth private to one connection, so
+// concurrent exchanges sharing a keep their state apart.
+func authForConnection(a smtp.Auth) smtp.Auth {
+	if auth, ok := a.(connectionAuth); ok {
+		return auth.forConnection()
+	}
+	return a
+}
+
+// autoAuth negotiates the mechanism from the AUTH extension advertised by
+// the server. Mechanisms sending the password or a bearer token in clear
+// are only picked over TLS or to localhost. It remembers the mechanism it
+// picked, so it must not be shared between connections; see
+// authForConnection.
+type autoAuth struct {
+	host        string
+	username    string
+	password    string
+	tokenSource TokenSource
+
+	selected smtp.Auth
+}
+
+func (a *autoAuth) forConnection() smtp.Auth {
+	return &autoAuth{host: a.host, username: a.username, password: a.password, tokenSource: a.tokenSource}
+}
+
+func (a *autoAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	preference := []AuthMechanism{AuthPlain, AuthLogin, AuthCRAMMD5}
+	if a.tokenSource != nil {
+		preference = append([]AuthMechanism{AuthXOAUTH2}, preference...)
+	}
+
+	secure := server.TLS || isLocalhost(server.Name)
+
+	for _, mechanism := range preference {
+		offered := slices.ContainsFunc(server.Auth, func(m string) bool {
+			return strings.EqualFold(m, string(mechanism))
+		})
+		if !offered || (!secure && mechanism != AuthCRAMMD5) {
+			continue
+		}
+
+		auth, err := NewAuth(mechanism, a.host, a.username, a.password, a.tokenSource)
+		if err != nil {
+			return "", nil, err
+		}
+
+		a.selected = auth
+		return auth.Start(server)
+	}
+
+	return "", nil, fmt.Errorf("%w: %s", ErrNoAuthMechanism, strings.Join(server.Auth, " "))
+}
+
+func (a *autoAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	return a.selected.Next(fromServer, more)
+}
+
+// loginAuth implements the LOGIN mechanism, answering the server prompts
+// by their text ("Username:", "Password:").
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, ErrUnencryptedAuth
+	}
+
+	return string(AuthLogin), nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	prompt := strings.ToLower(string(fromServer))
+
+	switch {
+	case strings.Contains(prompt, "user"):
+		return []byte(a.username), nil
+	case strings.Contains(prompt, "pass"):
+		return []byte(a.password), nil
+	}
+
+	return nil, fmt.Errorf("unexpected LOGIN challenge: %q", fromServer)
+}
+
+// xoauth2Auth implements Google and Microsoft's XOAUTH2 mechanism. Like
+// PLAIN and LOGIN, it refuses to send the bearer token unencrypted except
+// to localhost.
+type xoauth2Auth struct {
+	username    string
+	tokenSource TokenSource
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, ErrUnencryptedAuth
+	}
+
+	token, err := a.tokenSource()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return string(AuthXOAUTH2), []byte("user=" + a.username + "\x01auth=Bearer " + token + "\x01\x01"), nil
+}
+
+// Next answers the JSON error challenge sent on failure with an empty
+// response, after which the server reports the error.
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return []byte{}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,147 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type TestMailerAuthParams struct {
+	Name             string
+	Advertised       []string
+	Mechanism        AuthMechanism
+	Username         string
+	Password         string
+	TokenSource      TokenSource
+	ExpectedUsername string
+	ExpectedError    error
+	ExpectError      bool
+}
+
+func TestMailer_Auth(t *testing.T) {
+	all := []string{"PLAIN", "LOGIN", "CRAM-MD5", "XOAUTH2"}
+	token := func() (string, error) { return "secret", nil }
+
+	cases := []TestMailerAuthParams{
+		{Name: "plain", Advertised: all, Mechanism: AuthPlain, Username: "user", Password: "secret", ExpectedUsername: "user"},
+		{Name: "login", Advertised: all, Mechanism: AuthLogin, Username: "user", Password: "secret", ExpectedUsername: "user"},
+		{Name: "cram-md5", Advertised: all, Mechanism: AuthCRAMMD5, Username: "user", Password: "secret", ExpectedUsername: "user"},
+		{Name: "xoauth2", Advertised: all, Mechanism: AuthXOAUTH2, Username: "user", TokenSource: token, ExpectedUsername: "user"},
+		{Name: "none", Advertised: all, Mechanism: AuthNone, Username: "user", Password: "secret"},
+		{Name: "auto without username", Advertised: all},
+		{Name: "auto prefers xoauth2 with a token source", Advertised: all, Username: "user", TokenSource: token, ExpectedUsername: "user"},
+		{Name: "auto picks login", Advertised: []string{"LOGIN"}, Username: "user", Password: "secret", ExpectedUsername: "user"},
+		{Name: "auto picks cram-md5", Advertised: []string{"CRAM-MD5"}, Username: "user", Password: "secret", ExpectedUsername: "user"},
+		{Name: "auto without common mechanism", Advertised: []string{"GSSAPI"}, Username: "user", Password: "secret", ExpectedError: ErrNoAuthMechanism},
+		{Name: "wrong password", Advertised: all, Mechanism: AuthLogin, Username: "user", Password: "wrong", ExpectError: true},
+		{Name: "rejected token", Advertised: all, Mechanism: AuthXOAUTH2, Username: "user", TokenSource: func() (string, error) { return "expired", nil }, ExpectError: true},
+		{Name: "xoauth2 without token source", Mechanism: AuthXOAUTH2, Username: "user", ExpectedError: ErrMissingTokenAuth},
+		{Name: "unsupported mechanism", Mechanism: "NTLM", Username: "user", ExpectedError: ErrUnsupportedAuth},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			server, _ := newFakeSMTPServer(t, false, func(s *fakeSMTPServer) {
+				s.AuthMechanisms = tt.Advertised
+				s.Username = "user"
+				s.Password = "secret"
+			})
+
+			host, port, err := net.SplitHostPort(server.Addr())
+			require.NoError(t, err)
+			portNumber, err := strconv.Atoi(port)
+			require.NoError(t, err)
+
+			client := NewPooledClient(PooledClientParams{TLSMode: TLSNone})
+			defer client.Close()
+
+			m := NewDefaultMailer(MailerParams{
+				Host:          host,
+				Port:          portNumber,
+				From:          "b16@email.com",
+				Username:      tt.Username,
+				Password:      tt.Password,
+				AuthMechanism: tt.Mechanism,
+				TokenSource:   tt.TokenSource,
+			}, client)
+
+			err = m.Send("Hello", "<p>hello</p>", "to@email.com")
+
+			switch {
+			case tt.ExpectedError != nil:
+				require.ErrorIs(t, err, tt.ExpectedError)
+			case tt.ExpectError:
+				require.Error(t, err)
+			default:
+				require.NoError(t, err)
+
+				messages := server.Messages()
+				require.Len(t, messages, 1)
+				require.Equal(t, tt.ExpectedUsername, messages[0].Username)
+			}
+		})
+	}
+}
+
+func TestNewAuth_AutoRequiresEncryption(t *testing.T) {
+	auth, err := NewAuth(AuthAuto, "smtp.example.com", "user", "secret", nil)
+	require.NoError(t, err)
+
+	_, _, err = auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", Auth: []string{"PLAIN", "LOGIN"}})
+	require.ErrorIs(t, err, ErrNoAuthMechanism)
+
+	proto, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", Auth: []string{"PLAIN", "CRAM-MD5"}})
+	require.NoError(t, err)
+	require.Equal(t, "CRAM-MD5", proto)
+
+	proto, _, err = auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true, Auth: []string{"PLAIN", "CRAM-MD5"}})
+	require.NoError(t, err)
+	require.Equal(t, "PLAIN", proto)
+
+	login, err := NewAuth(AuthLogin, "smtp.example.com", "user", "secret", nil)
+	require.NoError(t, err)
+
+	_, _, err = login.Start(&smtp.ServerInfo{Name: "smtp.example.com", Auth: []string{"LOGIN"}})
+	require.ErrorIs(t, err, ErrUnencryptedAuth)
+
+	token := func() (string, error) { return "secret", nil }
+
+	xoauth2, err := NewAuth(AuthXOAUTH2, "smtp.example.com", "user", "", token)
+	require.NoError(t, err)
+
+	_, _, err = xoauth2.Start(&smtp.ServerInfo{Name: "smtp.example.com", Auth: []string{"XOAUTH2"}})
+	require.ErrorIs(t, err, ErrUnencryptedAuth)
+
+	auto, err := NewAuth(AuthAuto, "smtp.example.com", "user", "secret", token)
+	require.NoError(t, err)
+
+	proto, _, err = auto.Start(&smtp.ServerInfo{Name: "smtp.example.com", Auth: []string{"XOAUTH2", "CRAM-MD5"}})
+	require.NoError(t, err)
+	require.Equal(t, "CRAM-MD5", proto, "the bearer token is not sent in clear")
+}
+
+func TestNewAuth_AutoIsPerConnection(t *testing.T) {
+	auth, err := NewAuth(AuthAuto, "smtp.example.com", "user", "secret", nil)
+	require.NoError(t, err)
+
+	first := authForConnection(auth)
+	second := authForConnection(auth)
+	require.NotSame(t, first, second)
+
+	proto, _, err := first.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true, Auth: []string{"LOGIN"}})
+	require.NoError(t, err)
+	require.Equal(t, "LOGIN", proto)
+
+	proto, _, err = second.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true, Auth: []string{"CRAM-MD5"}})
+	require.NoError(t, err)
+	require.Equal(t, "CRAM-MD5", proto)
+
+	// The LOGIN exchange of the first connection is unaffected by the
+	// mechanism the second one picked.
+	response, err := first.Next([]byte("Username:"), true)
+	require.NoError(t, err)
+	require.Equal(t, "user", string(response))
+}
@@ -0,0 +1,181 @@
+package mailer
+
+import (
+	"fmt"
+	"time"
+)
+
+// Email is a typed transactional email: the template it renders and the
+// data it needs. Validate reports missing fields with ErrInvalidTemplateData.
+type Email interface {
+	TemplateName() string
+	Validate() error
+}
+
+// requireDuration reports a duration under a minute, which templates cannot
+// spell out.
+func requireDuration(name string, d time.Duration) error {
+	if d < time.Minute {
+		return fmt.Errorf("%w: %s must be at least a minute", ErrInvalidTemplateData, name)
+	}
+	return nil
+}
+
+// requireFields takes name and value pairs and reports the first empty one.
+func requireFields(fields ...string) error {
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] == "" {
+			return fmt.Errorf("%w: %s is required", ErrInvalidTemplateData, fields[i])
+		}
+	}
+	return nil
+}
+
+type VerificationCodeEmail struct {
+	Code      string
+	ExpiresIn time.Duration
+}
+
+func (e VerificationCodeEmail) TemplateName() string {
+	return "verification_code"
+}
+
+func (e VerificationCodeEmail) Validate() error {
+	if err := requireDuration("ExpiresIn", e.ExpiresIn); err != nil {
+		return err
+	}
+	return requireFields("Code", e.Code)
+}
+
+type PasswordResetEmail struct {
+	Name      string
+	ResetURL  string
+	ExpiresIn time.Duration
+}
+
+func (e PasswordResetEmail) TemplateName() string {
+	return "password_reset"
+}
+
+func (e PasswordResetEmail) Validate() error {
+	if err := requireDuration("ExpiresIn", e.ExpiresIn); err != nil {
+		return err
+	}
+	return requireFields("ResetURL", e.ResetURL)
+}
+
+// EmailChangeEmail is sent to the new address to confirm it.
+type EmailChangeEmail struct {
+	Name       string
+	NewEmail   string
+	ConfirmURL string
+	ExpiresIn  time.Duration
+}
+
+func (e EmailChangeEmail) TemplateName() string {
+	return "email_change"
+}
+
+func (e EmailChangeEmail) Validate() error {
+	if err := requireDuration("ExpiresIn", e.ExpiresIn); err != nil {
+		return err
+	}
+	return requireFields("NewEmail", e.NewEmail, "ConfirmURL", e.ConfirmURL)
+}
+
+type WelcomeEmail struct {
+	Name     string
+	LoginURL string
+}
+
+func (e WelcomeEmail) TemplateName() string {
+	return "welcome"
+}
+
+func (e WelcomeEmail) Validate() error {
+	return requireFields("LoginURL", e.LoginURL)
+}
+
+// LoginAlertEmail warns about a login from a new device. Location is
+// optional.
+type LoginAlertEmail struct {
+	Name             string
+	Device           string
+	IPAddress        string
+	Location         string
+	Time             time.Time
+	SecureAccountURL string
+}
+
+func (e LoginAlertEmail) TemplateName() string {
+	return "login_alert"
+}
+
+func (e LoginAlertEmail) Validate() error {
+	if e.Time.IsZero() {
+		return fmt.Errorf("%w: Time is required", ErrInvalidTemplateData)
+	}
+	return requireFields(
+		"Device", e.Device,
+		"IPAddress", e.IPAddress,
+		"SecureAccountURL", e.SecureAccountURL,
+	)
+}
+
+// AccountLockedEmail is sent when sign-in is blocked. A zero Until means the
+// account stays locked until the password is reset through UnlockURL.
+type AccountLockedEmail struct {
+	Name      string
+	Until     time.Time
+	UnlockURL string
+}
+
+func (e AccountLockedEmail) TemplateName() string {
+	return "account_locked"
+}
+
+func (e AccountLockedEmail) Validate() error {
+	return requireFields("UnlockURL", e.UnlockURL)
+}
+
+// Catalogue renders typed emails with a TemplateRegistry and sends them
+// through a Mailer.
+type Catalogue struct {
+	templates *TemplateRegistry
+	mailer    Mailer
+}
+
+func NewCatalogue(templates *TemplateRegistry, mailer Mailer) *Catalogue {
+	return &Catalogue{
+		templates: templates,
+		mailer:    mailer,
+	}
+}
+
+// Message renders email in locale and addresses it to the recipients.
+func (c *Catalogue) Message(email Email, locale string, to ...string) (*Message, error) {
+	if err := email.Validate(); err != nil {
+		return nil, &TemplateError{Name: email.TemplateName(), Locale: locale, Err: err}
+	}
+
+	rendered, err := c.templates.Render(email.TemplateName(), locale, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:      to,
+		Subject: rendered.Subject,
+		HTML:    rendered.HTML,
+		Text:    rendered.Text,
+	}, nil
+}
+
+func (c *Catalogue) Send(email Email, locale string, to ...string) error {
+	message, err := c.Message(email, locale, to...)
+	if err != nil {
+		return err
+	}
+
+	return c.mailer.SendMessage(message)
+}
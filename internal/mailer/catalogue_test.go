@@ -0,0 +1,131 @@
+package mailer
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func newTestCatalogue(t *testing.T, mailer Mailer) *Catalogue {
+	templates, err := NewTemplateRegistry(TemplateRegistryParams{})
+	require.NoError(t, err)
+	return NewCatalogue(templates, mailer)
+}
+
+type TestCatalogueParams struct {
+	Name   string
+	Locale string
+	Email  Email
+}
+
+func TestCatalogue_Golden(t *testing.T) {
+	catalogue := newTestCatalogue(t, nil)
+	at := time.Date(2024, 3, 1, 14, 30, 0, 0, time.UTC)
+
+	emails := map[string]Email{
+		"verification_code": VerificationCodeEmail{Code: "123456", ExpiresIn: 10 * time.Minute},
+		"password_reset": PasswordResetEmail{
+			Name:      "Ana",
+			ResetURL:  "https://b16.example.com/reset?token=abc&user=1",
+			ExpiresIn: 30 * time.Minute,
+		},
+		"email_change": EmailChangeEmail{
+			Name:       "Ana",
+			NewEmail:   "ana@example.com",
+			ConfirmURL: "https://b16.example.com/confirm?token=abc",
+			ExpiresIn:  time.Hour,
+		},
+		"welcome": WelcomeEmail{Name: "<Ana>", LoginURL: "https://b16.example.com/login"},
+		"login_alert": LoginAlertEmail{
+			Name:             "Ana",
+			Device:           "Firefox on Linux",
+			IPAddress:        "203.0.113.7",
+			Location:         "São Paulo, BR",
+			Time:             at,
+			SecureAccountURL: "https://b16.example.com/security",
+		},
+		"account_locked": AccountLockedEmail{UnlockURL: "https://b16.example.com/reset"},
+		"account_locked_until": AccountLockedEmail{
+			Name:      "Ana",
+			Until:     at.Add(15 * time.Minute),
+			UnlockURL: "https://b16.example.com/reset",
+		},
+	}
+
+	var tests []TestCatalogueParams
+	for name, email := range emails {
+		for _, locale := range []string{"pt-BR", "en"} {
+			tests = append(tests, TestCatalogueParams{Name: name + "." + locale, Locale: locale, Email: email})
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			message, err := catalogue.Message(tt.Email, tt.Locale, "ana@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"ana@example.com"}, message.To)
+
+			got := "Subject: " + message.Subject + "\n\n-- html --\n" + message.HTML + "\n\n-- text --\n" + message.Text + "\n"
+			path := filepath.Join("testdata", tt.Name+".golden")
+
+			if *updateGolden {
+				require.NoError(t, os.MkdirAll("testdata", 0o755))
+				require.NoError(t, os.WriteFile(path, []byte(got), 0o644))
+			}
+
+			want, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), got)
+		})
+	}
+}
+
+func TestCatalogue_Send(t *testing.T) {
+	client := NewRecordingClient()
+	catalogue := newTestCatalogue(t, NewDefaultMailer(MailerParams{
+		Host: "localhost",
+		Port: 25,
+		From: "b16@email.com",
+	}, client))
+
+	err := catalogue.Send(WelcomeEmail{Name: "Ana", LoginURL: "https://b16.example.com/login"}, "en", "ana@example.com")
+	require.NoError(t, err)
+
+	sent, ok := client.Last()
+	require.True(t, ok)
+	assert.Equal(t, "Welcome to B16", sent.Subject())
+	assert.Contains(t, sent.Body("text/html"), `href="https://b16.example.com/login"`)
+	assert.Contains(t, sent.Body("text/plain"), "Hello, Ana!")
+}
+
+func TestCatalogue_Validate(t *testing.T) {
+	catalogue := newTestCatalogue(t, nil)
+
+	emails := []Email{
+		VerificationCodeEmail{},
+		VerificationCodeEmail{Code: "123456", ExpiresIn: 30 * time.Second},
+		PasswordResetEmail{ResetURL: "https://b16.example.com/reset"},
+		EmailChangeEmail{NewEmail: "ana@example.com", ExpiresIn: time.Hour},
+		WelcomeEmail{Name: "Ana"},
+		LoginAlertEmail{Device: "Firefox", IPAddress: "203.0.113.7", SecureAccountURL: "https://b16.example.com"},
+		AccountLockedEmail{Name: "Ana"},
+	}
+
+	for _, email := range emails {
+		t.Run(email.TemplateName(), func(t *testing.T) {
+			_, err := catalogue.Message(email, "en", "ana@example.com")
+			assert.ErrorIs(t, err, ErrInvalidTemplateData)
+
+			var templateErr *TemplateError
+			require.ErrorAs(t, err, &templateErr)
+			assert.Equal(t, email.TemplateName(), templateErr.Name)
+		})
+	}
+}
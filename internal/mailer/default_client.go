@@ -9,5 +9,5 @@ func NewDefaultClient() SMTPClient {
 }
 
 func (c *DefaultClient) SendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
-	return smtp.SendMail(addr, a, from, to, msg)
+	return smtp.SendMail(addr, authForConnection(a), from, to, msg)
 }
@@ -1,10 +1,10 @@
 package mailer
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"net/smtp"
+	"time"
 
 	"github.com/v2code/b16/internal/logger"
 )
@@ -13,13 +13,18 @@ const LOG_EMAIL_PREFIX = "EMAIL SEND"
 
 var ErrFailedToSendMail = errors.New("failed to send mail")
 
+// DefaultMaxMessageSize matches the limit of most mail providers.
+const DefaultMaxMessageSize = 25 << 20
+
 type DefaultMailer struct {
-	host     string
-	port     int
-	from     string
-	username string
-	password string
-	client   SMTPClient
+	host    string
+	port    int
+	from    string
+	auth    smtp.Auth
+	authErr error
+	client  SMTPClient
+	maxSize int
+	now     func() time.Time
 }
 
 type MailerParams struct {
@@ -28,40 +33,66 @@ type MailerParams struct {
 	From     string
 	Username string
 	Password string
+	// MaxMessageSize is the largest built message, attachments included,
+	// handed to the SMTPClient. DefaultMaxMessageSize is used when zero.
+	MaxMessageSize int
+	// AuthMechanism defaults to AuthAuto, which skips authentication when
+	// Username is empty.
+	AuthMechanism AuthMechanism
+	// TokenSource provides the access token for XOAUTH2.
+	TokenSource TokenSource
 }
 
 func NewDefaultMailer(params MailerParams, client SMTPClient) Mailer {
+	maxSize := params.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxMessageSize
+	}
+
+	auth, authErr := NewAuth(params.AuthMechanism, params.Host, params.Username, params.Password, params.TokenSource)
+
 	return &DefaultMailer{
-		host:     params.Host,
-		port:     params.Port,
-		from:     params.From,
-		username: params.Username,
-		password: params.Password,
-		client:   client,
+		host:    params.Host,
+		port:    params.Port,
+		from:    params.From,
+		auth:    auth,
+		authErr: authErr,
+		client:  client,
+		maxSize: maxSize,
+		now:     time.Now,
 	}
 }
 
 func (m *DefaultMailer) Send(subject string, body string, to ...string) error {
-	auth := smtp.PlainAuth("", m.username, m.password, m.host)
+	return m.SendMessage(&Message{
+		To:      to,
+		Subject: subject,
+		HTML:    body,
+	})
+}
 
-	buffer := bytes.Buffer{}
+func (m *DefaultMailer) SendMessage(message *Message) error {
+	if m.authErr != nil {
+		return m.authErr
+	}
+
+	envelope, err := message.Build(m.from, m.now())
+	if err != nil {
+		return err
+	}
 
-	buffer.WriteString("From: " + m.from + "\r\n")
-	buffer.WriteString("To: " + m.from + "\r\n")
-	buffer.WriteString("Subject: " + subject + "\r\n")
-	buffer.WriteString("MIME-Version: 1.0\r\n")
-	buffer.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-	buffer.WriteString("\r\n")
-	buffer.WriteString(body)
+	if len(envelope.Data) > m.maxSize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrMessageTooLarge, len(envelope.Data), m.maxSize)
+	}
 
-	logger.Debug(LOG_EMAIL_PREFIX, "Sending email to", to)
+	logger.Debug(LOG_EMAIL_PREFIX, "Sending email to", envelope.To)
 
-	if err := m.client.SendMail(m.BuildAddr(), auth, m.from, to, buffer.Bytes()); err != nil {
+	if err := m.client.SendMail(m.BuildAddr(), m.auth, envelope.From, envelope.To, envelope.Data); err != nil {
 		logger.Error(LOG_EMAIL_PREFIX, "Error sending email", err.Error())
-		return ErrFailedToSendMail
+		return fmt.Errorf("%w: %w", ErrFailedToSendMail, err)
 	}
 
-	logger.Debug(LOG_EMAIL_PREFIX, "Email sent successfully to", to)
+	logger.Debug(LOG_EMAIL_PREFIX, "Email sent successfully to", envelope.To)
 
 	return nil
 }
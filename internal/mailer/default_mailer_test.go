@@ -1,20 +1,12 @@
 package mailer
 
 import (
-	"net/smtp"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-type fakeClient struct {
-	err error
-}
-
-func (c *fakeClient) SendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
-	return c.err
-}
-
 type TestMailerParams struct {
 	Name      string
 	Emails    []string
@@ -41,19 +33,72 @@ func TestMailer_Send(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.Name, func(t *testing.T) {
+			client := NewRecordingClient()
+			client.FailWith(tt.ClientErr)
+
 			m := NewDefaultMailer(MailerParams{
 				Host:     "localhost",
 				Port:     25,
 				From:     "b16@email.com",
 				Username: "username",
 				Password: "password",
-			}, &fakeClient{
-				err: tt.ClientErr,
-			})
+			}, client)
 
 			body := ""
 			err := m.Send("b16@email.com", body, tt.Emails...)
 			assert.ErrorIs(t, err, tt.ExpectErr)
+
+			if tt.ExpectErr == nil {
+				assert.Len(t, client.SentTo(tt.Emails[0]), 1)
+			}
 		})
 	}
 }
+
+func TestMailer_SendMessage(t *testing.T) {
+	client := NewRecordingClient()
+	m := NewDefaultMailer(MailerParams{
+		Host: "localhost",
+		Port: 25,
+		From: "B16 <b16@email.com>",
+	}, client)
+
+	err := m.SendMessage(&Message{
+		To:      []string{"to@email.com"},
+		Bcc:     []string{"bcc@email.com"},
+		Subject: "Hello",
+		Text:    "hello",
+	})
+	require.NoError(t, err)
+
+	sent, ok := client.Last()
+	require.True(t, ok)
+	assert.Equal(t, "localhost:25", sent.Addr)
+	assert.Equal(t, "b16@email.com", sent.From)
+	assert.Equal(t, []string{"to@email.com", "bcc@email.com"}, sent.To)
+	assert.Equal(t, "<to@email.com>", sent.Header("To"))
+	assert.Equal(t, `"B16" <b16@email.com>`, sent.Header("From"))
+	assert.Empty(t, sent.Header("Bcc"))
+	assert.Equal(t, "hello", sent.Body("text/plain"))
+	assert.Len(t, client.SentTo("bcc@email.com"), 1)
+
+	err = m.SendMessage(&Message{Subject: "Hello"})
+	assert.ErrorIs(t, err, ErrEmptyRecipients)
+}
+
+func TestMailer_SendMessageTooLarge(t *testing.T) {
+	client := NewRecordingClient()
+	m := NewDefaultMailer(MailerParams{
+		Host:           "localhost",
+		Port:           25,
+		From:           "b16@email.com",
+		MaxMessageSize: 1024,
+	}, client)
+
+	message := &Message{To: []string{"to@email.com"}, Subject: "Report"}
+	message.Attach("report.bin", make([]byte, 1024))
+
+	err := m.SendMessage(message)
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+	assert.Empty(t, client.Mails())
+}
@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type FileClientParams struct {
+	Dir string
+	// Mbox appends every message to Dir/mail.mbox instead of writing one
+	// .eml file per message.
+	Mbox bool
+}
+
+// FileClient is an SMTPClient that writes messages to disk, for local
+// development. The envelope is kept in X-Envelope-From and X-Envelope-To
+// headers so Bcc recipients remain visible.
+type FileClient struct {
+	dir  string
+	mbox bool
+	mu   sync.Mutex
+	now  func() time.Time
+}
+
+func NewFileClient(params FileClientParams) *FileClient {
+	return &FileClient{
+		dir:  params.Dir,
+		mbox: params.Mbox,
+		now:  time.Now,
+	}
+}
+
+func (c *FileClient) SendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+
+	var data bytes.Buffer
+	data.WriteString("X-Envelope-From: " + from + "\r\n")
+	data.WriteString("X-Envelope-To: " + strings.Join(to, ", ") + "\r\n")
+	data.Write(msg)
+
+	now := c.now()
+
+	if c.mbox {
+		return c.appendMbox(from, now, data.Bytes())
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	name := now.UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(suffix) + ".eml"
+	return os.WriteFile(filepath.Join(c.dir, name), data.Bytes(), 0o644)
+}
+
+// appendMbox writes msg in mboxrd format: a "From " separator line, LF line
+// endings and body lines starting with "From " quoted with ">".
+func (c *FileClient) appendMbox(from string, now time.Time, msg []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	file, err := os.OpenFile(filepath.Join(c.dir, "mail.mbox"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var buffer bytes.Buffer
+	buffer.WriteString("From " + from + " " + now.UTC().Format(time.ANSIC) + "\n")
+
+	lines := strings.Split(strings.ReplaceAll(string(msg), "\r\n", "\n"), "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			line = ">" + line
+		}
+		buffer.WriteString(line + "\n")
+	}
+	buffer.WriteString("\n")
+
+	_, err = file.Write(buffer.Bytes())
+	return err
+}
@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileClient_Eml(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mails")
+	client := NewFileClient(FileClientParams{Dir: dir})
+
+	msg := []byte("Subject: Hello\r\n\r\nhello\r\n")
+	require.NoError(t, client.SendMail("", nil, "b16@email.com", []string{"to@email.com", "bcc@email.com"}, msg))
+	require.NoError(t, client.SendMail("", nil, "b16@email.com", []string{"to@email.com"}, msg))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+
+	sent := RecordedMail{Data: content}
+	assert.Equal(t, "b16@email.com", sent.Header("X-Envelope-From"))
+	assert.Equal(t, "to@email.com, bcc@email.com", sent.Header("X-Envelope-To"))
+	assert.Equal(t, "Hello", sent.Subject())
+}
+
+func TestFileClient_Mbox(t *testing.T) {
+	dir := t.TempDir()
+	client := NewFileClient(FileClientParams{Dir: dir, Mbox: true})
+	client.now = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+	msg := []byte("Subject: Hello\r\n\r\nFrom here\r\n>From there\r\n")
+	require.NoError(t, client.SendMail("", nil, "b16@email.com", []string{"to@email.com"}, msg))
+	require.NoError(t, client.SendMail("", nil, "b16@email.com", []string{"to@email.com"}, msg))
+
+	content, err := os.ReadFile(filepath.Join(dir, "mail.mbox"))
+	require.NoError(t, err)
+
+	mbox := string(content)
+	assert.Equal(t, 2, strings.Count(mbox, "From b16@email.com Fri Mar  1 12:00:00 2024\n"))
+	assert.Contains(t, mbox, "\n>From here\n>>From there\n")
+	assert.NotContains(t, mbox, "\r")
+}
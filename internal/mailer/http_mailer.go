@@ -0,0 +1,140 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/v2code/b16/internal/logger"
+)
+
+// HTTPStatusError is returned by HTTPMailer when the endpoint answers with
+// a non-2xx status.
+type HTTPStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("mail api returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// Temporary reports whether the request may succeed later (429 and 5xx).
+func (e *HTTPStatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// HTTPPayloadFunc maps a message to the JSON body expected by an API. The
+// message From is already defaulted.
+type HTTPPayloadFunc func(message *Message) (any, error)
+
+// DefaultHTTPPayload sends the message as is, with attachments content in
+// base64.
+func DefaultHTTPPayload(message *Message) (any, error) {
+	return message, nil
+}
+
+type HTTPMailerParams struct {
+	Endpoint string
+	// Method defaults to POST.
+	Method  string
+	Headers map[string]string
+	From    string
+	Payload HTTPPayloadFunc
+	// HTTPClient defaults to a client with a 30 seconds timeout.
+	HTTPClient *http.Client
+}
+
+// HTTPMailer delivers messages by posting them as JSON to a mail API.
+type HTTPMailer struct {
+	endpoint string
+	method   string
+	headers  map[string]string
+	from     string
+	payload  HTTPPayloadFunc
+	client   *http.Client
+}
+
+func NewHTTPMailer(params HTTPMailerParams) Mailer {
+	m := &HTTPMailer{
+		endpoint: params.Endpoint,
+		method:   params.Method,
+		headers:  params.Headers,
+		from:     params.From,
+		payload:  params.Payload,
+		client:   params.HTTPClient,
+	}
+
+	if m.method == "" {
+		m.method = http.MethodPost
+	}
+	if m.payload == nil {
+		m.payload = DefaultHTTPPayload
+	}
+	if m.client == nil {
+		m.client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return m
+}
+
+func (m *HTTPMailer) Send(subject string, body string, to ...string) error {
+	return m.SendMessage(&Message{
+		To:      to,
+		Subject: subject,
+		HTML:    body,
+	})
+}
+
+func (m *HTTPMailer) SendMessage(message *Message) error {
+	withFrom := *message
+	if withFrom.From == "" {
+		withFrom.From = m.from
+	}
+
+	if err := withFrom.Validate(); err != nil {
+		return err
+	}
+
+	payload, err := m.payload(&withFrom)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(m.method, m.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range m.headers {
+		request.Header.Set(key, value)
+	}
+
+	logger.Debug(LOG_EMAIL_PREFIX, "Sending email through API to", withFrom.To)
+
+	response, err := m.client.Do(request)
+	if err != nil {
+		logger.Error(LOG_EMAIL_PREFIX, "Error sending email", err.Error())
+		return fmt.Errorf("%w: %w", ErrFailedToSendMail, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		responseBody, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		err := &HTTPStatusError{StatusCode: response.StatusCode, Body: string(responseBody)}
+
+		logger.Error(LOG_EMAIL_PREFIX, "Error sending email", err.Error())
+		return fmt.Errorf("%w: %w", ErrFailedToSendMail, err)
+	}
+
+	return nil
+}
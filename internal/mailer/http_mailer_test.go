@@ -0,0 +1,98 @@
+package mailer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPMailer_SendMessage(t *testing.T) {
+	var (
+		received Message
+		header   http.Header
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	m := NewHTTPMailer(HTTPMailerParams{
+		Endpoint: server.URL,
+		From:     "b16@email.com",
+		Headers:  map[string]string{"Authorization": "Bearer key"},
+	})
+
+	message := &Message{To: []string{"to@email.com"}, Subject: "Hello", Text: "hello"}
+	message.Attach("report.txt", []byte("report"))
+
+	require.NoError(t, m.SendMessage(message))
+	assert.Equal(t, "Bearer key", header.Get("Authorization"))
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "b16@email.com", received.From)
+	assert.Equal(t, []string{"to@email.com"}, received.To)
+	assert.Equal(t, []byte("report"), received.Attachments[0].Content)
+	assert.Empty(t, message.From)
+
+	assert.ErrorIs(t, m.SendMessage(&Message{Subject: "Hello"}), ErrEmptyRecipients)
+}
+
+func TestHTTPMailer_Payload(t *testing.T) {
+	var received map[string]any
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	m := NewHTTPMailer(HTTPMailerParams{
+		Endpoint: server.URL,
+		From:     "b16@email.com",
+		Payload: func(message *Message) (any, error) {
+			return map[string]any{"sender": message.From, "subject": message.Subject}, nil
+		},
+	})
+
+	require.NoError(t, m.Send("Hello", "<p>hello</p>", "to@email.com"))
+	assert.Equal(t, map[string]any{"sender": "b16@email.com", "subject": "Hello"}, received)
+}
+
+type TestHTTPMailerStatusParams struct {
+	Name      string
+	Status    int
+	Transient bool
+}
+
+func TestHTTPMailer_Status(t *testing.T) {
+	tests := []TestHTTPMailerStatusParams{
+		{Name: "rate limited", Status: http.StatusTooManyRequests, Transient: true},
+		{Name: "server error", Status: http.StatusBadGateway, Transient: true},
+		{Name: "rejected", Status: http.StatusUnprocessableEntity, Transient: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "failure", tt.Status)
+			}))
+			defer server.Close()
+
+			m := NewHTTPMailer(HTTPMailerParams{Endpoint: server.URL, From: "b16@email.com"})
+
+			err := m.Send("Hello", "hello", "to@email.com")
+			assert.ErrorIs(t, err, ErrFailedToSendMail)
+
+			var statusErr *HTTPStatusError
+			require.ErrorAs(t, err, &statusErr)
+			assert.Equal(t, tt.Status, statusErr.StatusCode)
+			assert.Equal(t, "failure\n", statusErr.Body)
+			assert.Equal(t, tt.Transient, IsTransientError(err))
+		})
+	}
+}
@@ -3,7 +3,9 @@ package mailer
 import "net/smtp"
 
 type Mailer interface {
+	// Send is a shortcut for SendMessage with an HTML body.
 	Send(subject string, body string, to ...string) error
+	SendMessage(message *Message) error
 }
 
 type SMTPClient interface {
@@ -0,0 +1,457 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrEmptyRecipients   = errors.New("email has no recipients")
+	ErrInvalidAddress    = errors.New("invalid email address")
+	ErrInvalidHeader     = errors.New("invalid email header")
+	ErrInvalidAttachment = errors.New("invalid email attachment")
+	ErrMessageTooLarge   = errors.New("email exceeds the size limit")
+)
+
+// reservedHeaders are written by Build and cannot be set through
+// Message.Headers.
+var reservedHeaders = []string{
+	"Bcc", "Cc", "Content-Transfer-Encoding", "Content-Type", "Date", "From",
+	"Message-Id", "Mime-Version", "Reply-To", "Subject", "To",
+}
+
+// Message is an email. Addresses may carry a display name, as in
+// "Name <user@example.com>"; non-ASCII names and subjects are encoded as
+// RFC 2047 words. Bcc recipients receive the email but are left out of the
+// headers. When both HTML and Text are set they are sent as
+// multipart/alternative; inline attachments are wrapped with the HTML in
+// multipart/related and the others with the whole body in multipart/mixed.
+type Message struct {
+	From    string            `json:"from,omitempty"`
+	To      []string          `json:"to,omitempty"`
+	Cc      []string          `json:"cc,omitempty"`
+	Bcc     []string          `json:"bcc,omitempty"`
+	ReplyTo []string          `json:"reply_to,omitempty"`
+	Subject string            `json:"subject"`
+	HTML    string            `json:"html,omitempty"`
+	Text    string            `json:"text,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a file sent with a message, base64 encoded. ContentType is
+// detected from the filename extension, then from the content, when empty.
+// Setting ContentID makes it an inline attachment that the HTML references
+// as "cid:<ContentID>", e.g. an image in a template.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+	Content     []byte `json:"content"`
+}
+
+// Attach adds a regular attachment.
+func (m *Message) Attach(filename string, content []byte) {
+	m.Attachments = append(m.Attachments, Attachment{Filename: filename, Content: content})
+}
+
+// Embed adds an inline attachment referenced from the HTML as
+// "cid:<contentID>".
+func (m *Message) Embed(contentID string, filename string, content []byte) {
+	m.Attachments = append(m.Attachments, Attachment{Filename: filename, ContentID: contentID, Content: content})
+}
+
+// LoadAttachment reads the file at path into an attachment named after it.
+func LoadAttachment(path string) (Attachment, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, err
+	}
+	return Attachment{Filename: filepath.Base(path), Content: content}, nil
+}
+
+func (a *Attachment) validate() error {
+	if a.Filename == "" && a.ContentID == "" {
+		return fmt.Errorf("%w: missing filename", ErrInvalidAttachment)
+	}
+	if strings.ContainsAny(a.ContentID, "<>\r\n \t") {
+		return fmt.Errorf("%w: content id %q", ErrInvalidAttachment, a.ContentID)
+	}
+	if a.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(a.ContentType); err != nil {
+			return fmt.Errorf("%w: content type %q", ErrInvalidAttachment, a.ContentType)
+		}
+	}
+	return nil
+}
+
+func (a *Attachment) contentType() string {
+	if a.ContentType != "" {
+		return a.ContentType
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(a.Filename)); contentType != "" {
+		return contentType
+	}
+	return http.DetectContentType(a.Content)
+}
+
+func (a *Attachment) part() *mimePart {
+	header := textproto.MIMEHeader{}
+
+	disposition := "attachment"
+	if a.ContentID != "" {
+		disposition = "inline"
+		header.Set("Content-ID", "<"+a.ContentID+">")
+	}
+
+	params := map[string]string{}
+	if a.Filename != "" {
+		params["filename"] = a.Filename
+	}
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, params))
+
+	return &mimePart{
+		contentType: a.contentType(),
+		header:      header,
+		content:     a.Content,
+		base64:      true,
+	}
+}
+
+// Validate checks the addresses, the headers and that there is at least one
+// recipient, without building the message.
+func (m *Message) Validate() error {
+	if m.From != "" {
+		if _, err := parseAddress(m.From); err != nil {
+			return err
+		}
+	}
+
+	for _, addresses := range [][]string{m.To, m.Cc, m.Bcc, m.ReplyTo} {
+		if _, err := parseAddressList(addresses); err != nil {
+			return err
+		}
+	}
+
+	if len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
+		return ErrEmptyRecipients
+	}
+
+	for i := range m.Attachments {
+		if err := m.Attachments[i].validate(); err != nil {
+			return err
+		}
+	}
+
+	return checkHeaderValue(m.Subject)
+}
+
+// Envelope is a built message with the SMTP sender and recipients.
+type Envelope struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// Build renders the message, using defaultFrom when From is empty and date
+// for the Date header. The Message-ID domain is taken from the sender.
+func (m *Message) Build(defaultFrom string, date time.Time) (*Envelope, error) {
+	from := m.From
+	if from == "" {
+		from = defaultFrom
+	}
+
+	sender, err := parseAddress(from)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := parseAddressList(m.To)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := parseAddressList(m.Cc)
+	if err != nil {
+		return nil, err
+	}
+	bcc, err := parseAddressList(m.Bcc)
+	if err != nil {
+		return nil, err
+	}
+	replyTo, err := parseAddressList(m.ReplyTo)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := make([]string, 0, len(to)+len(cc)+len(bcc))
+	for _, address := range slices.Concat(to, cc, bcc) {
+		recipients = append(recipients, address.Address)
+	}
+	if len(recipients) == 0 {
+		return nil, ErrEmptyRecipients
+	}
+
+	if err := checkHeaderValue(m.Subject); err != nil {
+		return nil, err
+	}
+
+	for i := range m.Attachments {
+		if err := m.Attachments[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	messageID, err := newMessageID(sender.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	header, body, err := renderPart(m.body())
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+
+	writeHeader(&buffer, "From", sender.String())
+	writeAddressHeader(&buffer, "To", to)
+	writeAddressHeader(&buffer, "Cc", cc)
+	writeAddressHeader(&buffer, "Reply-To", replyTo)
+	writeHeader(&buffer, "Subject", mime.QEncoding.Encode("UTF-8", m.Subject))
+	writeHeader(&buffer, "Date", date.Format(time.RFC1123Z))
+	writeHeader(&buffer, "Message-ID", messageID)
+
+	keys := make([]string, 0, len(m.Headers))
+	for key := range m.Headers {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		canonical := textproto.CanonicalMIMEHeaderKey(key)
+		if slices.Contains(reservedHeaders, canonical) || strings.ContainsAny(key, ": \r\n") {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidHeader, key)
+		}
+		if err := checkHeaderValue(m.Headers[key]); err != nil {
+			return nil, err
+		}
+		writeHeader(&buffer, canonical, mime.QEncoding.Encode("UTF-8", m.Headers[key]))
+	}
+
+	writeHeader(&buffer, "MIME-Version", "1.0")
+	writeMIMEHeader(&buffer, header)
+	buffer.WriteString("\r\n")
+	buffer.Write(body)
+
+	return &Envelope{
+		From: sender.Address,
+		To:   recipients,
+		Data: buffer.Bytes(),
+	}, nil
+}
+
+func (m *Message) body() *mimePart {
+	var inline, attachments []*mimePart
+	for i := range m.Attachments {
+		if m.Attachments[i].ContentID != "" && m.HTML != "" {
+			inline = append(inline, m.Attachments[i].part())
+		} else {
+			attachments = append(attachments, m.Attachments[i].part())
+		}
+	}
+
+	html := &mimePart{contentType: "text/html", content: []byte(m.HTML)}
+	text := &mimePart{contentType: "text/plain", content: []byte(m.Text)}
+
+	if len(inline) > 0 {
+		html = &mimePart{contentType: "multipart/related", parts: append([]*mimePart{html}, inline...)}
+	}
+
+	var body *mimePart
+	switch {
+	case m.Text == "":
+		body = html
+	case m.HTML == "":
+		body = text
+	default:
+		body = &mimePart{contentType: "multipart/alternative", parts: []*mimePart{text, html}}
+	}
+
+	if len(attachments) > 0 {
+		body = &mimePart{contentType: "multipart/mixed", parts: append([]*mimePart{body}, attachments...)}
+	}
+
+	return body
+}
+
+// mimePart is either a leaf, UTF-8 text or base64 encoded binary, or a
+// multipart container of parts.
+type mimePart struct {
+	contentType string
+	header      textproto.MIMEHeader
+	content     []byte
+	base64      bool
+	parts       []*mimePart
+}
+
+// renderPart returns the part headers and its encoded body.
+func renderPart(part *mimePart) (textproto.MIMEHeader, []byte, error) {
+	header := textproto.MIMEHeader{}
+	for key, values := range part.header {
+		header[key] = values
+	}
+
+	var body bytes.Buffer
+
+	if len(part.parts) == 0 {
+		if part.base64 {
+			header.Set("Content-Type", part.contentType)
+			header.Set("Content-Transfer-Encoding", "base64")
+			writeBase64(&body, part.content)
+			return header, body.Bytes(), nil
+		}
+
+		header.Set("Content-Type", mime.FormatMediaType(part.contentType, map[string]string{"charset": "UTF-8"}))
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+		writer := quotedprintable.NewWriter(&body)
+		if _, err := writer.Write(part.content); err != nil {
+			return nil, nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, nil, err
+		}
+
+		return header, body.Bytes(), nil
+	}
+
+	writer := multipart.NewWriter(&body)
+
+	for _, child := range part.parts {
+		childHeader, childBody, err := renderPart(child)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		w, err := writer.CreatePart(childHeader)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := w.Write(childBody); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	params := map[string]string{"boundary": writer.Boundary()}
+	if part.contentType == "multipart/related" {
+		params["type"] = "text/html"
+	}
+	header.Set("Content-Type", mime.FormatMediaType(part.contentType, params))
+
+	return header, body.Bytes(), nil
+}
+
+// writeBase64 encodes content in lines of 76 characters, as required by
+// RFC 2045.
+func writeBase64(buffer *bytes.Buffer, content []byte) {
+	encoded := base64.StdEncoding.EncodeToString(content)
+
+	for len(encoded) > 76 {
+		buffer.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	if encoded != "" {
+		buffer.WriteString(encoded + "\r\n")
+	}
+}
+
+func parseAddress(address string) (*mail.Address, error) {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAddress, address)
+	}
+	return parsed, nil
+}
+
+func parseAddressList(addresses []string) ([]*mail.Address, error) {
+	parsed := make([]*mail.Address, 0, len(addresses))
+	for _, address := range addresses {
+		p, err := parseAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+func checkHeaderValue(value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("%w: value contains a line break", ErrInvalidHeader)
+	}
+	return nil
+}
+
+func newMessageID(sender string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(sender, "@"); at >= 0 && at < len(sender)-1 {
+		domain = sender[at+1:]
+	}
+
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain), nil
+}
+
+func writeHeader(buffer *bytes.Buffer, key string, value string) {
+	buffer.WriteString(key + ": " + value + "\r\n")
+}
+
+func writeAddressHeader(buffer *bytes.Buffer, key string, addresses []*mail.Address) {
+	if len(addresses) == 0 {
+		return
+	}
+
+	formatted := make([]string, len(addresses))
+	for i, address := range addresses {
+		formatted[i] = address.String()
+	}
+	writeHeader(buffer, key, strings.Join(formatted, ", "))
+}
+
+func writeMIMEHeader(buffer *bytes.Buffer, header textproto.MIMEHeader) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		for _, value := range header[key] {
+			writeHeader(buffer, key, value)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func buildTestMessage(t *testing.T, message *Message) (*Envelope, *mail.Message) {
+	t.Helper()
+
+	envelope, err := message.Build("B16 <b16@email.com>", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(envelope.Data))
+	require.NoError(t, err)
+
+	return envelope, parsed
+}
+
+func readQuotedPrintable(t *testing.T, r io.Reader) string {
+	t.Helper()
+
+	content, err := io.ReadAll(quotedprintable.NewReader(r))
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestMessage_BuildHeaders(t *testing.T) {
+	envelope, parsed := buildTestMessage(t, &Message{
+		To:      []string{"José Silva <jose@email.com>", "ana@email.com"},
+		Cc:      []string{"cc@email.com"},
+		Bcc:     []string{"bcc@email.com"},
+		ReplyTo: []string{"Suporte <support@email.com>"},
+		Subject: "Código de verificação",
+		HTML:    "<p>olá</p>",
+		Headers: map[string]string{"x-campaign": "welcome"},
+	})
+
+	require.Equal(t, "b16@email.com", envelope.From)
+	require.Equal(t, []string{"jose@email.com", "ana@email.com", "cc@email.com", "bcc@email.com"}, envelope.To)
+
+	to, err := parsed.Header.AddressList("To")
+	require.NoError(t, err)
+	require.Equal(t, "José Silva", to[0].Name)
+	require.Equal(t, "ana@email.com", to[1].Address)
+	require.NotContains(t, parsed.Header.Get("To"), "José")
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	require.Equal(t, "Código de verificação", subject)
+	require.NotEqual(t, subject, parsed.Header.Get("Subject"))
+
+	require.Equal(t, "<cc@email.com>", parsed.Header.Get("Cc"))
+	require.Empty(t, parsed.Header.Get("Bcc"))
+	require.Equal(t, `"Suporte" <support@email.com>`, parsed.Header.Get("Reply-To"))
+	require.Equal(t, "welcome", parsed.Header.Get("X-Campaign"))
+	require.Equal(t, "Fri, 02 Jan 2026 03:04:05 +0000", parsed.Header.Get("Date"))
+	require.Regexp(t, `^<[0-9a-f]{32}@email\.com>$`, parsed.Header.Get("Message-ID"))
+	require.Equal(t, "1.0", parsed.Header.Get("MIME-Version"))
+
+	mediaType, _, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "text/html", mediaType)
+	require.Equal(t, "<p>olá</p>", readQuotedPrintable(t, parsed.Body))
+}
+
+func TestMessage_BuildAlternative(t *testing.T) {
+	_, parsed := buildTestMessage(t, &Message{
+		To:      []string{"to@email.com"},
+		Subject: "Hello",
+		HTML:    "<p>Hello</p>",
+		Text:    "Hello",
+	})
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+
+	expected := []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", "Hello"},
+		{"text/html; charset=UTF-8", "<p>Hello</p>"},
+	}
+
+	for _, e := range expected {
+		part, err := reader.NextRawPart()
+		require.NoError(t, err)
+		require.Equal(t, e.contentType, part.Header.Get("Content-Type"))
+		require.Equal(t, e.body, readQuotedPrintable(t, part))
+	}
+
+	_, err = reader.NextPart()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+type TestMessageBuildErrorParams struct {
+	Name          string
+	Message       *Message
+	ExpectedError error
+}
+
+func TestMessage_BuildErrors(t *testing.T) {
+	cases := []TestMessageBuildErrorParams{
+		{
+			Name:          "no recipients",
+			Message:       &Message{Subject: "Hello"},
+			ExpectedError: ErrEmptyRecipients,
+		},
+		{
+			Name:          "invalid recipient",
+			Message:       &Message{To: []string{"not an address"}},
+			ExpectedError: ErrInvalidAddress,
+		},
+		{
+			Name:          "invalid sender",
+			Message:       &Message{From: "b16", To: []string{"to@email.com"}},
+			ExpectedError: ErrInvalidAddress,
+		},
+		{
+			Name:          "subject with line break",
+			Message:       &Message{To: []string{"to@email.com"}, Subject: "Hello\r\nBcc: evil@email.com"},
+			ExpectedError: ErrInvalidHeader,
+		},
+		{
+			Name:          "reserved header",
+			Message:       &Message{To: []string{"to@email.com"}, Headers: map[string]string{"subject": "other"}},
+			ExpectedError: ErrInvalidHeader,
+		},
+		{
+			Name:          "header value with line break",
+			Message:       &Message{To: []string{"to@email.com"}, Headers: map[string]string{"X-Tag": "a\nb"}},
+			ExpectedError: ErrInvalidHeader,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := tt.Message.Build("b16@email.com", time.Now())
+			require.ErrorIs(t, err, tt.ExpectedError)
+		})
+	}
+}
+
+// pngHeader is enough for http.DetectContentType to report image/png.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func readPart(t *testing.T, part *multipart.Part) []byte {
+	t.Helper()
+
+	content, err := io.ReadAll(part)
+	require.NoError(t, err)
+
+	if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(content), "\r\n", ""))
+		require.NoError(t, err)
+		return decoded
+	}
+
+	return content
+}
+
+func multipartReader(t *testing.T, contentType string, expected string, body io.Reader) *multipart.Reader {
+	t.Helper()
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	require.NoError(t, err)
+	require.Equal(t, expected, mediaType)
+
+	return multipart.NewReader(body, params["boundary"])
+}
+
+func TestMessage_BuildAttachments(t *testing.T) {
+	html, err := RenderTemplate("logo", `<img src="{{cid "logo"}}">`, nil)
+	require.NoError(t, err)
+	require.Equal(t, `<img src="cid:logo">`, html)
+
+	message := &Message{
+		To:      []string{"to@email.com"},
+		Subject: "Invoice",
+		HTML:    html,
+		Text:    "Invoice attached",
+	}
+	message.Embed("logo", "logo", pngHeader)
+	message.Attach("fatura março.pdf", bytes.Repeat([]byte("%PDF"), 40))
+
+	_, parsed := buildTestMessage(t, message)
+
+	mixed := multipartReader(t, parsed.Header.Get("Content-Type"), "multipart/mixed", parsed.Body)
+
+	bodyPart, err := mixed.NextRawPart()
+	require.NoError(t, err)
+	alternative := multipartReader(t, bodyPart.Header.Get("Content-Type"), "multipart/alternative", bodyPart)
+
+	textPart, err := alternative.NextRawPart()
+	require.NoError(t, err)
+	require.Equal(t, "Invoice attached", readQuotedPrintable(t, textPart))
+
+	relatedPart, err := alternative.NextRawPart()
+	require.NoError(t, err)
+	related := multipartReader(t, relatedPart.Header.Get("Content-Type"), "multipart/related", relatedPart)
+
+	htmlPart, err := related.NextRawPart()
+	require.NoError(t, err)
+	require.Equal(t, html, readQuotedPrintable(t, htmlPart))
+
+	logoPart, err := related.NextRawPart()
+	require.NoError(t, err)
+	require.Equal(t, "image/png", logoPart.Header.Get("Content-Type"))
+	require.Equal(t, "<logo>", logoPart.Header.Get("Content-ID"))
+	require.Equal(t, `inline; filename=logo`, logoPart.Header.Get("Content-Disposition"))
+	require.Equal(t, pngHeader, readPart(t, logoPart))
+
+	pdfPart, err := mixed.NextRawPart()
+	require.NoError(t, err)
+	require.Equal(t, "application/pdf", pdfPart.Header.Get("Content-Type"))
+	require.Equal(t, "fatura março.pdf", pdfPart.FileName())
+	require.Equal(t, bytes.Repeat([]byte("%PDF"), 40), readPart(t, pdfPart))
+
+	_, err = mixed.NextRawPart()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestMessage_BuildInlineWithoutHTML(t *testing.T) {
+	message := &Message{To: []string{"to@email.com"}, Text: "no html"}
+	message.Embed("logo", "logo.png", pngHeader)
+
+	_, parsed := buildTestMessage(t, message)
+
+	mixed := multipartReader(t, parsed.Header.Get("Content-Type"), "multipart/mixed", parsed.Body)
+
+	textPart, err := mixed.NextRawPart()
+	require.NoError(t, err)
+	require.Equal(t, "text/plain; charset=UTF-8", textPart.Header.Get("Content-Type"))
+
+	logoPart, err := mixed.NextRawPart()
+	require.NoError(t, err)
+	require.Equal(t, "image/png", logoPart.Header.Get("Content-Type"))
+}
+
+func TestMessage_BuildInvalidAttachment(t *testing.T) {
+	cases := []TestMessageBuildErrorParams{
+		{
+			Name:          "missing filename",
+			Message:       &Message{To: []string{"to@email.com"}, Attachments: []Attachment{{Content: pngHeader}}},
+			ExpectedError: ErrInvalidAttachment,
+		},
+		{
+			Name:          "invalid content id",
+			Message:       &Message{To: []string{"to@email.com"}, Attachments: []Attachment{{ContentID: "<logo>"}}},
+			ExpectedError: ErrInvalidAttachment,
+		},
+		{
+			Name:          "invalid content type",
+			Message:       &Message{To: []string{"to@email.com"}, Attachments: []Attachment{{Filename: "a", ContentType: "/"}}},
+			ExpectedError: ErrInvalidAttachment,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := tt.Message.Build("b16@email.com", time.Now())
+			require.ErrorIs(t, err, tt.ExpectedError)
+			require.ErrorIs(t, tt.Message.Validate(), tt.ExpectedError)
+		})
+	}
+}
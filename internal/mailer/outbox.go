@@ -0,0 +1,360 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/v2code/b16/internal/database"
+	"github.com/v2code/b16/internal/logger"
+)
+
+const LOG_OUTBOX_PREFIX = "EMAIL OUTBOX"
+
+const (
+	OutboxStatusPending = "pending"
+	// OutboxStatusSending marks messages claimed by a relay. Their
+	// next_attempt_at is the end of the lease; once it passes, another relay
+	// may claim them again.
+	OutboxStatusSending = "sending"
+	OutboxStatusSent    = "sent"
+	// OutboxStatusDead marks messages that failed MaxAttempts times; the
+	// relay no longer picks them up.
+	OutboxStatusDead = "dead"
+)
+
+// Outbox stores emails in the email_outbox table through
+// database.Executor(ctx), so an enqueue in a transaction is only visible
+// to the relay once the business write commits with it.
+type Outbox struct {
+	db  database.Database
+	now func() time.Time
+}
+
+func NewOutbox(db database.Database) *Outbox {
+	return &Outbox{
+		db:  db,
+		now: time.Now,
+	}
+}
+
+// Enqueue stores an HTML email for the relay and returns its ID.
+func (o *Outbox) Enqueue(ctx context.Context, subject string, body string, to ...string) (string, error) {
+	return o.EnqueueMessage(ctx, &Message{
+		To:      to,
+		Subject: subject,
+		HTML:    body,
+	})
+}
+
+// EnqueueMessage stores message, serialized as JSON, for the relay and
+// returns its ID.
+func (o *Outbox) EnqueueMessage(ctx context.Context, message *Message) (string, error) {
+	if err := message.Validate(); err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := newOutboxID()
+	if err != nil {
+		return "", err
+	}
+
+	now := o.now().UTC()
+
+	_, err = o.db.Executor(ctx).ExecContext(ctx,
+		`INSERT INTO email_outbox (id, payload, status, attempts, next_attempt_at, created_at) VALUES ($1, $2, $3, 0, $4, $4)`,
+		id, string(payload), OutboxStatusPending, now,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func newOutboxID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type OutboxRelayParams struct {
+	DB      database.Database
+	Dialect database.Dialect
+	Mailer  Mailer
+	// BatchSize is the number of messages claimed per poll.
+	BatchSize    int
+	PollInterval time.Duration
+	// MaxAttempts is the number of failed sends after which a message is
+	// moved to OutboxStatusDead.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// LeaseDuration is how long a claimed message is reserved for the relay
+	// that claimed it. It must be longer than a batch takes to send.
+	LeaseDuration time.Duration
+}
+
+// OutboxRelay delivers the messages stored by Outbox. Each batch is claimed
+// in a short transaction with the dialect's SKIP LOCKED clause, which marks
+// the messages OutboxStatusSending under a lease. Messages are then sent
+// outside any transaction and each outcome is recorded on its own, so a
+// database error never rolls back a message that was already delivered.
+// Messages of a relay that dies mid-batch are claimed again once their
+// lease expires.
+type OutboxRelay struct {
+	db             database.Database
+	dialect        database.Dialect
+	mailer         Mailer
+	batchSize      int
+	pollInterval   time.Duration
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	leaseDuration  time.Duration
+	now            func() time.Time
+}
+
+func NewOutboxRelay(params OutboxRelayParams) *OutboxRelay {
+	r := &OutboxRelay{
+		db:             params.DB,
+		dialect:        params.Dialect,
+		mailer:         params.Mailer,
+		batchSize:      params.BatchSize,
+		pollInterval:   params.PollInterval,
+		maxAttempts:    params.MaxAttempts,
+		initialBackoff: params.InitialBackoff,
+		maxBackoff:     params.MaxBackoff,
+		leaseDuration:  params.LeaseDuration,
+		now:            time.Now,
+	}
+
+	if r.batchSize <= 0 {
+		r.batchSize = 10
+	}
+	if r.pollInterval <= 0 {
+		r.pollInterval = 5 * time.Second
+	}
+	if r.maxAttempts <= 0 {
+		r.maxAttempts = 5
+	}
+	if r.initialBackoff <= 0 {
+		r.initialBackoff = 30 * time.Second
+	}
+	if r.maxBackoff <= 0 {
+		r.maxBackoff = time.Hour
+	}
+	if r.leaseDuration <= 0 {
+		r.leaseDuration = 5 * time.Minute
+	}
+
+	return r
+}
+
+// Run polls the outbox until ctx is done. A full batch is followed by
+// another poll right away.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	for {
+		processed, err := r.ProcessBatch(ctx)
+		if err != nil {
+			logger.Error(LOG_OUTBOX_PREFIX, "Error processing batch", err.Error())
+		}
+
+		wait := r.pollInterval
+		if err == nil && processed == r.batchSize {
+			wait = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+type claimedMessage struct {
+	id       string
+	payload  string
+	attempts int
+	leaseID  string
+}
+
+// ProcessBatch claims due messages, sends them and records the outcome,
+// returning how many were claimed.
+func (r *OutboxRelay) ProcessBatch(ctx context.Context) (int, error) {
+	messages, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	for _, message := range messages {
+		if err := r.deliver(ctx, message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return len(messages), errors.Join(errs...)
+}
+
+var errOutboxLeaseExpired = errors.New("lease expired before the outcome was recorded")
+
+// claim selects due messages and leases them to this relay in one
+// transaction, which commits before anything is sent. A message whose lease
+// expired counts as a failed attempt, so one that keeps taking its relay
+// down is moved to OutboxStatusDead instead of being claimed forever.
+func (r *OutboxRelay) claim(ctx context.Context) ([]claimedMessage, error) {
+	leaseID, err := newOutboxID()
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []claimedMessage
+
+	err = r.db.WithTransaction(ctx, func(ctx context.Context) error {
+		messages = nil
+
+		executor := r.db.Executor(ctx)
+		now := r.now().UTC()
+
+		rows, err := executor.QueryContext(ctx,
+			fmt.Sprintf(`SELECT id, payload, attempts, status FROM email_outbox
+			WHERE status IN ($1, $2) AND next_attempt_at <= $3
+			ORDER BY next_attempt_at LIMIT $4 %s`, r.dialect.SkipLocked()),
+			OutboxStatusPending, OutboxStatusSending, now, r.batchSize,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var (
+			due      []claimedMessage
+			statuses []string
+		)
+		for rows.Next() {
+			var (
+				message = claimedMessage{leaseID: leaseID}
+				status  string
+			)
+			if err := rows.Scan(&message.id, &message.payload, &message.attempts, &status); err != nil {
+				return err
+			}
+			due = append(due, message)
+			statuses = append(statuses, status)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		for i, message := range due {
+			if statuses[i] == OutboxStatusSending {
+				message.attempts++
+				if message.attempts >= r.maxAttempts {
+					logger.Error(LOG_OUTBOX_PREFIX, "Message moved to dead letter", message.id, "error", errOutboxLeaseExpired.Error())
+
+					_, err := executor.ExecContext(ctx,
+						`UPDATE email_outbox SET status = $2, attempts = $3, last_error = $4, lease_id = NULL WHERE id = $1`,
+						message.id, OutboxStatusDead, message.attempts, errOutboxLeaseExpired.Error(),
+					)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+
+				logger.Warn(LOG_OUTBOX_PREFIX, "Lease expired, claiming message again", message.id, "attempts", message.attempts)
+			}
+
+			_, err := executor.ExecContext(ctx,
+				`UPDATE email_outbox SET status = $2, attempts = $3, lease_id = $4, next_attempt_at = $5 WHERE id = $1`,
+				message.id, OutboxStatusSending, message.attempts, leaseID, now.Add(r.leaseDuration),
+			)
+			if err != nil {
+				return err
+			}
+			messages = append(messages, message)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// deliver sends one message and records the outcome on its row, as long as
+// the lease is still held. Only database errors are returned; send errors
+// are recorded on the message.
+func (r *OutboxRelay) deliver(ctx context.Context, message claimedMessage) error {
+	var payload Message
+	sendErr := json.Unmarshal([]byte(message.payload), &payload)
+	if sendErr == nil {
+		sendErr = r.mailer.SendMessage(&payload)
+	}
+
+	executor := r.db.Executor(ctx)
+	now := r.now().UTC()
+
+	var (
+		result sql.Result
+		err    error
+	)
+
+	if sendErr == nil {
+		result, err = executor.ExecContext(ctx,
+			`UPDATE email_outbox SET status = $3, attempts = attempts + 1, last_error = NULL, lease_id = NULL, sent_at = $4
+			WHERE id = $1 AND lease_id = $2`,
+			message.id, message.leaseID, OutboxStatusSent, now,
+		)
+	} else {
+		attempts := message.attempts + 1
+		status := OutboxStatusPending
+		if attempts >= r.maxAttempts {
+			status = OutboxStatusDead
+			logger.Error(LOG_OUTBOX_PREFIX, "Message moved to dead letter", message.id, "error", sendErr.Error())
+		} else {
+			logger.Warn(LOG_OUTBOX_PREFIX, "Error sending message", message.id, "attempts", attempts, "error", sendErr.Error())
+		}
+
+		result, err = executor.ExecContext(ctx,
+			`UPDATE email_outbox SET status = $3, attempts = $4, last_error = $5, lease_id = NULL, next_attempt_at = $6
+			WHERE id = $1 AND lease_id = $2`,
+			message.id, message.leaseID, status, attempts, sendErr.Error(), now.Add(r.backoff(attempts)),
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		logger.Warn(LOG_OUTBOX_PREFIX, "Lease expired before the outcome was recorded", message.id)
+	}
+
+	return nil
+}
+
+// backoff doubles InitialBackoff for every failed attempt, up to MaxBackoff.
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	wait := r.initialBackoff
+	for i := 1; i < attempts && wait < r.maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, r.maxBackoff)
+}
@@ -0,0 +1,315 @@
+package mailer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/v2code/b16/internal/database"
+	_ "modernc.org/sqlite"
+)
+
+type recordingMailer struct {
+	sent []*Message
+	err  error
+}
+
+func (m *recordingMailer) Send(subject string, body string, to ...string) error {
+	return m.SendMessage(&Message{To: to, Subject: subject, HTML: body})
+}
+
+func (m *recordingMailer) SendMessage(message *Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, message)
+	return nil
+}
+
+func newTestOutboxDatabase(t *testing.T) database.Database {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite", "file::memory:?_time_format=sqlite")
+	require.NoError(t, err)
+
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db := database.NewDatabase(sqlDB)
+
+	migrator, err := database.NewMigrator(db, database.SQLiteDialect, database.Migrations)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Up(context.Background()))
+
+	return db
+}
+
+type outboxRow struct {
+	Status    string
+	Attempts  int
+	LastError sql.NullString
+}
+
+func getOutboxRow(t *testing.T, db database.Database, id string) outboxRow {
+	t.Helper()
+
+	ctx := context.Background()
+
+	var row outboxRow
+	err := db.Executor(ctx).QueryRowContext(ctx,
+		`SELECT status, attempts, last_error FROM email_outbox WHERE id = $1`, id,
+	).Scan(&row.Status, &row.Attempts, &row.LastError)
+	require.NoError(t, err)
+
+	return row
+}
+
+func TestOutbox_EnqueueInTransaction(t *testing.T) {
+	ctx := context.Background()
+	db := newTestOutboxDatabase(t)
+	outbox := NewOutbox(db)
+	mailer := &recordingMailer{}
+	relay := NewOutboxRelay(OutboxRelayParams{DB: db, Dialect: database.SQLiteDialect, Mailer: mailer})
+
+	errRollback := errors.New("rollback")
+	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := outbox.Enqueue(ctx, "discarded", "body", "a@email.com"); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	var id string
+	err = db.WithTransaction(ctx, func(ctx context.Context) error {
+		id, err = outbox.Enqueue(ctx, "welcome", "<p>hi</p>", "a@email.com", "b@email.com")
+		return err
+	})
+	require.NoError(t, err)
+
+	_, err = outbox.Enqueue(ctx, "no one", "body")
+	require.ErrorIs(t, err, ErrEmptyRecipients)
+
+	_, err = outbox.EnqueueMessage(ctx, &Message{To: []string{"not an address"}})
+	require.ErrorIs(t, err, ErrInvalidAddress)
+
+	processed, err := relay.ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, processed)
+	require.Equal(t, []*Message{{Subject: "welcome", HTML: "<p>hi</p>", To: []string{"a@email.com", "b@email.com"}}}, mailer.sent)
+	require.Equal(t, OutboxStatusSent, getOutboxRow(t, db, id).Status)
+
+	processed, err = relay.ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.Zero(t, processed)
+	require.Len(t, mailer.sent, 1)
+}
+
+func TestOutboxRelay_RetryAndDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	db := newTestOutboxDatabase(t)
+	outbox := NewOutbox(db)
+	mailer := &recordingMailer{err: ErrFailedToSendMail}
+
+	relay := NewOutboxRelay(OutboxRelayParams{
+		DB:             db,
+		Dialect:        database.SQLiteDialect,
+		Mailer:         mailer,
+		MaxAttempts:    3,
+		InitialBackoff: time.Minute,
+		MaxBackoff:     90 * time.Second,
+	})
+
+	now := time.Now()
+	outbox.now = func() time.Time { return now }
+	relay.now = func() time.Time { return now }
+
+	id, err := outbox.Enqueue(ctx, "subject", "body", "a@email.com")
+	require.NoError(t, err)
+
+	processed, err := relay.ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, processed)
+
+	row := getOutboxRow(t, db, id)
+	require.Equal(t, OutboxStatusPending, row.Status)
+	require.Equal(t, 1, row.Attempts)
+	require.Equal(t, ErrFailedToSendMail.Error(), row.LastError.String)
+
+	processed, err = relay.ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.Zero(t, processed, "message is backing off")
+
+	now = now.Add(time.Minute)
+	processed, err = relay.ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, processed)
+
+	now = now.Add(time.Minute)
+	processed, err = relay.ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.Zero(t, processed, "second backoff is capped at 90s")
+
+	now = now.Add(30 * time.Second)
+	processed, err = relay.ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, processed)
+
+	row = getOutboxRow(t, db, id)
+	require.Equal(t, OutboxStatusDead, row.Status)
+	require.Equal(t, 3, row.Attempts)
+
+	now = now.Add(time.Hour)
+	mailer.err = nil
+	processed, err = relay.ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.Zero(t, processed)
+	require.Empty(t, mailer.sent)
+}
+
+func TestOutboxRelay_Run(t *testing.T) {
+	db := newTestOutboxDatabase(t)
+	mailer := &recordingMailer{}
+	relay := NewOutboxRelay(OutboxRelayParams{
+		DB:           db,
+		Dialect:      database.SQLiteDialect,
+		Mailer:       mailer,
+		PollInterval: time.Millisecond,
+	})
+
+	_, err := NewOutbox(db).Enqueue(context.Background(), "subject", "body", "a@email.com")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, relay.Run(ctx), context.DeadlineExceeded)
+	require.Len(t, mailer.sent, 1)
+}
+
+type hookMailer struct {
+	recordingMailer
+	hook func()
+}
+
+func (m *hookMailer) SendMessage(message *Message) error {
+	if m.hook != nil {
+		m.hook()
+	}
+	return m.recordingMailer.SendMessage(message)
+}
+
+func TestOutboxRelay_Lease(t *testing.T) {
+	ctx := context.Background()
+	db := newTestOutboxDatabase(t)
+	outbox := NewOutbox(db)
+
+	now := time.Now()
+	outbox.now = func() time.Time { return now }
+
+	id, err := outbox.Enqueue(ctx, "subject", "body", "a@email.com")
+	require.NoError(t, err)
+
+	other := NewOutboxRelay(OutboxRelayParams{DB: db, Dialect: database.SQLiteDialect, Mailer: &recordingMailer{}})
+	other.now = func() time.Time { return now }
+
+	mailer := &hookMailer{}
+	mailer.hook = func() {
+		// The claim has committed, so the send runs outside any transaction
+		// and another relay skips the leased message.
+		require.Equal(t, OutboxStatusSending, getOutboxRow(t, db, id).Status)
+
+		processed, err := other.ProcessBatch(ctx)
+		require.NoError(t, err)
+		require.Zero(t, processed)
+	}
+
+	relay := NewOutboxRelay(OutboxRelayParams{
+		DB:            db,
+		Dialect:       database.SQLiteDialect,
+		Mailer:        mailer,
+		LeaseDuration: time.Minute,
+	})
+	relay.now = func() time.Time { return now }
+
+	processed, err := relay.ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, processed)
+	require.Len(t, mailer.sent, 1)
+	require.Equal(t, OutboxStatusSent, getOutboxRow(t, db, id).Status)
+
+	// A relay that dies after claiming leaves the message leased; it is
+	// claimed again once the lease expires, and the stale lease can no
+	// longer record an outcome.
+	id, err = outbox.Enqueue(ctx, "subject", "body", "b@email.com")
+	require.NoError(t, err)
+
+	claimed, err := relay.claim(ctx)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	processed, err = relay.ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.Zero(t, processed)
+
+	now = now.Add(time.Minute)
+	mailer.hook = nil
+
+	processed, err = relay.ProcessBatch(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, processed)
+	require.Len(t, mailer.sent, 2)
+
+	mailer.err = ErrFailedToSendMail
+	require.NoError(t, relay.deliver(ctx, claimed[0]))
+
+	// The lost lease counts as a failed attempt.
+	row := getOutboxRow(t, db, id)
+	require.Equal(t, OutboxStatusSent, row.Status)
+	require.Equal(t, 2, row.Attempts)
+}
+
+func TestOutboxRelay_ExpiredLeaseDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	db := newTestOutboxDatabase(t)
+	outbox := NewOutbox(db)
+
+	now := time.Now()
+	outbox.now = func() time.Time { return now }
+
+	id, err := outbox.Enqueue(ctx, "subject", "body", "a@email.com")
+	require.NoError(t, err)
+
+	mailer := &recordingMailer{}
+	relay := NewOutboxRelay(OutboxRelayParams{
+		DB:            db,
+		Dialect:       database.SQLiteDialect,
+		Mailer:        mailer,
+		MaxAttempts:   3,
+		LeaseDuration: time.Minute,
+	})
+	relay.now = func() time.Time { return now }
+
+	// A message that takes its relay down every time it is claimed is
+	// claimed again after each expired lease until it runs out of attempts.
+	for attempts := 0; attempts < 3; attempts++ {
+		claimed, err := relay.claim(ctx)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+		require.Equal(t, attempts, getOutboxRow(t, db, id).Attempts)
+
+		now = now.Add(time.Minute)
+	}
+
+	claimed, err := relay.claim(ctx)
+	require.NoError(t, err)
+	require.Empty(t, claimed)
+	require.Empty(t, mailer.sent)
+
+	row := getOutboxRow(t, db, id)
+	require.Equal(t, OutboxStatusDead, row.Status)
+	require.Equal(t, 3, row.Attempts)
+}
@@ -0,0 +1,375 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/v2code/b16/internal/logger"
+)
+
+const LOG_SMTP_PREFIX = "SMTP"
+
+var (
+	ErrStartTLSRequired = errors.New("smtp server does not support STARTTLS")
+	ErrClientClosed     = errors.New("smtp client is closed")
+	ErrAuthNotSupported = errors.New("smtp server does not support AUTH")
+)
+
+type TLSMode int
+
+const (
+	// TLSStartTLS upgrades the connection with STARTTLS and fails when the
+	// server does not offer it.
+	TLSStartTLS TLSMode = iota
+	// TLSImplicit speaks TLS from the first byte, usually on port 465.
+	TLSImplicit
+	// TLSNone sends everything in plaintext; only meant for local
+	// development servers.
+	TLSNone
+)
+
+type PooledClientParams struct {
+	TLSMode TLSMode
+	// TLSConfig is cloned for every connection; ServerName and RootCAs
+	// override its fields when set.
+	TLSConfig  *tls.Config
+	ServerName string
+	RootCAs    *x509.CertPool
+	// LocalName is sent in EHLO instead of "localhost".
+	LocalName string
+	// MaxConns bounds the open connections per address.
+	MaxConns int
+	// IdleTimeout closes pooled connections unused for longer.
+	IdleTimeout    time.Duration
+	DialTimeout    time.Duration
+	CommandTimeout time.Duration
+}
+
+// PooledClient is an SMTPClient that keeps authenticated connections open
+// between messages, per server address and smtp.Auth, so a connection is
+// only reused for sends made with the same Auth value it was authenticated
+// with; a connection found broken when reused is replaced transparently.
+type PooledClient struct {
+	params PooledClientParams
+
+	mu     sync.Mutex
+	pools  map[poolKey]*connectionPool
+	closed bool
+}
+
+// poolKey compares the smtp.Auth by identity: sends sharing connections
+// must pass the same value, as DefaultMailer does.
+type poolKey struct {
+	addr string
+	auth smtp.Auth
+}
+
+type connectionPool struct {
+	slots chan struct{}
+	idle  chan *pooledConnection
+}
+
+type pooledConnection struct {
+	conn     net.Conn
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+func NewPooledClient(params PooledClientParams) *PooledClient {
+	if params.MaxConns <= 0 {
+		params.MaxConns = 4
+	}
+	if params.IdleTimeout <= 0 {
+		params.IdleTimeout = 30 * time.Second
+	}
+	if params.DialTimeout <= 0 {
+		params.DialTimeout = 10 * time.Second
+	}
+	if params.CommandTimeout <= 0 {
+		params.CommandTimeout = 30 * time.Second
+	}
+
+	return &PooledClient{
+		params: params,
+		pools:  map[poolKey]*connectionPool{},
+	}
+}
+
+func (c *PooledClient) SendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	return c.SendMailContext(context.Background(), addr, a, from, to, msg)
+}
+
+// SendMailContext sends msg over a pooled connection, dialing one when none
+// is idle. ctx bounds the wait for a free connection as well as the SMTP
+// exchange, on top of the configured timeouts.
+func (c *PooledClient) SendMailContext(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	pool, err := c.pool(addr, a)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case pool.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-pool.slots }()
+
+	for {
+		conn, reused, err := c.acquire(ctx, pool, addr, a)
+		if err != nil {
+			return err
+		}
+
+		err = c.send(ctx, conn, from, to, msg, reused)
+		if err == nil {
+			c.release(pool, conn)
+			return nil
+		}
+
+		conn.client.Close()
+
+		if !errors.Is(err, errStaleConnection) {
+			return err
+		}
+
+		logger.Debug(LOG_SMTP_PREFIX, "Reconnecting broken connection to", addr)
+	}
+}
+
+// Close closes the idle connections and makes further sends fail.
+// Connections in use are closed once their message is sent.
+func (c *PooledClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+
+	for _, pool := range c.pools {
+		pool.closeIdle()
+	}
+
+	return nil
+}
+
+func (p *connectionPool) closeIdle() {
+	for {
+		select {
+		case conn := <-p.idle:
+			conn.client.Quit()
+		default:
+			return
+		}
+	}
+}
+
+// release returns conn to the pool, or quits it when the client was closed
+// meanwhile.
+func (c *PooledClient) release(pool *connectionPool, conn *pooledConnection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		conn.client.Quit()
+		return
+	}
+
+	conn.lastUsed = time.Now()
+	pool.idle <- conn
+}
+
+func (c *PooledClient) pool(addr string, a smtp.Auth) (*connectionPool, error) {
+	if a != nil && !reflect.TypeOf(a).Comparable() {
+		return nil, fmt.Errorf("smtp auth of type %T cannot be pooled, use a pointer", a)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+
+	key := poolKey{addr: addr, auth: a}
+
+	pool, ok := c.pools[key]
+	if !ok {
+		pool = &connectionPool{
+			slots: make(chan struct{}, c.params.MaxConns),
+			idle:  make(chan *pooledConnection, c.params.MaxConns),
+		}
+		c.pools[key] = pool
+	}
+
+	return pool, nil
+}
+
+// acquire returns an idle connection, dropping expired ones, or dials a new
+// one. reused tells whether the connection may have been broken meanwhile.
+func (c *PooledClient) acquire(ctx context.Context, pool *connectionPool, addr string, a smtp.Auth) (*pooledConnection, bool, error) {
+	for {
+		select {
+		case conn := <-pool.idle:
+			if time.Since(conn.lastUsed) > c.params.IdleTimeout {
+				conn.client.Close()
+				continue
+			}
+			return conn, true, nil
+		default:
+		}
+
+		conn, err := c.dial(ctx, addr, a)
+		return conn, false, err
+	}
+}
+
+var errStaleConnection = errors.New("stale smtp connection")
+
+func (c *PooledClient) send(ctx context.Context, conn *pooledConnection, from string, to []string, msg []byte, reused bool) error {
+	stop := c.deadline(ctx, conn.conn)
+	defer stop()
+
+	if reused {
+		if err := conn.client.Reset(); err != nil {
+			return fmt.Errorf("%w: %w", errStaleConnection, err)
+		}
+	}
+
+	if err := conn.client.Mail(from); err != nil {
+		return err
+	}
+
+	for _, recipient := range to {
+		if err := conn.client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	w, err := conn.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func (c *PooledClient) dial(ctx context.Context, addr string, a smtp.Auth) (*pooledConnection, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, c.params.DialTimeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(dialCtx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := c.tlsConfig(host)
+
+	if c.params.TLSMode == TLSImplicit {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(dialCtx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	stop := c.deadline(dialCtx, conn)
+	defer stop()
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := c.handshake(client, tlsConfig, a); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &pooledConnection{conn: conn, client: client}, nil
+}
+
+func (c *PooledClient) handshake(client *smtp.Client, tlsConfig *tls.Config, a smtp.Auth) error {
+	if c.params.LocalName != "" {
+		if err := client.Hello(c.params.LocalName); err != nil {
+			return err
+		}
+	}
+
+	if c.params.TLSMode == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return ErrStartTLSRequired
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if a == nil {
+		return nil
+	}
+
+	// Like smtp.SendMail, refuse to go on unauthenticated when the server
+	// does not offer AUTH.
+	if ok, _ := client.Extension("AUTH"); !ok {
+		return ErrAuthNotSupported
+	}
+
+	return client.Auth(authForConnection(a))
+}
+
+func (c *PooledClient) tlsConfig(host string) *tls.Config {
+	config := &tls.Config{}
+	if c.params.TLSConfig != nil {
+		config = c.params.TLSConfig.Clone()
+	}
+
+	if c.params.ServerName != "" {
+		config.ServerName = c.params.ServerName
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	if c.params.RootCAs != nil {
+		config.RootCAs = c.params.RootCAs
+	}
+
+	return config
+}
+
+// deadline bounds the I/O on conn by CommandTimeout and ctx, interrupting
+// it when ctx is canceled. The returned func releases the deadline.
+func (c *PooledClient) deadline(ctx context.Context, conn net.Conn) func() {
+	deadline := time.Now().Add(c.params.CommandTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+
+	return func() {
+		stop()
+		conn.SetDeadline(time.Time{})
+	}
+}
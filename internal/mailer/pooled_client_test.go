@@ -0,0 +1,220 @@
+package mailer
+
+import (
+	"context"
+	"net/smtp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sendTestMail(t *testing.T, client *PooledClient, server *fakeSMTPServer, auth smtp.Auth, subject string) error {
+	t.Helper()
+
+	message := &Message{To: []string{"to@email.com"}, Subject: subject, Text: "hello"}
+	envelope, err := message.Build("b16@email.com", time.Now())
+	require.NoError(t, err)
+
+	return client.SendMail(server.Addr(), auth, envelope.From, envelope.To, envelope.Data)
+}
+
+type TestPooledClientTLSParams struct {
+	Name        string
+	Mode        TLSMode
+	ImplicitTLS bool
+	StartTLS    bool
+	ExpectedTLS bool
+	ExpectedErr error
+}
+
+func TestPooledClient_TLSModes(t *testing.T) {
+	cases := []TestPooledClientTLSParams{
+		{
+			Name:        "plaintext",
+			Mode:        TLSNone,
+			ExpectedTLS: false,
+		},
+		{
+			Name:        "starttls",
+			Mode:        TLSStartTLS,
+			StartTLS:    true,
+			ExpectedTLS: true,
+		},
+		{
+			Name:        "starttls required but not offered",
+			Mode:        TLSStartTLS,
+			ExpectedErr: ErrStartTLSRequired,
+		},
+		{
+			Name:        "implicit tls",
+			Mode:        TLSImplicit,
+			ImplicitTLS: true,
+			ExpectedTLS: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			server, rootCAs := newFakeSMTPServer(t, tt.ImplicitTLS, func(s *fakeSMTPServer) {
+				s.StartTLS = tt.StartTLS
+				s.AuthMechanisms = []string{"PLAIN"}
+				s.Username = "user"
+				s.Password = "secret"
+			})
+
+			client := NewPooledClient(PooledClientParams{TLSMode: tt.Mode, RootCAs: rootCAs})
+			defer client.Close()
+
+			auth := smtp.PlainAuth("", "user", "secret", "127.0.0.1")
+			err := sendTestMail(t, client, server, auth, "Hello")
+
+			if tt.ExpectedErr != nil {
+				require.ErrorIs(t, err, tt.ExpectedErr)
+				require.Empty(t, server.Messages())
+				return
+			}
+
+			require.NoError(t, err)
+
+			messages := server.Messages()
+			require.Len(t, messages, 1)
+			require.Equal(t, "b16@email.com", messages[0].From)
+			require.Equal(t, []string{"to@email.com"}, messages[0].To)
+			require.Equal(t, "user", messages[0].Username)
+			require.Equal(t, tt.ExpectedTLS, messages[0].TLS)
+			require.Equal(t, "Hello", readSMTPMessageHeader(t, messages[0].Data, "Subject"))
+		})
+	}
+}
+
+func TestPooledClient_UntrustedCertificate(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, true, nil)
+
+	client := NewPooledClient(PooledClientParams{TLSMode: TLSImplicit})
+	defer client.Close()
+
+	require.Error(t, sendTestMail(t, client, server, nil, "Hello"))
+}
+
+func TestPooledClient_ReusesConnections(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, false, nil)
+
+	client := NewPooledClient(PooledClientParams{TLSMode: TLSNone})
+	defer client.Close()
+
+	for range 3 {
+		require.NoError(t, sendTestMail(t, client, server, nil, "Hello"))
+	}
+
+	require.Len(t, server.Messages(), 3)
+	require.Equal(t, 1, server.Connections())
+}
+
+func TestPooledClient_PoolsPerAuth(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, false, func(s *fakeSMTPServer) {
+		s.AuthMechanisms = []string{"PLAIN"}
+		s.Username = "user"
+		s.Password = "secret"
+	})
+
+	client := NewPooledClient(PooledClientParams{TLSMode: TLSNone})
+	defer client.Close()
+
+	first := smtp.PlainAuth("", "user", "secret", "127.0.0.1")
+	second := smtp.PlainAuth("", "user", "secret", "127.0.0.1")
+
+	require.NoError(t, sendTestMail(t, client, server, first, "Hello"))
+	require.NoError(t, sendTestMail(t, client, server, first, "Hello"))
+	require.NoError(t, sendTestMail(t, client, server, second, "Hello"))
+	require.NoError(t, sendTestMail(t, client, server, nil, "Hello"))
+
+	messages := server.Messages()
+	require.Len(t, messages, 4)
+	require.Equal(t, "user", messages[2].Username)
+	require.Empty(t, messages[3].Username, "an unauthenticated send does not reuse an authenticated connection")
+	require.Equal(t, 3, server.Connections())
+}
+
+func TestPooledClient_AuthNotSupported(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, false, nil)
+
+	client := NewPooledClient(PooledClientParams{TLSMode: TLSNone})
+	defer client.Close()
+
+	auth := smtp.PlainAuth("", "user", "secret", "127.0.0.1")
+	require.ErrorIs(t, sendTestMail(t, client, server, auth, "Hello"), ErrAuthNotSupported)
+	require.Empty(t, server.Messages())
+}
+
+func TestPooledClient_Reconnects(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, false, func(s *fakeSMTPServer) {
+		s.CloseAfterMessage = true
+	})
+
+	client := NewPooledClient(PooledClientParams{TLSMode: TLSNone})
+	defer client.Close()
+
+	for range 3 {
+		require.NoError(t, sendTestMail(t, client, server, nil, "Hello"))
+	}
+
+	require.Len(t, server.Messages(), 3)
+	require.Equal(t, 3, server.Connections())
+}
+
+func TestPooledClient_MaxConns(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, false, nil)
+
+	client := NewPooledClient(PooledClientParams{TLSMode: TLSNone, MaxConns: 2})
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, sendTestMail(t, client, server, nil, "Hello"))
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, server.Messages(), 10)
+	require.LessOrEqual(t, server.Connections(), 2)
+}
+
+func TestPooledClient_Timeouts(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, false, func(s *fakeSMTPServer) {
+		s.Silent = true
+	})
+
+	client := NewPooledClient(PooledClientParams{TLSMode: TLSNone, CommandTimeout: 50 * time.Millisecond})
+	defer client.Close()
+
+	start := time.Now()
+	require.Error(t, sendTestMail(t, client, server, nil, "Hello"))
+	require.Less(t, time.Since(start), time.Second)
+
+	client = NewPooledClient(PooledClientParams{TLSMode: TLSNone})
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start = time.Now()
+	err := client.SendMailContext(ctx, server.Addr(), nil, "b16@email.com", []string{"to@email.com"}, []byte("hello"))
+	require.Error(t, err)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestPooledClient_Close(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, false, nil)
+
+	client := NewPooledClient(PooledClientParams{TLSMode: TLSNone})
+	require.NoError(t, sendTestMail(t, client, server, nil, "Hello"))
+	require.NoError(t, client.Close())
+
+	require.ErrorIs(t, sendTestMail(t, client, server, nil, "Hello"), ErrClientClosed)
+}
@@ -0,0 +1,267 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"github.com/v2code/b16/internal/logger"
+)
+
+const LOG_QUEUE_PREFIX = "EMAIL QUEUE"
+
+var (
+	ErrQueueFull     = errors.New("mail queue is full")
+	ErrMailerClosed  = errors.New("mailer is closed")
+	ErrEmailsPending = errors.New("emails still pending at shutdown")
+)
+
+// QueueFullPolicy selects what QueuedMailer.Send does when the queue is full.
+type QueueFullPolicy int
+
+const (
+	// QueueBlock waits for room in the queue.
+	QueueBlock QueueFullPolicy = iota
+	// QueueDrop discards the email, logging it, and returns nil.
+	QueueDrop
+	// QueueError returns ErrQueueFull.
+	QueueError
+)
+
+type QueuedMailerParams struct {
+	QueueSize  int
+	Workers    int
+	FullPolicy QueueFullPolicy
+	// MaxAttempts counts the first attempt; only errors accepted by
+	// Retryable are retried, waiting RetryBackoff times the attempt number.
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	// Retryable defaults to IsTransientError.
+	Retryable func(err error) bool
+	// Persist receives the emails still queued when the Shutdown deadline
+	// passes, e.g. to store them in an Outbox. They are lost when nil.
+	Persist func(pending []*Message) error
+}
+
+// QueuedMailer is a Mailer that returns as soon as the email is queued and
+// sends it from a pool of workers through the wrapped Mailer.
+type QueuedMailer struct {
+	mailer       Mailer
+	queue        chan *Message
+	fullPolicy   QueueFullPolicy
+	maxAttempts  int
+	retryBackoff time.Duration
+	retryable    func(err error) bool
+	persist      func(pending []*Message) error
+
+	mu      sync.Mutex
+	closed  bool
+	senders sync.WaitGroup
+	workers sync.WaitGroup
+	abort   chan struct{}
+	pending []*Message
+}
+
+func NewQueuedMailer(params QueuedMailerParams, mailer Mailer) *QueuedMailer {
+	m := &QueuedMailer{
+		mailer:       mailer,
+		fullPolicy:   params.FullPolicy,
+		maxAttempts:  params.MaxAttempts,
+		retryBackoff: params.RetryBackoff,
+		retryable:    params.Retryable,
+		persist:      params.Persist,
+		abort:        make(chan struct{}),
+	}
+
+	queueSize := params.QueueSize
+	if queueSize <= 0 {
+		queueSize = 100
+	}
+	m.queue = make(chan *Message, queueSize)
+
+	workers := params.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	if m.maxAttempts <= 0 {
+		m.maxAttempts = 3
+	}
+	if m.retryBackoff <= 0 {
+		m.retryBackoff = time.Second
+	}
+	if m.retryable == nil {
+		m.retryable = IsTransientError
+	}
+
+	for range workers {
+		m.workers.Add(1)
+		go m.work()
+	}
+
+	return m
+}
+
+// IsTransientError reports whether err is a 4xx SMTP reply, a network
+// error or a temporary HTTPStatusError, which are worth retrying.
+func IsTransientError(err error) bool {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 400 && protoErr.Code < 500
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func (m *QueuedMailer) Send(subject string, body string, to ...string) error {
+	return m.SendMessage(&Message{
+		To:      to,
+		Subject: subject,
+		HTML:    body,
+	})
+}
+
+// SendMessage validates and queues message; sending errors are only logged.
+func (m *QueuedMailer) SendMessage(message *Message) error {
+	if err := message.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrMailerClosed
+	}
+	m.senders.Add(1)
+	m.mu.Unlock()
+
+	defer m.senders.Done()
+
+	switch m.fullPolicy {
+	case QueueDrop:
+		select {
+		case m.queue <- message:
+		default:
+			logger.Warn(LOG_QUEUE_PREFIX, "Queue full, dropping email to", message.To)
+		}
+		return nil
+	case QueueError:
+		select {
+		case m.queue <- message:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	default:
+		select {
+		case m.queue <- message:
+			return nil
+		case <-m.abort:
+			return ErrMailerClosed
+		}
+	}
+}
+
+// Shutdown stops accepting emails and waits for the workers to send the
+// queued ones. When ctx ends first, workers stop after their current send
+// and the remaining emails go to Persist; ErrEmailsPending is returned
+// unless they were all persisted.
+func (m *QueuedMailer) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrMailerClosed
+	}
+	m.closed = true
+	m.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		m.senders.Wait()
+		close(m.queue)
+		m.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	close(m.abort)
+	<-drained
+
+	for email := range m.queue {
+		m.pending = append(m.pending, email)
+	}
+
+	if len(m.pending) == 0 {
+		return nil
+	}
+
+	if m.persist == nil {
+		logger.Error(LOG_QUEUE_PREFIX, "Emails lost at shutdown", len(m.pending))
+		return ErrEmailsPending
+	}
+
+	if err := m.persist(m.pending); err != nil {
+		logger.Error(LOG_QUEUE_PREFIX, "Error persisting pending emails", err.Error())
+		return errors.Join(ErrEmailsPending, err)
+	}
+
+	return nil
+}
+
+func (m *QueuedMailer) work() {
+	defer m.workers.Done()
+
+	for {
+		select {
+		case <-m.abort:
+			return
+		default:
+		}
+
+		select {
+		case <-m.abort:
+			return
+		case email, ok := <-m.queue:
+			if !ok {
+				return
+			}
+			m.deliver(email)
+		}
+	}
+}
+
+func (m *QueuedMailer) deliver(email *Message) {
+	for attempt := 1; ; attempt++ {
+		err := m.mailer.SendMessage(email)
+		if err == nil {
+			return
+		}
+
+		if attempt >= m.maxAttempts || !m.retryable(err) {
+			logger.Error(LOG_QUEUE_PREFIX, "Giving up on email to", email.To, "attempts", attempt, "error", err.Error())
+			return
+		}
+
+		select {
+		case <-m.abort:
+			m.mu.Lock()
+			m.pending = append(m.pending, email)
+			m.mu.Unlock()
+			return
+		case <-time.After(m.retryBackoff * time.Duration(attempt)):
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package mailer
+
+import (
+	"context"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// gatedMailer blocks every Send until gate is closed, when set, and fails
+// with the queued errors before succeeding.
+type gatedMailer struct {
+	mu       sync.Mutex
+	gate     chan struct{}
+	errs     []error
+	attempts int
+	sent     []string
+}
+
+func (m *gatedMailer) Send(subject string, body string, to ...string) error {
+	return m.SendMessage(&Message{To: to, Subject: subject, HTML: body})
+}
+
+func (m *gatedMailer) SendMessage(message *Message) error {
+	if m.gate != nil {
+		<-m.gate
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.attempts++
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return err
+	}
+
+	m.sent = append(m.sent, message.Subject)
+	return nil
+}
+
+func (m *gatedMailer) Sent() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string{}, m.sent...)
+}
+
+func TestQueuedMailer_SendAndShutdown(t *testing.T) {
+	mailer := &gatedMailer{}
+	m := NewQueuedMailer(QueuedMailerParams{Workers: 3}, mailer)
+
+	for _, subject := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, m.Send(subject, "body", "a@email.com"))
+	}
+
+	require.NoError(t, m.Shutdown(context.Background()))
+	require.ElementsMatch(t, []string{"a", "b", "c", "d"}, mailer.Sent())
+
+	require.ErrorIs(t, m.Send("e", "body"), ErrEmptyRecipients)
+	require.ErrorIs(t, m.Send("e", "body", "a@email.com"), ErrMailerClosed)
+	require.ErrorIs(t, m.Shutdown(context.Background()), ErrMailerClosed)
+}
+
+type TestQueuedMailerRetryParams struct {
+	Name             string
+	Errs             []error
+	ExpectedAttempts int
+	ExpectedSent     []string
+}
+
+func TestQueuedMailer_Retry(t *testing.T) {
+	transient := &textproto.Error{Code: 451, Msg: "try again later"}
+	permanent := &textproto.Error{Code: 550, Msg: "mailbox unavailable"}
+
+	cases := []TestQueuedMailerRetryParams{
+		{
+			Name:             "retries transient errors",
+			Errs:             []error{transient, transient},
+			ExpectedAttempts: 3,
+			ExpectedSent:     []string{"subject"},
+		},
+		{
+			Name:             "gives up after max attempts",
+			Errs:             []error{transient, transient, transient},
+			ExpectedAttempts: 3,
+			ExpectedSent:     []string{},
+		},
+		{
+			Name:             "does not retry permanent errors",
+			Errs:             []error{permanent},
+			ExpectedAttempts: 1,
+			ExpectedSent:     []string{},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			mailer := &gatedMailer{errs: tt.Errs}
+			m := NewQueuedMailer(QueuedMailerParams{MaxAttempts: 3, RetryBackoff: time.Millisecond}, mailer)
+
+			require.NoError(t, m.Send("subject", "body", "a@email.com"))
+			require.NoError(t, m.Shutdown(context.Background()))
+
+			require.Equal(t, tt.ExpectedAttempts, mailer.attempts)
+			require.Equal(t, tt.ExpectedSent, mailer.Sent())
+		})
+	}
+}
+
+type TestQueueFullPolicyParams struct {
+	Name          string
+	Policy        QueueFullPolicy
+	ExpectedError error
+	ExpectedSent  []string
+}
+
+func TestQueuedMailer_FullPolicy(t *testing.T) {
+	cases := []TestQueueFullPolicyParams{
+		{
+			Name:          "error",
+			Policy:        QueueError,
+			ExpectedError: ErrQueueFull,
+			ExpectedSent:  []string{"in flight", "queued"},
+		},
+		{
+			Name:         "drop",
+			Policy:       QueueDrop,
+			ExpectedSent: []string{"in flight", "queued"},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			mailer := &gatedMailer{gate: make(chan struct{})}
+			m := NewQueuedMailer(QueuedMailerParams{QueueSize: 1, FullPolicy: tt.Policy}, mailer)
+
+			require.NoError(t, m.Send("in flight", "body", "a@email.com"))
+			require.Eventually(t, func() bool { return len(m.queue) == 0 }, time.Second, time.Millisecond)
+			require.NoError(t, m.Send("queued", "body", "a@email.com"))
+
+			err := m.Send("overflow", "body", "a@email.com")
+			if tt.ExpectedError != nil {
+				require.ErrorIs(t, err, tt.ExpectedError)
+			} else {
+				require.NoError(t, err)
+			}
+
+			close(mailer.gate)
+			require.NoError(t, m.Shutdown(context.Background()))
+			require.Equal(t, tt.ExpectedSent, mailer.Sent())
+		})
+	}
+}
+
+func TestQueuedMailer_Block(t *testing.T) {
+	mailer := &gatedMailer{gate: make(chan struct{})}
+	m := NewQueuedMailer(QueuedMailerParams{QueueSize: 1}, mailer)
+
+	require.NoError(t, m.Send("in flight", "body", "a@email.com"))
+	require.Eventually(t, func() bool { return len(m.queue) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, m.Send("queued", "body", "a@email.com"))
+
+	sent := make(chan error)
+	go func() {
+		sent <- m.Send("blocked", "body", "a@email.com")
+	}()
+
+	select {
+	case <-sent:
+		t.Fatal("Send returned while the queue was full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(mailer.gate)
+	require.NoError(t, <-sent)
+	require.NoError(t, m.Shutdown(context.Background()))
+	require.Equal(t, []string{"in flight", "queued", "blocked"}, mailer.Sent())
+}
+
+func TestQueuedMailer_ShutdownDeadline(t *testing.T) {
+	mailer := &gatedMailer{gate: make(chan struct{})}
+
+	var persisted []*Message
+	m := NewQueuedMailer(QueuedMailerParams{
+		QueueSize: 5,
+		Persist: func(pending []*Message) error {
+			persisted = pending
+			return nil
+		},
+	}, mailer)
+
+	require.NoError(t, m.Send("in flight", "body", "a@email.com"))
+	require.Eventually(t, func() bool { return len(m.queue) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, m.Send("pending 1", "body", "a@email.com"))
+	require.NoError(t, m.Send("pending 2", "body", "b@email.com"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	go func() {
+		<-m.abort
+		close(mailer.gate)
+	}()
+
+	require.NoError(t, m.Shutdown(ctx))
+	require.Equal(t, []string{"in flight"}, mailer.Sent())
+	require.Equal(t, []*Message{
+		{Subject: "pending 1", HTML: "body", To: []string{"a@email.com"}},
+		{Subject: "pending 2", HTML: "body", To: []string{"b@email.com"}},
+	}, persisted)
+}
@@ -0,0 +1,198 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// RecordedMail is a message captured by RecordingClient, with helpers to
+// inspect the raw data.
+type RecordedMail struct {
+	Addr string
+	From string
+	To   []string
+	Data []byte
+}
+
+// Header returns the named header with RFC 2047 words decoded.
+func (m RecordedMail) Header(key string) string {
+	message, err := mail.ReadMessage(bytes.NewReader(m.Data))
+	if err != nil {
+		return ""
+	}
+
+	value := message.Header.Get(key)
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(value); err == nil {
+		return decoded
+	}
+	return value
+}
+
+func (m RecordedMail) Subject() string {
+	return m.Header("Subject")
+}
+
+// Body returns the decoded content of the first part of the given media
+// type, e.g. "text/html", or an empty string when there is none.
+func (m RecordedMail) Body(mediaType string) string {
+	var body string
+
+	m.walk(func(header textproto.MIMEHeader, content []byte) bool {
+		partType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+		if partType == mediaType && !strings.HasPrefix(header.Get("Content-Disposition"), "attachment") {
+			body = string(content)
+			return false
+		}
+		return true
+	})
+
+	return body
+}
+
+// Attachments returns the regular and inline attachments of the message.
+func (m RecordedMail) Attachments() []Attachment {
+	var attachments []Attachment
+
+	m.walk(func(header textproto.MIMEHeader, content []byte) bool {
+		disposition, params, err := mime.ParseMediaType(header.Get("Content-Disposition"))
+		if err != nil || (disposition != "attachment" && disposition != "inline") {
+			return true
+		}
+
+		attachments = append(attachments, Attachment{
+			Filename:    params["filename"],
+			ContentType: header.Get("Content-Type"),
+			ContentID:   strings.Trim(header.Get("Content-ID"), "<>"),
+			Content:     content,
+		})
+		return true
+	})
+
+	return attachments
+}
+
+// walk calls fn with every decoded leaf part until it returns false.
+func (m RecordedMail) walk(fn func(header textproto.MIMEHeader, content []byte) bool) {
+	message, err := mail.ReadMessage(bytes.NewReader(m.Data))
+	if err != nil {
+		return
+	}
+
+	walkPart(textproto.MIMEHeader(message.Header), message.Body, fn)
+}
+
+func walkPart(header textproto.MIMEHeader, body io.Reader, fn func(header textproto.MIMEHeader, content []byte) bool) bool {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err == nil && strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err != nil {
+				return true
+			}
+			if !walkPart(part.Header, part, fn) {
+				return false
+			}
+		}
+	}
+
+	var decoded io.Reader = body
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		decoded = quotedprintable.NewReader(body)
+	case "base64":
+		decoded = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	content, err := io.ReadAll(decoded)
+	if err != nil {
+		return true
+	}
+
+	return fn(header, content)
+}
+
+// RecordingClient is an SMTPClient that keeps messages in memory instead of
+// sending them, for tests.
+type RecordingClient struct {
+	mu    sync.Mutex
+	mails []RecordedMail
+	err   error
+}
+
+func NewRecordingClient() *RecordingClient {
+	return &RecordingClient{}
+}
+
+func (c *RecordingClient) SendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+
+	c.mails = append(c.mails, RecordedMail{
+		Addr: addr,
+		From: from,
+		To:   slices.Clone(to),
+		Data: slices.Clone(msg),
+	})
+	return nil
+}
+
+// FailWith makes the next sends return err, until called with nil.
+func (c *RecordingClient) FailWith(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func (c *RecordingClient) Mails() []RecordedMail {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.mails)
+}
+
+// Last returns the most recent message.
+func (c *RecordingClient) Last() (RecordedMail, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.mails) == 0 {
+		return RecordedMail{}, false
+	}
+	return c.mails[len(c.mails)-1], true
+}
+
+// SentTo returns the messages whose envelope includes address, Bcc
+// included.
+func (c *RecordingClient) SentTo(address string) []RecordedMail {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var mails []RecordedMail
+	for _, m := range c.mails {
+		if slices.ContainsFunc(m.To, func(to string) bool { return strings.EqualFold(to, address) }) {
+			mails = append(mails, m)
+		}
+	}
+	return mails
+}
+
+func (c *RecordingClient) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mails = nil
+	c.err = nil
+}
@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordingClient(t *testing.T) {
+	client := NewRecordingClient()
+
+	message := &Message{
+		To:      []string{"to@email.com"},
+		Subject: "Relatório de março",
+		HTML:    `<p>Olá, <img src="cid:logo"></p>`,
+		Text:    "Olá",
+	}
+	message.Attach("report.txt", []byte("report"))
+	message.Embed("logo", "logo.png", []byte("png"))
+
+	envelope, err := message.Build("b16@email.com", time.Now())
+	require.NoError(t, err)
+	require.NoError(t, client.SendMail("localhost:25", nil, envelope.From, envelope.To, envelope.Data))
+
+	sent, ok := client.Last()
+	require.True(t, ok)
+	assert.Equal(t, "Relatório de março", sent.Subject())
+	assert.Equal(t, "Olá", sent.Body("text/plain"))
+	assert.Equal(t, `<p>Olá, <img src="cid:logo"></p>`, sent.Body("text/html"))
+	assert.Empty(t, sent.Body("application/json"))
+
+	attachments := sent.Attachments()
+	require.Len(t, attachments, 2)
+	assert.Equal(t, "logo", attachments[0].ContentID)
+	assert.Equal(t, []byte("png"), attachments[0].Content)
+	assert.Equal(t, "report.txt", attachments[1].Filename)
+	assert.Equal(t, []byte("report"), attachments[1].Content)
+
+	assert.Len(t, client.SentTo("TO@email.com"), 1)
+	assert.Empty(t, client.SentTo("other@email.com"))
+
+	errSend := errors.New("send failed")
+	client.FailWith(errSend)
+	assert.ErrorIs(t, client.SendMail("localhost:25", nil, envelope.From, envelope.To, envelope.Data), errSend)
+	assert.Len(t, client.Mails(), 1)
+
+	client.Reset()
+	assert.Empty(t, client.Mails())
+	_, ok = client.Last()
+	assert.False(t, ok)
+	assert.NoError(t, client.SendMail("localhost:25", nil, envelope.From, envelope.To, envelope.Data))
+}
@@ -0,0 +1,326 @@
+package mailer
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSMTPMessage struct {
+	From     string
+	To       []string
+	Data     string
+	TLS      bool
+	Username string
+}
+
+// fakeSMTPServer is a minimal in-process SMTP server for client tests.
+type fakeSMTPServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+
+	StartTLS bool
+	// AuthMechanisms are advertised in EHLO; the credentials below are
+	// accepted by each of them.
+	AuthMechanisms []string
+	Username       string
+	Password       string
+	// CloseAfterMessage drops the connection after each message, like a
+	// server closing idle connections.
+	CloseAfterMessage bool
+	// Silent accepts connections without ever greeting.
+	Silent bool
+
+	mu          sync.Mutex
+	messages    []fakeSMTPMessage
+	connections int
+	wg          sync.WaitGroup
+}
+
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake smtp"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// newFakeSMTPServer starts a server; with implicitTLS the listener speaks
+// TLS from the start. The returned pool trusts the server certificate.
+func newFakeSMTPServer(t *testing.T, implicitTLS bool, configure func(s *fakeSMTPServer)) (*fakeSMTPServer, *x509.CertPool) {
+	t.Helper()
+
+	cert, pool := newTestCertificate(t)
+
+	s := &fakeSMTPServer{
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+	if configure != nil {
+		configure(s)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	if implicitTLS {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go s.serve(implicitTLS)
+
+	t.Cleanup(func() {
+		listener.Close()
+		s.wg.Wait()
+	})
+
+	return s, pool
+}
+
+func (s *fakeSMTPServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeSMTPServer) Messages() []fakeSMTPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeSMTPMessage{}, s.messages...)
+}
+
+func (s *fakeSMTPServer) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+func (s *fakeSMTPServer) serve(implicitTLS bool) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.connections++
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn, implicitTLS)
+		}()
+	}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn, isTLS bool) {
+	if s.Silent {
+		io.Copy(io.Discard, conn)
+		return
+	}
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake ESMTP")
+
+	var (
+		message  fakeSMTPMessage
+		username string
+	)
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			lines := []string{"fake"}
+			if s.StartTLS && !isTLS {
+				lines = append(lines, "STARTTLS")
+			}
+			if len(s.AuthMechanisms) > 0 {
+				lines = append(lines, "AUTH "+strings.Join(s.AuthMechanisms, " "))
+			}
+			lines = append(lines, "8BITMIME")
+
+			for i, l := range lines {
+				separator := "-"
+				if i == len(lines)-1 {
+					separator = " "
+				}
+				text.PrintfLine("250%s%s", separator, l)
+			}
+		case "STARTTLS":
+			text.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			isTLS = true
+		case "AUTH":
+			user, ok := s.authenticate(text, arg)
+			if !ok {
+				text.PrintfLine("535 authentication failed")
+				continue
+			}
+			username = user
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			message = fakeSMTPMessage{
+				From:     strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>"),
+				TLS:      isTLS,
+				Username: username,
+			}
+			if i := strings.Index(message.From, "> "); i >= 0 {
+				message.From = message.From[:i]
+			}
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			message.To = append(message.To, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			message.Data = string(data)
+
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+
+			text.PrintfLine("250 queued")
+			if s.CloseAfterMessage {
+				return
+			}
+		case "RSET", "NOOP":
+			text.PrintfLine("250 ok")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// authenticate runs the exchange of the mechanism named in arg and returns
+// the authenticated user.
+func (s *fakeSMTPServer) authenticate(text *textproto.Conn, arg string) (string, bool) {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+
+	challenge := func(prompt string) (string, bool) {
+		text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, err := text.ReadLine()
+		if err != nil {
+			return "", false
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		return string(decoded), err == nil
+	}
+
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		response := ""
+		if initial == "" {
+			var ok bool
+			if response, ok = challenge(""); !ok {
+				return "", false
+			}
+		} else {
+			decoded, err := base64.StdEncoding.DecodeString(initial)
+			if err != nil {
+				return "", false
+			}
+			response = string(decoded)
+		}
+
+		parts := strings.Split(response, "\x00")
+		return s.Username, len(parts) == 3 && parts[1] == s.Username && parts[2] == s.Password
+	case "LOGIN":
+		username, ok := challenge("Username:")
+		if !ok {
+			return "", false
+		}
+		password, ok := challenge("Password:")
+		return username, ok && username == s.Username && password == s.Password
+	case "CRAM-MD5":
+		nonce := "<1234.5678@fake>"
+		response, ok := challenge(nonce)
+		if !ok {
+			return "", false
+		}
+
+		mac := hmac.New(md5.New, []byte(s.Password))
+		mac.Write([]byte(nonce))
+		return s.Username, response == s.Username+" "+hex.EncodeToString(mac.Sum(nil))
+	case "XOAUTH2":
+		response, err := base64.StdEncoding.DecodeString(initial)
+		if err == nil && string(response) == "user="+s.Username+"\x01auth=Bearer "+s.Password+"\x01\x01" {
+			return s.Username, true
+		}
+
+		challenge(`{"status":"401"}`)
+		return "", false
+	}
+
+	return "", false
+}
+
+// readSMTPMessageHeader returns a header of the raw message data.
+func readSMTPMessageHeader(t *testing.T, data string, key string) string {
+	t.Helper()
+
+	header, err := textproto.NewReader(bufio.NewReader(strings.NewReader(data))).ReadMIMEHeader()
+	require.NoError(t, err)
+	return header.Get(key)
+}
@@ -2,27 +2,351 @@ package mailer
 
 import (
 	"bytes"
-	_ "embed"
+	"embed"
+	"errors"
 	"fmt"
-	"text/template"
+	"html"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
 )
 
-//go:embed templates/verification_code_template.html
-var verificationCodeTemplate string
+//go:embed templates
+var Templates embed.FS
 
-func RenderVerificationCodeTemplate(code string) string {
-	tmpl, _ := RenderTemplate("verification_code", verificationCodeTemplate, map[string]string{
-		"Code": code,
+var (
+	ErrTemplateNotFound    = errors.New("template not found")
+	ErrInvalidTemplateData = errors.New("invalid template data")
+)
+
+// DefaultLocale is the language of templates without a locale suffix.
+const DefaultLocale = "pt-BR"
+
+// templateFilePattern matches <name>.html, <name>.txt and their localized
+// variants, e.g. verification_code.en.html.
+var templateFilePattern = regexp.MustCompile(`^([a-z0-9_]+)(?:\.([A-Za-z]{2,3}(?:[-_][A-Za-z0-9]+)*))?\.(html|txt)$`)
+
+// TemplateError reports which template and locale failed to render.
+type TemplateError struct {
+	Name   string
+	Locale string
+	Err    error
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("template %s (%s): %v", e.Name, e.Locale, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// templateFuncs are available to every template. cid builds the URL of an
+// inline attachment added with Message.Embed: <img src="{{cid "logo"}}">.
+// duration spells a time.Duration in the given language for sentences like
+// "expires in {{duration "en" .ExpiresIn}}".
+var templateFuncs = map[string]any{
+	"cid": func(contentID string) htmltemplate.URL {
+		return htmltemplate.URL("cid:" + contentID)
+	},
+	"duration": formatDuration,
+}
+
+type durationUnits struct {
+	hour, hours, minute, minutes, and string
+}
+
+var durationLanguages = map[string]durationUnits{
+	"en": {hour: "hour", hours: "hours", minute: "minute", minutes: "minutes", and: "and"},
+	"pt": {hour: "hora", hours: "horas", minute: "minuto", minutes: "minutos", and: "e"},
+}
+
+// formatDuration writes d in whole hours and minutes, e.g. "1 hour and 30
+// minutes". Seconds are dropped, so d must be at least a minute.
+func formatDuration(language string, d time.Duration) (string, error) {
+	units, ok := durationLanguages[language]
+	if !ok {
+		return "", fmt.Errorf("unsupported duration language %q", language)
+	}
+	if d < time.Minute {
+		return "", fmt.Errorf("duration %s is shorter than a minute", d)
+	}
+
+	plural := func(n int, one, many string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, one)
+		}
+		return fmt.Sprintf("%d %s", n, many)
+	}
+
+	hours, minutes := int(d/time.Hour), int(d%time.Hour/time.Minute)
+
+	switch {
+	case hours == 0:
+		return plural(minutes, units.minute, units.minutes), nil
+	case minutes == 0:
+		return plural(hours, units.hour, units.hours), nil
+	default:
+		return plural(hours, units.hour, units.hours) + " " + units.and + " " + plural(minutes, units.minute, units.minutes), nil
+	}
+}
+
+// RenderedTemplate is the output of TemplateRegistry.Render. Text is empty
+// when the template has no plain-text twin.
+type RenderedTemplate struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+type TemplateRegistryParams struct {
+	// FS defaults to the embedded Templates.
+	FS fs.FS
+	// DefaultLocale is used when Render gets an empty locale. Defaults to
+	// DefaultLocale.
+	DefaultLocale string
+}
+
+type localizedTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// TemplateRegistry holds every template found under templates/, parsed once.
+// Files in templates/layouts are shared by all pages of the same kind: a page
+// defines blocks such as "subject" and "content" and calls
+// {{template "base" .}}. HTML pages use html/template and their .txt twins
+// use text/template.
+type TemplateRegistry struct {
+	defaultLocale string
+	templates     map[string]map[string]*localizedTemplate
+}
+
+func NewTemplateRegistry(params TemplateRegistryParams) (*TemplateRegistry, error) {
+	fsys := params.FS
+	if fsys == nil {
+		fsys = Templates
+	}
+	if sub, err := fs.Sub(fsys, "templates"); err == nil {
+		if _, err := fs.Stat(sub, "."); err == nil {
+			fsys = sub
+		}
+	}
+
+	r := &TemplateRegistry{
+		defaultLocale: params.DefaultLocale,
+		templates:     map[string]map[string]*localizedTemplate{},
+	}
+	if r.defaultLocale == "" {
+		r.defaultLocale = DefaultLocale
+	}
+
+	htmlLayout := htmltemplate.New("").Funcs(templateFuncs).Option("missingkey=error")
+	textLayout := texttemplate.New("").Funcs(templateFuncs).Option("missingkey=error")
+
+	layouts, err := fs.Glob(fsys, "layouts/*")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range layouts {
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch path.Ext(name) {
+		case ".html":
+			_, err = htmlLayout.New(name).Parse(string(content))
+		case ".txt":
+			_, err = textLayout.New(name).Parse(string(content))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template: %w", err)
+		}
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		match := templateFilePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		name, locale := match[1], normalizeLocale(match[2])
+
+		locales, ok := r.templates[name]
+		if !ok {
+			locales = map[string]*localizedTemplate{}
+			r.templates[name] = locales
+		}
+
+		tmpl, ok := locales[locale]
+		if !ok {
+			tmpl = &localizedTemplate{}
+			locales[locale] = tmpl
+		}
+
+		if match[3] == "html" {
+			layout, err := htmlLayout.Clone()
+			if err != nil {
+				return nil, err
+			}
+			if tmpl.html, err = layout.New(entry.Name()).Parse(string(content)); err != nil {
+				return nil, fmt.Errorf("failed to parse template: %w", err)
+			}
+		} else {
+			layout, err := textLayout.Clone()
+			if err != nil {
+				return nil, err
+			}
+			if tmpl.text, err = layout.New(entry.Name()).Parse(string(content)); err != nil {
+				return nil, fmt.Errorf("failed to parse template: %w", err)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// Render executes the HTML and text variants of name from the locale that
+// best matches, falling back from "pt-BR" to "pt" and then to the unsuffixed
+// files. Both parts come from the same locale, so a localized HTML template
+// without a text twin leaves Text empty instead of mixing in another
+// language. The subject comes from the "subject" block of the HTML template.
+func (r *TemplateRegistry) Render(name string, locale string, data any) (*RenderedTemplate, error) {
+	if locale == "" {
+		locale = r.defaultLocale
+	}
+
+	templateErr := func(err error) error {
+		return &TemplateError{Name: name, Locale: locale, Err: err}
+	}
+
+	locales, ok := r.templates[name]
+	if !ok {
+		return nil, templateErr(ErrTemplateNotFound)
+	}
+
+	var (
+		htmlTemplate *htmltemplate.Template
+		textTemplate *texttemplate.Template
+	)
+
+	for _, candidate := range r.fallbacks(locale) {
+		if tmpl, ok := locales[candidate]; ok && tmpl.html != nil {
+			htmlTemplate, textTemplate = tmpl.html, tmpl.text
+			break
+		}
+	}
+
+	if htmlTemplate == nil {
+		return nil, templateErr(ErrTemplateNotFound)
+	}
+	if data == nil {
+		return nil, templateErr(ErrInvalidTemplateData)
+	}
+
+	var (
+		rendered RenderedTemplate
+		buffer   bytes.Buffer
+	)
+
+	if err := htmlTemplate.Execute(&buffer, data); err != nil {
+		return nil, templateErr(fmt.Errorf("%w: %w", ErrInvalidTemplateData, err))
+	}
+	rendered.HTML = strings.TrimSpace(buffer.String())
+
+	if subject := htmlTemplate.Lookup("subject"); subject != nil {
+		buffer.Reset()
+		if err := subject.Execute(&buffer, data); err != nil {
+			return nil, templateErr(fmt.Errorf("%w: %w", ErrInvalidTemplateData, err))
+		}
+		rendered.Subject = strings.TrimSpace(html.UnescapeString(buffer.String()))
+	}
+
+	if textTemplate != nil {
+		buffer.Reset()
+		if err := textTemplate.Execute(&buffer, data); err != nil {
+			return nil, templateErr(fmt.Errorf("%w: %w", ErrInvalidTemplateData, err))
+		}
+		rendered.Text = strings.TrimSpace(buffer.String())
+	}
+
+	return &rendered, nil
+}
+
+// fallbacks lists the locales to try for locale, most specific first. The
+// empty locale stands for the unsuffixed files.
+func (r *TemplateRegistry) fallbacks(locale string) []string {
+	var candidates []string
+
+	for _, l := range []string{locale, r.defaultLocale} {
+		l = normalizeLocale(l)
+		for l != "" {
+			candidates = append(candidates, l)
+			index := strings.LastIndex(l, "-")
+			if index < 0 {
+				break
+			}
+			l = l[:index]
+		}
+	}
+
+	return append(candidates, "")
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+var defaultTemplates = sync.OnceValues(func() (*TemplateRegistry, error) {
+	return NewTemplateRegistry(TemplateRegistryParams{})
+})
+
+// DefaultTemplates returns the registry of the embedded templates.
+func DefaultTemplates() (*TemplateRegistry, error) {
+	return defaultTemplates()
+}
+
+func RenderVerificationCodeTemplate(code string) (string, error) {
+	templates, err := DefaultTemplates()
+	if err != nil {
+		return "", err
+	}
+
+	rendered, err := templates.Render("verification_code", "", VerificationCodeEmail{
+		Code:      code,
+		ExpiresIn: 10 * time.Minute,
 	})
+	if err != nil {
+		return "", err
+	}
 
-	return tmpl
+	return rendered.HTML, nil
 }
 
+// RenderTemplate parses and executes a single HTML template with
+// html/template.
 func RenderTemplate(name, text string, data any) (string, error) {
 
 	var buffer bytes.Buffer
 
-	tmpl, err := template.New(name).Parse(text)
+	tmpl, err := htmltemplate.New(name).Funcs(templateFuncs).Parse(text)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse template: %w", err)
 	}
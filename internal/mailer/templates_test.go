@@ -0,0 +1,162 @@
+package mailer
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTemplateRegistry(t *testing.T) *TemplateRegistry {
+	fsys := fstest.MapFS{
+		"templates/layouts/base.html":  {Data: []byte(`{{define "base"}}<title>{{block "subject" .}}B16{{end}}</title><main>{{block "content" .}}{{end}}</main>{{end}}`)},
+		"templates/layouts/base.txt":   {Data: []byte(`{{define "base"}}B16: {{block "content" .}}{{end}}{{end}}`)},
+		"templates/welcome.html":       {Data: []byte(`{{define "subject"}}Olá, {{.Name}} & cia{{end}}{{define "content"}}<p>Olá, {{.Name}}</p>{{end}}{{template "base" .}}`)},
+		"templates/welcome.txt":        {Data: []byte(`{{define "content"}}Olá, {{.Name}}{{end}}{{template "base" .}}`)},
+		"templates/welcome.en.html":    {Data: []byte(`{{define "subject"}}Hello, {{.Name}}{{end}}{{define "content"}}<p>Hello, {{.Name}}</p>{{end}}{{template "base" .}}`)},
+		"templates/welcome.pt-PT.html": {Data: []byte(`{{define "content"}}<p>Olá, {{.Name}}!</p>{{end}}{{template "base" .}}`)},
+		"templates/notice.html":        {Data: []byte(`<p>{{.Name}}</p>`)},
+	}
+
+	registry, err := NewTemplateRegistry(TemplateRegistryParams{FS: fsys})
+	require.NoError(t, err)
+	return registry
+}
+
+type TestTemplateRegistryParams struct {
+	Name    string
+	Locale  string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+func TestTemplateRegistry_Render(t *testing.T) {
+	registry := newTestTemplateRegistry(t)
+	data := map[string]string{"Name": "<Ana>"}
+
+	tests := []TestTemplateRegistryParams{
+		{
+			Name:    "default locale",
+			Locale:  "",
+			Subject: "Olá, <Ana> & cia",
+			HTML:    "<title>Olá, &lt;Ana&gt; & cia</title><main><p>Olá, &lt;Ana&gt;</p></main>",
+			Text:    "B16: Olá, <Ana>",
+		},
+		{
+			Name:    "falls back from region to language",
+			Locale:  "en_US",
+			Subject: "Hello, <Ana>",
+			HTML:    "<title>Hello, &lt;Ana&gt;</title><main><p>Hello, &lt;Ana&gt;</p></main>",
+			Text:    "",
+		},
+		{
+			Name:    "region variant keeps layout blocks",
+			Locale:  "pt-PT",
+			Subject: "B16",
+			HTML:    "<title>B16</title><main><p>Olá, &lt;Ana&gt;!</p></main>",
+			Text:    "",
+		},
+		{
+			Name:    "unknown locale uses default files",
+			Locale:  "es",
+			Subject: "Olá, <Ana> & cia",
+			HTML:    "<title>Olá, &lt;Ana&gt; & cia</title><main><p>Olá, &lt;Ana&gt;</p></main>",
+			Text:    "B16: Olá, <Ana>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			rendered, err := registry.Render("welcome", tt.Locale, data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Subject, rendered.Subject)
+			assert.Equal(t, tt.HTML, rendered.HTML)
+			assert.Equal(t, tt.Text, rendered.Text)
+		})
+	}
+
+	rendered, err := registry.Render("notice", "en", data)
+	require.NoError(t, err)
+	assert.Equal(t, "<p>&lt;Ana&gt;</p>", rendered.HTML)
+	assert.Equal(t, "B16", rendered.Subject)
+	assert.Empty(t, rendered.Text)
+}
+
+func TestTemplateRegistry_Errors(t *testing.T) {
+	registry := newTestTemplateRegistry(t)
+
+	_, err := registry.Render("unknown", "en", map[string]string{})
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+
+	var templateErr *TemplateError
+	require.ErrorAs(t, err, &templateErr)
+	assert.Equal(t, "unknown", templateErr.Name)
+	assert.Equal(t, "en", templateErr.Locale)
+
+	_, err = registry.Render("welcome", "en", nil)
+	assert.ErrorIs(t, err, ErrInvalidTemplateData)
+
+	_, err = registry.Render("welcome", "en", map[string]string{"Other": "value"})
+	assert.ErrorIs(t, err, ErrInvalidTemplateData)
+
+	_, err = registry.Render("welcome", "en", struct{}{})
+	assert.ErrorIs(t, err, ErrInvalidTemplateData)
+
+	_, err = NewTemplateRegistry(TemplateRegistryParams{FS: fstest.MapFS{
+		"broken.html": {Data: []byte(`{{.Name`)},
+	}})
+	assert.Error(t, err)
+}
+
+func TestRenderVerificationCodeTemplate(t *testing.T) {
+	html, err := RenderVerificationCodeTemplate("123456")
+	require.NoError(t, err)
+	assert.Contains(t, html, "<title>Código de Verificação</title>")
+	assert.Contains(t, html, "123456")
+
+	templates, err := DefaultTemplates()
+	require.NoError(t, err)
+
+	rendered, err := templates.Render("verification_code", "en-US", VerificationCodeEmail{Code: "<b>1</b>", ExpiresIn: 15 * time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, "Verification Code", rendered.Subject)
+	assert.Contains(t, rendered.HTML, "&lt;b&gt;1&lt;/b&gt;")
+	assert.Contains(t, rendered.Text, "Use the code below to verify your account:")
+	assert.Contains(t, rendered.Text, "<b>1</b>")
+	assert.Contains(t, rendered.Text, "This code expires in 15 minutes.")
+}
+
+type TestFormatDurationParams struct {
+	Language string
+	Duration time.Duration
+	Expect   string
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []TestFormatDurationParams{
+		{Language: "en", Duration: time.Minute, Expect: "1 minute"},
+		{Language: "en", Duration: 10*time.Minute + 30*time.Second, Expect: "10 minutes"},
+		{Language: "en", Duration: time.Hour, Expect: "1 hour"},
+		{Language: "en", Duration: 90 * time.Minute, Expect: "1 hour and 30 minutes"},
+		{Language: "en", Duration: 48*time.Hour + time.Minute, Expect: "48 hours and 1 minute"},
+		{Language: "pt", Duration: time.Hour, Expect: "1 hora"},
+		{Language: "pt", Duration: 2*time.Hour + 15*time.Minute, Expect: "2 horas e 15 minutos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Expect, func(t *testing.T) {
+			got, err := formatDuration(tt.Language, tt.Duration)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Expect, got)
+		})
+	}
+
+	_, err := formatDuration("en", 59*time.Second)
+	assert.Error(t, err)
+
+	_, err = formatDuration("es", time.Hour)
+	assert.Error(t, err)
+}
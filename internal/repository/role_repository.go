@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/v2code/b16/internal/database"
+	"github.com/v2code/b16/internal/domain"
+)
+
+type SQLRoleRepository struct {
+	db database.Database
+}
+
+func NewSQLRoleRepository(db database.Database) domain.RoleRepository {
+	return &SQLRoleRepository{db: db}
+}
+
+// Create inserts the role. An empty role.ID is replaced by a generated one.
+func (r *SQLRoleRepository) Create(ctx context.Context, role *domain.Role) error {
+	if role.ID == "" {
+		id, err := NewID()
+		if err != nil {
+			return err
+		}
+		role.ID = id
+	}
+
+	_, err := r.db.Executor(ctx).ExecContext(ctx,
+		`INSERT INTO roles (id, name) VALUES ($1, $2)`,
+		role.ID, role.Name,
+	)
+	if err != nil && isUniqueViolation(err) {
+		return domain.ErrRoleAlreadyExists
+	}
+	return err
+}
+
+func (r *SQLRoleRepository) GetByID(ctx context.Context, id string) (*domain.Role, error) {
+	return r.getBy(ctx, `SELECT id, name FROM roles WHERE id = $1`, id)
+}
+
+func (r *SQLRoleRepository) GetByName(ctx context.Context, name string) (*domain.Role, error) {
+	return r.getBy(ctx, `SELECT id, name FROM roles WHERE name = $1`, name)
+}
+
+// Delete removes the role and its user assignments in one transaction.
+func (r *SQLRoleRepository) Delete(ctx context.Context, id string) error {
+	return r.db.WithTransaction(ctx, func(ctx context.Context) error {
+		executor := r.db.Executor(ctx)
+
+		if _, err := executor.ExecContext(ctx, `DELETE FROM user_roles WHERE role_id = $1`, id); err != nil {
+			return err
+		}
+
+		result, err := executor.ExecContext(ctx, `DELETE FROM roles WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+
+		return expectAffected(result, domain.ErrRoleNotFound)
+	})
+}
+
+func (r *SQLRoleRepository) List(ctx context.Context, page domain.Page) ([]domain.Role, error) {
+	page = page.Normalize()
+
+	rows, err := r.db.Executor(ctx).QueryContext(ctx,
+		`SELECT id, name FROM roles ORDER BY name LIMIT $1 OFFSET $2`,
+		page.Limit, page.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []domain.Role{}
+	for rows.Next() {
+		var role domain.Role
+		if err := rows.Scan(&role.ID, &role.Name); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (r *SQLRoleRepository) getBy(ctx context.Context, query string, arg any) (*domain.Role, error) {
+	var role domain.Role
+
+	err := r.db.Executor(ctx).QueryRowContext(ctx, query, arg).Scan(&role.ID, &role.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/v2code/b16/internal/domain"
+)
+
+func TestSQLRoleRepository(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	roles := NewSQLRoleRepository(db)
+
+	admin := &domain.Role{Name: "ADMIN"}
+	require.NoError(t, roles.Create(ctx, admin))
+	require.NoError(t, roles.Create(ctx, &domain.Role{Name: "USER"}))
+	require.ErrorIs(t, roles.Create(ctx, &domain.Role{Name: "ADMIN"}), domain.ErrRoleAlreadyExists)
+
+	found, err := roles.GetByName(ctx, "ADMIN")
+	require.NoError(t, err)
+	require.Equal(t, admin.ID, found.ID)
+
+	found, err = roles.GetByID(ctx, admin.ID)
+	require.NoError(t, err)
+	require.Equal(t, "ADMIN", found.Name)
+
+	list, err := roles.List(ctx, domain.Page{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, "USER", list[0].Name)
+
+	require.NoError(t, roles.Delete(ctx, admin.ID))
+	require.ErrorIs(t, roles.Delete(ctx, admin.ID), domain.ErrRoleNotFound)
+
+	_, err = roles.GetByName(ctx, "ADMIN")
+	require.ErrorIs(t, err, domain.ErrRoleNotFound)
+}
+
+func TestSQLRoleRepository_DeleteIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	roles := NewSQLRoleRepository(db)
+	users := NewSQLUserRepository(db)
+
+	admin := &domain.Role{Name: "ADMIN"}
+	require.NoError(t, roles.Create(ctx, admin))
+
+	user := &domain.User{Email: "admin@email.com", Password: "hash", Roles: []domain.Role{*admin}}
+	require.NoError(t, users.Create(ctx, user))
+
+	_, err := db.Executor(ctx).ExecContext(ctx,
+		`CREATE TRIGGER fail_role_delete BEFORE DELETE ON roles BEGIN SELECT RAISE(ABORT, 'delete failed'); END`,
+	)
+	require.NoError(t, err)
+
+	require.ErrorContains(t, roles.Delete(ctx, admin.ID), "delete failed")
+
+	found, err := users.GetByEmail(ctx, "admin@email.com")
+	require.NoError(t, err)
+	require.Len(t, found.Roles, 1)
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/v2code/b16/internal/database"
+	_ "modernc.org/sqlite"
+)
+
+func newTestDatabase(t *testing.T) database.Database {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite", "file::memory:?_time_format=sqlite")
+	require.NoError(t, err)
+
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db := database.NewDatabase(sqlDB)
+
+	migrator, err := database.NewMigrator(db, database.SQLiteDialect, database.Migrations)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Up(context.Background()))
+
+	return db
+}
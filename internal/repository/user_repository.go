@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/v2code/b16/internal/database"
+	"github.com/v2code/b16/internal/domain"
+)
+
+// SQLUserRepository stores users in the users table and their roles in
+// user_roles. Every query goes through db.Executor(ctx), so calls made inside
+// database.WithTransaction join that transaction.
+type SQLUserRepository struct {
+	db database.Database
+}
+
+func NewSQLUserRepository(db database.Database) domain.UserRepository {
+	return &SQLUserRepository{db: db}
+}
+
+// Create inserts the user and assigns the roles listed in user.Roles by ID,
+// in one transaction, so an unknown role leaves no user behind. An empty
+// user.ID is replaced by a generated one.
+func (r *SQLUserRepository) Create(ctx context.Context, user *domain.User) error {
+	if user.ID == "" {
+		id, err := NewID()
+		if err != nil {
+			return err
+		}
+		user.ID = id
+	}
+
+	return r.db.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := r.db.Executor(ctx).ExecContext(ctx,
+			`INSERT INTO users (id, email, password, email_verified) VALUES ($1, $2, $3, $4)`,
+			user.ID, user.Email, user.Password, user.EmailVerified,
+		)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return domain.ErrUserAlreadyExists
+			}
+			return err
+		}
+
+		for _, role := range user.Roles {
+			if err := r.AssignRole(ctx, user.ID, role.ID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *SQLUserRepository) GetByID(ctx context.Context, id string) (*domain.User, error) {
+	return r.getBy(ctx, `SELECT id, email, password, email_verified FROM users WHERE id = $1`, id)
+}
+
+func (r *SQLUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return r.getBy(ctx, `SELECT id, email, password, email_verified FROM users WHERE email = $1`, email)
+}
+
+// Update saves the email, password and verification flag of the user. Roles
+// are managed with AssignRole and RemoveRole.
+func (r *SQLUserRepository) Update(ctx context.Context, user *domain.User) error {
+	result, err := r.db.Executor(ctx).ExecContext(ctx,
+		`UPDATE users SET email = $2, password = $3, email_verified = $4 WHERE id = $1`,
+		user.ID, user.Email, user.Password, user.EmailVerified,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return domain.ErrUserAlreadyExists
+		}
+		return err
+	}
+
+	return expectAffected(result, domain.ErrUserNotFound)
+}
+
+// Delete removes the user and their role assignments in one transaction.
+func (r *SQLUserRepository) Delete(ctx context.Context, id string) error {
+	return r.db.WithTransaction(ctx, func(ctx context.Context) error {
+		executor := r.db.Executor(ctx)
+
+		if _, err := executor.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1`, id); err != nil {
+			return err
+		}
+
+		result, err := executor.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+
+		return expectAffected(result, domain.ErrUserNotFound)
+	})
+}
+
+func (r *SQLUserRepository) List(ctx context.Context, page domain.Page) ([]domain.User, error) {
+	page = page.Normalize()
+
+	rows, err := r.db.Executor(ctx).QueryContext(ctx,
+		`SELECT id, email, password, email_verified FROM users ORDER BY email LIMIT $1 OFFSET $2`,
+		page.Limit, page.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []domain.User{}
+	for rows.Next() {
+		var user domain.User
+		if err := rows.Scan(&user.ID, &user.Email, &user.Password, &user.EmailVerified); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadRoles(ctx, users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (r *SQLUserRepository) AssignRole(ctx context.Context, userID, roleID string) error {
+	if err := r.exists(ctx, `SELECT id FROM users WHERE id = $1`, userID, domain.ErrUserNotFound); err != nil {
+		return err
+	}
+	if err := r.exists(ctx, `SELECT id FROM roles WHERE id = $1`, roleID, domain.ErrRoleNotFound); err != nil {
+		return err
+	}
+
+	_, err := r.db.Executor(ctx).ExecContext(ctx,
+		`INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2) ON CONFLICT (user_id, role_id) DO NOTHING`,
+		userID, roleID,
+	)
+	return err
+}
+
+func (r *SQLUserRepository) RemoveRole(ctx context.Context, userID, roleID string) error {
+	_, err := r.db.Executor(ctx).ExecContext(ctx,
+		`DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2`,
+		userID, roleID,
+	)
+	return err
+}
+
+func (r *SQLUserRepository) getBy(ctx context.Context, query string, arg any) (*domain.User, error) {
+	var user domain.User
+
+	err := r.db.Executor(ctx).QueryRowContext(ctx, query, arg).Scan(&user.ID, &user.Email, &user.Password, &user.EmailVerified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	users := []domain.User{user}
+	if err := r.loadRoles(ctx, users); err != nil {
+		return nil, err
+	}
+
+	return &users[0], nil
+}
+
+// loadRoles fills the roles of all users with a single query.
+func (r *SQLUserRepository) loadRoles(ctx context.Context, users []domain.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(users))
+	args := make([]any, len(users))
+	for i := range users {
+		users[i].Roles = []domain.Role{}
+		index[users[i].ID] = i
+		args[i] = users[i].ID
+	}
+
+	rows, err := r.db.Executor(ctx).QueryContext(ctx,
+		`SELECT ur.user_id, r.id, r.name FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id IN (`+placeholders(1, len(args))+`)
+		ORDER BY r.name`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			userID string
+			role   domain.Role
+		)
+		if err := rows.Scan(&userID, &role.ID, &role.Name); err != nil {
+			return err
+		}
+		users[index[userID]].Roles = append(users[index[userID]].Roles, role)
+	}
+
+	return rows.Err()
+}
+
+func (r *SQLUserRepository) exists(ctx context.Context, query, id string, notFound error) error {
+	var found string
+
+	err := r.db.Executor(ctx).QueryRowContext(ctx, query, id).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound
+	}
+	return err
+}
+
+func expectAffected(result sql.Result, notFound error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
+}
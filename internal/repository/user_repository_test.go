@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/v2code/b16/internal/domain"
+)
+
+func TestSQLUserRepository_CRUD(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	users := NewSQLUserRepository(db)
+	roles := NewSQLRoleRepository(db)
+
+	admin := &domain.Role{Name: "ADMIN"}
+	require.NoError(t, roles.Create(ctx, admin))
+
+	user := &domain.User{
+		Email:    "admin@email.com",
+		Password: "hash",
+		Roles:    []domain.Role{*admin},
+	}
+	require.NoError(t, users.Create(ctx, user))
+	require.NotEmpty(t, user.ID)
+
+	found, err := users.GetByEmail(ctx, "admin@email.com")
+	require.NoError(t, err)
+	require.Equal(t, user.ID, found.ID)
+	require.Equal(t, []string{"ADMIN"}, found.RoleNames())
+
+	err = users.Create(ctx, &domain.User{Email: "admin@email.com", Password: "hash"})
+	require.ErrorIs(t, err, domain.ErrUserAlreadyExists)
+
+	err = users.Create(ctx, &domain.User{Email: "other@email.com", Password: "hash", Roles: []domain.Role{{ID: "unknown"}}})
+	require.ErrorIs(t, err, domain.ErrRoleNotFound)
+
+	_, err = users.GetByEmail(ctx, "other@email.com")
+	require.ErrorIs(t, err, domain.ErrUserNotFound, "a failed role assignment rolls the user back")
+
+	require.False(t, found.EmailVerified)
+
+	found.Email = "root@email.com"
+	found.Password = "new-hash"
+	found.EmailVerified = true
+	require.NoError(t, users.Update(ctx, found))
+
+	found, err = users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, "root@email.com", found.Email)
+	require.Equal(t, "new-hash", found.Password)
+	require.True(t, found.EmailVerified)
+
+	require.ErrorIs(t, users.Update(ctx, &domain.User{ID: "unknown"}), domain.ErrUserNotFound)
+
+	require.NoError(t, users.Delete(ctx, user.ID))
+	require.ErrorIs(t, users.Delete(ctx, user.ID), domain.ErrUserNotFound)
+
+	_, err = users.GetByID(ctx, user.ID)
+	require.ErrorIs(t, err, domain.ErrUserNotFound)
+}
+
+func TestSQLUserRepository_Roles(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	users := NewSQLUserRepository(db)
+	roles := NewSQLRoleRepository(db)
+
+	admin := &domain.Role{Name: "ADMIN"}
+	member := &domain.Role{Name: "USER"}
+	require.NoError(t, roles.Create(ctx, admin))
+	require.NoError(t, roles.Create(ctx, member))
+
+	user := &domain.User{Email: "user@email.com", Password: "hash"}
+	require.NoError(t, users.Create(ctx, user))
+
+	require.NoError(t, users.AssignRole(ctx, user.ID, admin.ID))
+	require.NoError(t, users.AssignRole(ctx, user.ID, member.ID))
+	require.NoError(t, users.AssignRole(ctx, user.ID, member.ID))
+
+	require.ErrorIs(t, users.AssignRole(ctx, user.ID, "unknown"), domain.ErrRoleNotFound)
+	require.ErrorIs(t, users.AssignRole(ctx, "unknown", admin.ID), domain.ErrUserNotFound)
+
+	found, err := users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ADMIN", "USER"}, found.RoleNames())
+
+	require.NoError(t, users.RemoveRole(ctx, user.ID, admin.ID))
+
+	found, err = users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"USER"}, found.RoleNames())
+}
+
+type TestListUsersParams struct {
+	Name         string
+	Page         domain.Page
+	ExpectEmails []string
+}
+
+func TestSQLUserRepository_List(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	users := NewSQLUserRepository(db)
+	roles := NewSQLRoleRepository(db)
+
+	admin := &domain.Role{Name: "ADMIN"}
+	require.NoError(t, roles.Create(ctx, admin))
+
+	for _, email := range []string{"c@email.com", "a@email.com", "b@email.com"} {
+		require.NoError(t, users.Create(ctx, &domain.User{
+			Email:    email,
+			Password: "hash",
+			Roles:    []domain.Role{*admin},
+		}))
+	}
+
+	cases := []TestListUsersParams{
+		{Name: "default page", Page: domain.Page{}, ExpectEmails: []string{"a@email.com", "b@email.com", "c@email.com"}},
+		{Name: "first page", Page: domain.Page{Limit: 2}, ExpectEmails: []string{"a@email.com", "b@email.com"}},
+		{Name: "second page", Page: domain.Page{Limit: 2, Offset: 2}, ExpectEmails: []string{"c@email.com"}},
+		{Name: "past the end", Page: domain.Page{Limit: 2, Offset: 4}, ExpectEmails: []string{}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			list, err := users.List(ctx, tt.Page)
+			require.NoError(t, err)
+
+			emails := []string{}
+			for _, user := range list {
+				emails = append(emails, user.Email)
+				require.Equal(t, []string{"ADMIN"}, user.RoleNames())
+			}
+			require.Equal(t, tt.ExpectEmails, emails)
+		})
+	}
+}
+
+func TestSQLUserRepository_WithTransaction(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	users := NewSQLUserRepository(db)
+
+	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := users.Create(ctx, &domain.User{Email: "tx@email.com", Password: "hash"}); err != nil {
+			return err
+		}
+		return domain.ErrUserAlreadyExists
+	})
+	require.ErrorIs(t, err, domain.ErrUserAlreadyExists)
+
+	_, err = users.GetByEmail(ctx, "tx@email.com")
+	require.ErrorIs(t, err, domain.ErrUserNotFound)
+}
@@ -0,0 +1,130 @@
+package security
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims is the content of an access token. Issuer, IssuedAt and ExpiresAt
+// are set by the issuer on Create; the remaining registered claims are taken
+// from the caller. Custom holds any additional top-level claim, and must not
+// use the names of registered or built-in claims.
+type Claims struct {
+	ID        string
+	Subject   string
+	Issuer    string
+	Audience  []string
+	Email     string
+	Roles     []string
+	IssuedAt  time.Time
+	NotBefore time.Time
+	ExpiresAt time.Time
+	Custom    map[string]any
+}
+
+// HasAudience reports whether the token was issued for audience.
+func (c *Claims) HasAudience(audience string) bool {
+	return slices.Contains(c.Audience, audience)
+}
+
+// Claim returns the custom claim stored under name.
+func (c *Claims) Claim(name string) (any, bool) {
+	value, ok := c.Custom[name]
+	return value, ok
+}
+
+var reservedClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "Email", "Roles"}
+
+type internalClaims struct {
+	Email  string
+	Roles  []string
+	Custom map[string]any `json:"-"`
+	jwt.RegisteredClaims
+}
+
+func newInternalClaims(claims *Claims, registered jwt.RegisteredClaims) internalClaims {
+	return internalClaims{
+		Email:            claims.Email,
+		Roles:            claims.Roles,
+		Custom:           claims.Custom,
+		RegisteredClaims: registered,
+	}
+}
+
+// MarshalJSON flattens the custom claims next to the registered ones.
+func (c internalClaims) MarshalJSON() ([]byte, error) {
+	type plain internalClaims
+
+	data, err := json.Marshal(plain(c))
+	if err != nil || len(c.Custom) == 0 {
+		return data, err
+	}
+
+	merged := map[string]any{}
+	for name, value := range c.Custom {
+		merged[name] = value
+	}
+
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(merged)
+}
+
+func (c *internalClaims) UnmarshalJSON(data []byte) error {
+	type plain internalClaims
+
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+
+	var all map[string]any
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+
+	for _, name := range reservedClaims {
+		delete(all, name)
+	}
+
+	if len(all) > 0 {
+		c.Custom = all
+	}
+
+	return nil
+}
+
+func (c *internalClaims) toClaims() *Claims {
+	claims := &Claims{
+		ID:       c.ID,
+		Subject:  c.Subject,
+		Issuer:   c.Issuer,
+		Audience: c.Audience,
+		Email:    c.Email,
+		Roles:    c.Roles,
+		Custom:   c.Custom,
+	}
+
+	if c.IssuedAt != nil {
+		claims.IssuedAt = c.IssuedAt.Time
+	}
+	if c.NotBefore != nil {
+		claims.NotBefore = c.NotBefore.Time
+	}
+	if c.ExpiresAt != nil {
+		claims.ExpiresAt = c.ExpiresAt.Time
+	}
+
+	return claims
+}
+
+func numericDateOrNil(t time.Time) *jwt.NumericDate {
+	if t.IsZero() {
+		return nil
+	}
+	return jwt.NewNumericDate(t)
+}
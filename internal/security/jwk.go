@@ -0,0 +1,179 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var ErrInvalidJWK = errors.New("invalid json web key")
+
+// JSONWebKey is the public part of a verification key as described by
+// RFC 7517. Only RSA, EC (P-256/384/521) and OKP (Ed25519) keys are supported.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func NewJSONWebKey(keyID, algorithm string, publicKey crypto.PublicKey) (JSONWebKey, error) {
+	key := JSONWebKey{
+		KeyID:     keyID,
+		Use:       "sig",
+		Algorithm: algorithm,
+	}
+
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		key.KeyType = "RSA"
+		key.N = encodeSegment(k.N.Bytes())
+		key.E = encodeSegment(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		point, err := k.Bytes()
+		if err != nil {
+			return JSONWebKey{}, err
+		}
+		size := (len(point) - 1) / 2
+		key.KeyType = "EC"
+		key.Curve = k.Curve.Params().Name
+		key.X = encodeSegment(point[1 : 1+size])
+		key.Y = encodeSegment(point[1+size:])
+	case ed25519.PublicKey:
+		key.KeyType = "OKP"
+		key.Curve = "Ed25519"
+		key.X = encodeSegment(k)
+	default:
+		return JSONWebKey{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, publicKey)
+	}
+
+	return key, nil
+}
+
+// PublicKey decodes the key material into a crypto public key.
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeSegment(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeSegment(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 {
+			return nil, ErrInvalidJWK
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		curve, err := curveByName(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeSegment(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		point := append([]byte{4}, append(x, y...)...)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("%w: curve %s", ErrInvalidJWK, k.Curve)
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidJWK
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("%w: kty %s", ErrInvalidJWK, k.KeyType)
+}
+
+// Thumbprint computes the RFC 7638 SHA-256 thumbprint of the key, which is
+// used as default key ID.
+func (k JSONWebKey) Thumbprint() (string, error) {
+	var members any
+
+	switch k.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.KeyType, k.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Curve, k.KeyType, k.X, k.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Curve, k.KeyType, k.X}
+	default:
+		return "", fmt.Errorf("%w: kty %s", ErrInvalidJWK, k.KeyType)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return encodeSegment(sum[:]), nil
+}
+
+func curveByName(name string) (elliptic.Curve, error) {
+	switch name {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	}
+	return nil, fmt.Errorf("%w: curve %s", ErrInvalidJWK, name)
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSegment(segment string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJWK, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,230 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrJWKSUnavailable = errors.New("jwks unavailable")
+
+const (
+	defaultJWKSCacheTTL       = 5 * time.Minute
+	defaultJWKSRefreshBackoff = 30 * time.Second
+)
+
+// JWKSIssuer is a verify-only TokenIssuer that resolves keys from a JWKS
+// document, either served over HTTP (URL) or read from disk (Path). The
+// document is cached for CacheTTL and refetched early, at most once per
+// RefreshBackoff, when a token names an unknown kid. Fetches run without
+// holding the lock, so tokens signed by cached keys are never held up by a
+// slow endpoint, and concurrent refreshes share a single fetch. Issuer,
+// Audience, Leeway and Type are enforced like in JwtIssuer.
+type JWKSIssuer struct {
+	url            string
+	path           string
+	client         *http.Client
+	cacheTTL       time.Duration
+	refreshBackoff time.Duration
+	issuer         string
+	audience       []string
+	leeway         time.Duration
+	tokenType      string
+	now            func() time.Time
+
+	mu          sync.Mutex
+	keySet      *KeySet
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	inflight    *jwksRefresh
+}
+
+// jwksRefresh is a fetch in progress; done is closed once err is set.
+type jwksRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+type JWKSIssuerParams struct {
+	URL            string
+	Path           string
+	HTTPClient     *http.Client
+	CacheTTL       time.Duration
+	RefreshBackoff time.Duration
+	Issuer         string
+	Audience       []string
+	Leeway         time.Duration
+	Type           string
+}
+
+func NewJWKSIssuer(params JWKSIssuerParams) TokenIssuer[*Claims] {
+	issuer := &JWKSIssuer{
+		url:            params.URL,
+		path:           params.Path,
+		client:         params.HTTPClient,
+		cacheTTL:       params.CacheTTL,
+		refreshBackoff: params.RefreshBackoff,
+		issuer:         params.Issuer,
+		audience:       params.Audience,
+		leeway:         params.Leeway,
+		tokenType:      params.Type,
+		now:            time.Now,
+	}
+
+	if issuer.client == nil {
+		issuer.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if issuer.cacheTTL == 0 {
+		issuer.cacheTTL = defaultJWKSCacheTTL
+	}
+	if issuer.refreshBackoff == 0 {
+		issuer.refreshBackoff = defaultJWKSRefreshBackoff
+	}
+	if issuer.tokenType == "" {
+		issuer.tokenType = DefaultTokenType
+	}
+
+	return issuer
+}
+
+func (j *JWKSIssuer) Create(claims *Claims) (string, error) {
+	return "", ErrVerifyOnlyIssuer
+}
+
+func (j *JWKSIssuer) Decode(rawToken string) (*Claims, error) {
+	return decodeClaims(rawToken, j.tokenType, keySetKeyfunc(j.lookup), validationOptions(j.issuer, j.audience, j.leeway)...)
+}
+
+func (j *JWKSIssuer) lookup(keyID string) (*SigningKey, error) {
+	now := j.now()
+
+	keySet, fetchedAt, attemptedAt := j.state()
+	if keySet == nil || now.Sub(fetchedAt) >= j.cacheTTL {
+		if err := j.refresh(now); err != nil && keySet == nil {
+			return nil, err
+		}
+		keySet, _, attemptedAt = j.state()
+	}
+
+	key, err := keySet.Lookup(keyID)
+	if errors.Is(err, ErrKeyNotFound) && now.Sub(attemptedAt) >= j.refreshBackoff {
+		if err := j.refresh(now); err != nil {
+			return nil, err
+		}
+		keySet, _, _ = j.state()
+		return keySet.Lookup(keyID)
+	}
+
+	return key, err
+}
+
+func (j *JWKSIssuer) state() (*KeySet, time.Time, time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.keySet, j.fetchedAt, j.attemptedAt
+}
+
+// refresh fetches and parses the JWKS document with j.mu released and only
+// takes the lock to swap the key set. A caller that finds a fetch in
+// progress waits for it instead of starting another. On failure the
+// previous key set is kept so an unreachable JWKS endpoint does not reject
+// valid tokens.
+func (j *JWKSIssuer) refresh(now time.Time) error {
+	j.mu.Lock()
+	if call := j.inflight; call != nil {
+		j.mu.Unlock()
+		<-call.done
+		return call.err
+	}
+
+	call := &jwksRefresh{done: make(chan struct{})}
+	j.inflight = call
+	j.attemptedAt = now
+	j.mu.Unlock()
+
+	keySet, err := j.load()
+
+	j.mu.Lock()
+	if err == nil {
+		j.keySet = keySet
+		j.fetchedAt = now
+	}
+	j.inflight = nil
+	j.mu.Unlock()
+
+	call.err = err
+	close(call.done)
+	return err
+}
+
+func (j *JWKSIssuer) load() (*KeySet, error) {
+	data, err := j.fetch()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrJWKSUnavailable, err)
+	}
+
+	return ParseJWKS(data)
+}
+
+func (j *JWKSIssuer) fetch() ([]byte, error) {
+	if j.url == "" {
+		return os.ReadFile(j.path)
+	}
+
+	res, err := j.client.Get(j.url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+// ParseJWKS builds a verify-only KeySet from a JWKS document. Keys that are
+// not meant for signatures, that cannot be decoded or whose alg does not
+// match their kty and crv are skipped.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var jwks JSONWebKeySet
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJWK, err)
+	}
+
+	keySet := &KeySet{}
+
+	for _, jwk := range jwks.Keys {
+		if jwk.KeyID == "" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+
+		method := SigningMethodForKey(publicKey)
+		if jwk.Algorithm != "" {
+			method = jwt.GetSigningMethod(jwk.Algorithm)
+		}
+		if method == nil || !signingMethodMatchesKey(method, publicKey) {
+			continue
+		}
+
+		if err := keySet.Add(&SigningKey{ID: jwk.KeyID, PublicKey: publicKey, Method: method}); err != nil {
+			continue
+		}
+	}
+
+	return keySet, nil
+}
@@ -0,0 +1,233 @@
+package security
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrKeyNotFound    = errors.New("key not found")
+	ErrNoActiveKey    = errors.New("no active key")
+	ErrDuplicateKeyID = errors.New("duplicate key id")
+)
+
+// SigningKey is an asymmetric key identified by a kid. Keys without a
+// PrivateKey can only verify tokens.
+type SigningKey struct {
+	ID         string
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+	Method     jwt.SigningMethod
+	Retired    bool
+}
+
+// NewSigningKey wraps a private key, deriving its algorithm from the key type
+// and its ID from the RFC 7638 thumbprint.
+func NewSigningKey(privateKey crypto.PrivateKey) (*SigningKey, error) {
+	key, err := NewVerificationKey(PublicKeyOf(privateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	key.PrivateKey = privateKey
+	return key, nil
+}
+
+func NewVerificationKey(publicKey crypto.PublicKey) (*SigningKey, error) {
+	method := SigningMethodForKey(publicKey)
+	if method == nil {
+		return nil, ErrUnsupportedKey
+	}
+
+	jwk, err := NewJSONWebKey("", method.Alg(), publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, err := jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:        keyID,
+		PublicKey: publicKey,
+		Method:    method,
+	}, nil
+}
+
+// KeySet holds the keys used to sign and verify tokens. New tokens are signed
+// with the active key, while any key that is not retired is accepted for
+// verification, so a rotation is: Add the new key, Activate it, and Retire
+// the previous one once all tokens it signed have expired.
+type KeySet struct {
+	mu       sync.RWMutex
+	keys     []*SigningKey
+	activeID string
+}
+
+// NewKeySet builds a key set whose active key is the first one able to sign.
+func NewKeySet(keys ...*SigningKey) (*KeySet, error) {
+	set := &KeySet{}
+
+	for _, key := range keys {
+		if err := set.Add(key); err != nil {
+			return nil, err
+		}
+		if set.activeID == "" && key.PrivateKey != nil && !key.Retired {
+			set.activeID = key.ID
+		}
+	}
+
+	return set, nil
+}
+
+func (s *KeySet) Add(key *SigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.find(key.ID) != nil {
+		return ErrDuplicateKeyID
+	}
+
+	if key.PublicKey == nil {
+		key.PublicKey = PublicKeyOf(key.PrivateKey)
+	}
+	if key.Method == nil {
+		key.Method = SigningMethodForKey(key.PublicKey)
+	}
+	if key.Method == nil {
+		return ErrUnsupportedKey
+	}
+
+	s.keys = append(s.keys, key)
+	return nil
+}
+
+// Activate makes keyID the key used to sign new tokens.
+func (s *KeySet) Activate(keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := s.find(keyID)
+	if key == nil || key.Retired {
+		return ErrKeyNotFound
+	}
+	if key.PrivateKey == nil {
+		return ErrVerifyOnlyIssuer
+	}
+
+	s.activeID = keyID
+	return nil
+}
+
+// Retire stops accepting tokens signed by keyID. Retiring the active key
+// leaves the set without a signing key until another one is activated.
+func (s *KeySet) Retire(keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := s.find(keyID)
+	if key == nil {
+		return ErrKeyNotFound
+	}
+
+	key.Retired = true
+	if s.activeID == keyID {
+		s.activeID = ""
+	}
+	return nil
+}
+
+// Remove drops keyID from the set entirely.
+func (s *KeySet) Remove(keyID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = slices.DeleteFunc(s.keys, func(key *SigningKey) bool {
+		return key.ID == keyID
+	})
+	if s.activeID == keyID {
+		s.activeID = ""
+	}
+}
+
+func (s *KeySet) Active() (*SigningKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := s.find(s.activeID)
+	if key == nil {
+		return nil, ErrNoActiveKey
+	}
+	return key, nil
+}
+
+// Lookup returns the non-retired key identified by keyID.
+func (s *KeySet) Lookup(keyID string) (*SigningKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := s.find(keyID)
+	if key == nil || key.Retired {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// JWKS returns the public keys that are still accepted for verification.
+func (s *KeySet) JWKS() (JSONWebKeySet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+
+	for _, key := range s.keys {
+		if key.Retired {
+			continue
+		}
+
+		jwk, err := NewJSONWebKey(key.ID, key.Method.Alg(), key.PublicKey)
+		if err != nil {
+			return JSONWebKeySet{}, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set, nil
+}
+
+func (s *KeySet) find(keyID string) *SigningKey {
+	if keyID == "" {
+		return nil
+	}
+
+	for _, key := range s.keys {
+		if key.ID == keyID {
+			return key
+		}
+	}
+	return nil
+}
+
+// NewJWKSHandler serves the key set as a JWKS document, typically mounted
+// at /.well-known/jwks.json.
+func NewJWKSHandler(keySet *KeySet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwks, err := keySet.JWKS()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(jwks)
+	})
+}
@@ -0,0 +1,257 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSigningKey(t *testing.T) *SigningKey {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	key, err := NewSigningKey(privateKey)
+	require.NoError(t, err)
+
+	return key
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	oldKey := newTestSigningKey(t)
+	newKey := newTestSigningKey(t)
+
+	keySet, err := NewKeySet(oldKey)
+	require.NoError(t, err)
+
+	issuer := NewJwtIssuer(JwtIssuerParams{
+		KeySet:   keySet,
+		ExpireAt: time.Hour,
+		Issuer:   "b16",
+	})
+
+	oldToken, err := issuer.Create(&Claims{Subject: "user-1"})
+	require.NoError(t, err)
+
+	require.NoError(t, keySet.Add(newKey))
+	require.NoError(t, keySet.Activate(newKey.ID))
+
+	newToken, err := issuer.Create(&Claims{Subject: "user-1"})
+	require.NoError(t, err)
+
+	_, err = issuer.Decode(oldToken)
+	require.NoError(t, err)
+
+	_, err = issuer.Decode(newToken)
+	require.NoError(t, err)
+
+	require.NoError(t, keySet.Retire(oldKey.ID))
+
+	_, err = issuer.Decode(oldToken)
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	_, err = issuer.Decode(newToken)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, keySet.Add(newKey), ErrDuplicateKeyID)
+	require.ErrorIs(t, keySet.Activate(oldKey.ID), ErrKeyNotFound)
+}
+
+func TestJSONWebKey_RoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	require.NoError(t, err)
+
+	ed25519Public, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, publicKey := range []any{&rsaKey.PublicKey, &ecdsaKey.PublicKey, ed25519Public} {
+		jwk, err := NewJSONWebKey("kid", SigningMethodForKey(publicKey).Alg(), publicKey)
+		require.NoError(t, err)
+
+		decoded, err := jwk.PublicKey()
+		require.NoError(t, err)
+		require.Equal(t, publicKey, decoded)
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	active := newTestSigningKey(t)
+	retired := newTestSigningKey(t)
+	retired.Retired = true
+
+	keySet, err := NewKeySet(active, retired)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	NewJWKSHandler(keySet).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var jwks JSONWebKeySet
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &jwks))
+	require.Len(t, jwks.Keys, 1)
+	require.Equal(t, active.ID, jwks.Keys[0].KeyID)
+	require.Equal(t, "ES256", jwks.Keys[0].Algorithm)
+}
+
+func TestJWKSIssuer_Decode(t *testing.T) {
+	first := newTestSigningKey(t)
+	second := newTestSigningKey(t)
+
+	keySet, err := NewKeySet(first)
+	require.NoError(t, err)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		NewJWKSHandler(keySet).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	signer := NewJwtIssuer(JwtIssuerParams{KeySet: keySet, ExpireAt: time.Hour, Issuer: "b16"})
+	verifier := NewJWKSIssuer(JWKSIssuerParams{URL: server.URL, CacheTTL: time.Hour, RefreshBackoff: time.Nanosecond})
+
+	token, err := signer.Create(&Claims{Subject: "user-1"})
+	require.NoError(t, err)
+
+	claims, err := verifier.Decode(token)
+	require.NoError(t, err)
+	require.Equal(t, "user-1", claims.Subject)
+
+	_, err = verifier.Decode(token)
+	require.NoError(t, err)
+	require.Equal(t, 1, requests)
+
+	require.NoError(t, keySet.Add(second))
+	require.NoError(t, keySet.Activate(second.ID))
+
+	token, err = signer.Create(&Claims{Subject: "user-2"})
+	require.NoError(t, err)
+
+	claims, err = verifier.Decode(token)
+	require.NoError(t, err)
+	require.Equal(t, "user-2", claims.Subject)
+	require.Equal(t, 2, requests)
+
+	_, err = verifier.Create(&Claims{})
+	require.ErrorIs(t, err, ErrVerifyOnlyIssuer)
+}
+
+func TestJWKSIssuer_FetchOutsideLock(t *testing.T) {
+	first := newTestSigningKey(t)
+	second := newTestSigningKey(t)
+
+	keySet, err := NewKeySet(first)
+	require.NoError(t, err)
+
+	var (
+		requests atomic.Int32
+		blocked  atomic.Bool
+	)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if blocked.Load() {
+			<-release
+		}
+		NewJWKSHandler(keySet).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	signer := NewJwtIssuer(JwtIssuerParams{KeySet: keySet, ExpireAt: time.Hour, Issuer: "b16"})
+	verifier := NewJWKSIssuer(JWKSIssuerParams{URL: server.URL, CacheTTL: time.Hour, RefreshBackoff: time.Nanosecond})
+
+	cached, err := signer.Create(&Claims{Subject: "user-1"})
+	require.NoError(t, err)
+	_, err = verifier.Decode(cached)
+	require.NoError(t, err)
+
+	require.NoError(t, keySet.Add(second))
+	require.NoError(t, keySet.Activate(second.ID))
+
+	rotated, err := signer.Create(&Claims{Subject: "user-2"})
+	require.NoError(t, err)
+
+	blocked.Store(true)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for range 5 {
+		wg.Go(func() {
+			_, err := verifier.Decode(rotated)
+			errs <- err
+		})
+	}
+
+	require.Eventually(t, func() bool { return requests.Load() == 2 }, time.Second, time.Millisecond)
+
+	// The refresh for the unknown kid is still blocked, yet tokens of cached
+	// keys are verified right away.
+	_, err = verifier.Decode(cached)
+	require.NoError(t, err)
+
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(2), requests.Load(), "concurrent refreshes share a fetch")
+}
+
+func TestParseJWKS_AlgorithmMismatch(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	jwk := func(keyID, algorithm string, publicKey any) JSONWebKey {
+		key, err := NewJSONWebKey(keyID, algorithm, publicKey)
+		require.NoError(t, err)
+		return key
+	}
+
+	data, err := json.Marshal(JSONWebKeySet{Keys: []JSONWebKey{
+		jwk("es256", "ES256", &ecKey.PublicKey),
+		jwk("rs256-ec", "RS256", &ecKey.PublicKey),
+		jwk("es384-p256", "ES384", &ecKey.PublicKey),
+		jwk("hs256-ec", "HS256", &ecKey.PublicKey),
+		jwk("ps256", "PS256", &rsaKey.PublicKey),
+		jwk("es256-rsa", "ES256", &rsaKey.PublicKey),
+		jwk("eddsa", "EdDSA", edKey),
+		jwk("rs256-ed", "RS256", edKey),
+	}})
+	require.NoError(t, err)
+
+	keySet, err := ParseJWKS(data)
+	require.NoError(t, err)
+
+	for _, keyID := range []string{"es256", "ps256", "eddsa"} {
+		_, err := keySet.Lookup(keyID)
+		require.NoError(t, err, keyID)
+	}
+
+	for _, keyID := range []string{"rs256-ec", "es384-p256", "hs256-ec", "es256-rsa", "rs256-ed"} {
+		_, err := keySet.Lookup(keyID)
+		require.Error(t, err, keyID)
+	}
+}
@@ -0,0 +1,152 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidKey     = errors.New("invalid key")
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// ParsePrivateKeyPEM parses an RSA, ECDSA or Ed25519 private key encoded as
+// PKCS#8, PKCS#1 or SEC 1 PEM.
+func ParsePrivateKeyPEM(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return checkKeyType(key)
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedKey, block.Type)
+}
+
+// ParsePublicKeyPEM parses an RSA, ECDSA or Ed25519 public key encoded as
+// PKIX or PKCS#1 PEM, or extracts it from a certificate.
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return checkKeyType(key)
+	case "CERTIFICATE":
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return checkKeyType(certificate.PublicKey)
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedKey, block.Type)
+}
+
+func LoadPrivateKeyFile(path string) (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKeyPEM(data)
+}
+
+func LoadPublicKeyFile(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKeyPEM(data)
+}
+
+// PublicKeyOf returns the public half of a private key, or nil if the key
+// type is not supported.
+func PublicKeyOf(key crypto.PrivateKey) crypto.PublicKey {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil
+	}
+	return signer.Public()
+}
+
+// SigningMethodForKey returns the default JWT algorithm for an asymmetric
+// public or private key, or nil if the key type is not supported.
+func SigningMethodForKey(key any) jwt.SigningMethod {
+	if private, ok := key.(crypto.Signer); ok {
+		key = private.Public()
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256
+		case elliptic.P384():
+			return jwt.SigningMethodES384
+		case elliptic.P521():
+			return jwt.SigningMethodES512
+		}
+	}
+
+	return nil
+}
+
+// signingMethodMatchesKey reports whether method can verify signatures made
+// with key: RS* and PS* need an RSA key, ES* an EC key on the matching curve
+// and EdDSA an Ed25519 key.
+func signingMethodMatchesKey(method jwt.SigningMethod, key crypto.PublicKey) bool {
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		k, ok := key.(*ecdsa.PublicKey)
+		return ok && k.Curve.Params().BitSize == m.CurveBits
+	case *jwt.SigningMethodEd25519:
+		_, ok := key.(ed25519.PublicKey)
+		return ok
+	}
+	return false
+}
+
+func checkKeyType(key any) (any, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey,
+		*rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+}
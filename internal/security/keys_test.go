@@ -0,0 +1,58 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeyPEM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ecDER, err := x509.MarshalECPrivateKey(ecdsaKey)
+	require.NoError(t, err)
+
+	ed25519DER, err := x509.MarshalPKCS8PrivateKey(ed25519Key)
+	require.NoError(t, err)
+
+	privateBlocks := []*pem.Block{
+		{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+		{Type: "EC PRIVATE KEY", Bytes: ecDER},
+		{Type: "PRIVATE KEY", Bytes: ed25519DER},
+	}
+
+	for _, block := range privateBlocks {
+		t.Run(block.Type, func(t *testing.T) {
+			key, err := ParsePrivateKeyPEM(pem.EncodeToMemory(block))
+			require.NoError(t, err)
+			require.NotNil(t, SigningMethodForKey(key))
+
+			publicDER, err := x509.MarshalPKIXPublicKey(PublicKeyOf(key))
+			require.NoError(t, err)
+
+			public, err := ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+			require.NoError(t, err)
+			require.Equal(t, SigningMethodForKey(key), SigningMethodForKey(public))
+		})
+	}
+
+	_, err = ParsePrivateKeyPEM([]byte("not a key"))
+	require.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "UNKNOWN", Bytes: []byte{1}}))
+	require.ErrorIs(t, err, ErrUnsupportedKey)
+}
@@ -0,0 +1,202 @@
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken  = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+)
+
+const refreshTokenSize = 32
+
+// TokenPair is the result of a login or a refresh: a short-lived access token
+// and the opaque refresh token that can be exchanged for the next pair.
+type TokenPair struct {
+	AccessToken      string
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// RefreshToken is the persisted state of an opaque refresh token. The raw
+// token is never stored, only its SHA-256 hash as ID.
+type RefreshToken struct {
+	ID        string
+	FamilyID  string
+	Claims    *Claims
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+type RefreshTokenStore interface {
+	Save(ctx context.Context, token *RefreshToken) error
+	Find(ctx context.Context, id string) (*RefreshToken, error)
+	// Replace must atomically flag the token as used and save next in its
+	// place, returning ErrRefreshTokenReused if it was already used. When it
+	// fails, neither change is kept.
+	Replace(ctx context.Context, id string, usedAt time.Time, next *RefreshToken) error
+	RevokeFamily(ctx context.Context, familyID string, revokedAt time.Time) error
+	// RevokeSubject revokes every family whose claims belong to subject.
+	RevokeSubject(ctx context.Context, subject string, revokedAt time.Time) error
+}
+
+type RefreshTokenIssuer struct {
+	store    RefreshTokenStore
+	expireAt time.Duration
+	now      func() time.Time
+}
+
+type RefreshTokenIssuerParams struct {
+	ExpireAt time.Duration
+}
+
+func NewRefreshTokenIssuer(params RefreshTokenIssuerParams, store RefreshTokenStore) *RefreshTokenIssuer {
+	return &RefreshTokenIssuer{
+		store:    store,
+		expireAt: params.ExpireAt,
+		now:      time.Now,
+	}
+}
+
+// Issue starts a new token family for the given claims and returns the raw
+// refresh token with its expiration.
+func (r *RefreshTokenIssuer) Issue(ctx context.Context, claims *Claims) (string, time.Time, error) {
+	familyID, err := randomHex(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	rawToken, token, err := r.newToken(familyID, claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if err := r.store.Save(ctx, token); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return rawToken, token.ExpiresAt, nil
+}
+
+// Rotate exchanges a refresh token for a new one of the same family and
+// returns the claims it was issued for. Presenting a token that was already
+// rotated is treated as theft and revokes the whole family.
+func (r *RefreshTokenIssuer) Rotate(ctx context.Context, rawToken string) (string, time.Time, *Claims, error) {
+	current, err := r.find(ctx, rawToken)
+	if err != nil {
+		return "", time.Time{}, nil, err
+	}
+
+	now := r.now()
+
+	if current.UsedAt != nil {
+		return "", time.Time{}, nil, r.revokeReused(ctx, current, now)
+	}
+
+	if !now.Before(current.ExpiresAt) {
+		return "", time.Time{}, nil, ErrRefreshTokenExpired
+	}
+
+	rawToken, next, err := r.newToken(current.FamilyID, current.Claims)
+	if err != nil {
+		return "", time.Time{}, nil, err
+	}
+
+	if err := r.store.Replace(ctx, current.ID, now, next); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			return "", time.Time{}, nil, r.revokeReused(ctx, current, now)
+		}
+		return "", time.Time{}, nil, err
+	}
+
+	return rawToken, next.ExpiresAt, current.Claims, nil
+}
+
+// Revoke invalidates the family of the given refresh token, e.g. on logout.
+func (r *RefreshTokenIssuer) Revoke(ctx context.Context, rawToken string) error {
+	current, err := r.find(ctx, rawToken)
+	if err != nil {
+		return err
+	}
+
+	return r.store.RevokeFamily(ctx, current.FamilyID, r.now())
+}
+
+// RevokeSubject invalidates every refresh token of subject, e.g. after a
+// password reset.
+func (r *RefreshTokenIssuer) RevokeSubject(ctx context.Context, subject string) error {
+	return r.store.RevokeSubject(ctx, subject, r.now())
+}
+
+func (r *RefreshTokenIssuer) find(ctx context.Context, rawToken string) (*RefreshToken, error) {
+	if rawToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	token, err := r.store.Find(ctx, HashRefreshToken(rawToken))
+	if errors.Is(err, ErrRefreshTokenNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if token.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return token, nil
+}
+
+func (r *RefreshTokenIssuer) newToken(familyID string, claims *Claims) (string, *RefreshToken, error) {
+	buffer := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", nil, err
+	}
+
+	rawToken := base64.RawURLEncoding.EncodeToString(buffer)
+	now := r.now()
+
+	token := &RefreshToken{
+		ID:        HashRefreshToken(rawToken),
+		FamilyID:  familyID,
+		Claims:    claims,
+		ExpiresAt: now.Add(r.expireAt),
+		CreatedAt: now,
+	}
+
+	return rawToken, token, nil
+}
+
+func (r *RefreshTokenIssuer) revokeReused(ctx context.Context, token *RefreshToken, now time.Time) error {
+	if err := r.store.RevokeFamily(ctx, token.FamilyID, now); err != nil {
+		return errors.Join(ErrRefreshTokenReused, err)
+	}
+	return ErrRefreshTokenReused
+}
+
+// HashRefreshToken returns the identifier under which a raw refresh token is
+// persisted.
+func HashRefreshToken(rawToken string) string {
+	sum := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(size int) (string, error) {
+	buffer := make([]byte, size)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
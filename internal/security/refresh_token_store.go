@@ -0,0 +1,196 @@
+package security
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/v2code/b16/internal/database"
+)
+
+type MemoryRefreshTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]RefreshToken
+}
+
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{
+		tokens: map[string]RefreshToken{},
+	}
+}
+
+func (s *MemoryRefreshTokenStore) Save(ctx context.Context, token *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[token.ID] = *token
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) Find(ctx context.Context, id string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[id]
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+	return &token, nil
+}
+
+func (s *MemoryRefreshTokenStore) Replace(ctx context.Context, id string, usedAt time.Time, next *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[id]
+	if !ok {
+		return ErrRefreshTokenNotFound
+	}
+	if token.UsedAt != nil {
+		return ErrRefreshTokenReused
+	}
+
+	token.UsedAt = &usedAt
+	s.tokens[id] = token
+	s.tokens[next.ID] = *next
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, token := range s.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &revokedAt
+			s.tokens[id] = token
+		}
+	}
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeSubject(ctx context.Context, subject string, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, token := range s.tokens {
+		if token.Claims != nil && token.Claims.Subject == subject && token.RevokedAt == nil {
+			token.RevokedAt = &revokedAt
+			s.tokens[id] = token
+		}
+	}
+	return nil
+}
+
+// SQLRefreshTokenStore persists token families in the refresh_tokens table
+// through database.Database, so it joins any transaction carried by ctx.
+// Timestamps are stored in UTC.
+type SQLRefreshTokenStore struct {
+	db database.Database
+}
+
+func NewSQLRefreshTokenStore(db database.Database) *SQLRefreshTokenStore {
+	return &SQLRefreshTokenStore{db: db}
+}
+
+func (s *SQLRefreshTokenStore) Save(ctx context.Context, token *RefreshToken) error {
+	claims, err := json.Marshal(token.Claims)
+	if err != nil {
+		return err
+	}
+
+	var subject string
+	if token.Claims != nil {
+		subject = token.Claims.Subject
+	}
+
+	_, err = s.db.Executor(ctx).ExecContext(ctx,
+		`INSERT INTO refresh_tokens (id, family_id, subject, claims, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		token.ID, token.FamilyID, subject, string(claims), token.ExpiresAt.UTC(), token.CreatedAt.UTC(),
+	)
+	return err
+}
+
+func (s *SQLRefreshTokenStore) Find(ctx context.Context, id string) (*RefreshToken, error) {
+	var (
+		token     RefreshToken
+		claims    string
+		usedAt    sql.NullTime
+		revokedAt sql.NullTime
+	)
+
+	err := s.db.Executor(ctx).QueryRowContext(ctx,
+		`SELECT id, family_id, claims, expires_at, created_at, used_at, revoked_at FROM refresh_tokens WHERE id = $1`,
+		id,
+	).Scan(&token.ID, &token.FamilyID, &claims, &token.ExpiresAt, &token.CreatedAt, &usedAt, &revokedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(claims), &token.Claims); err != nil {
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+
+	return &token, nil
+}
+
+// Replace marks the token as used and saves next in one transaction, so a
+// failed save leaves the presented token usable for a retry.
+func (s *SQLRefreshTokenStore) Replace(ctx context.Context, id string, usedAt time.Time, next *RefreshToken) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := s.markUsed(ctx, id, usedAt); err != nil {
+			return err
+		}
+		return s.Save(ctx, next)
+	})
+}
+
+func (s *SQLRefreshTokenStore) markUsed(ctx context.Context, id string, usedAt time.Time) error {
+	result, err := s.db.Executor(ctx).ExecContext(ctx,
+		`UPDATE refresh_tokens SET used_at = $2 WHERE id = $1 AND used_at IS NULL`,
+		id, usedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRefreshTokenReused
+	}
+
+	return nil
+}
+
+func (s *SQLRefreshTokenStore) RevokeFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	_, err := s.db.Executor(ctx).ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $2 WHERE family_id = $1 AND revoked_at IS NULL`,
+		familyID, revokedAt.UTC(),
+	)
+	return err
+}
+
+func (s *SQLRefreshTokenStore) RevokeSubject(ctx context.Context, subject string, revokedAt time.Time) error {
+	_, err := s.db.Executor(ctx).ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $2 WHERE subject = $1 AND revoked_at IS NULL`,
+		subject, revokedAt.UTC(),
+	)
+	return err
+}
@@ -0,0 +1,178 @@
+package security
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRefreshTokenIssuer(now *time.Time) (*RefreshTokenIssuer, *MemoryRefreshTokenStore) {
+	store := NewMemoryRefreshTokenStore()
+	issuer := NewRefreshTokenIssuer(RefreshTokenIssuerParams{ExpireAt: time.Hour}, store)
+	issuer.now = func() time.Time { return *now }
+	return issuer, store
+}
+
+func TestRefreshTokenIssuer_Rotate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	issuer, _ := newTestRefreshTokenIssuer(&now)
+
+	claims := &Claims{Email: "admin@email.com", Roles: []string{"ADMIN"}}
+
+	first, _, err := issuer.Issue(ctx, claims)
+	require.NoError(t, err)
+
+	second, _, rotatedClaims, err := issuer.Rotate(ctx, first)
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+	require.Equal(t, claims.Email, rotatedClaims.Email)
+	require.Equal(t, claims.Roles, rotatedClaims.Roles)
+
+	third, _, _, err := issuer.Rotate(ctx, second)
+	require.NoError(t, err)
+	require.NotEmpty(t, third)
+}
+
+func TestRefreshTokenIssuer_ReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	issuer, _ := newTestRefreshTokenIssuer(&now)
+
+	first, _, err := issuer.Issue(ctx, &Claims{Email: "admin@email.com"})
+	require.NoError(t, err)
+
+	second, _, _, err := issuer.Rotate(ctx, first)
+	require.NoError(t, err)
+
+	_, _, _, err = issuer.Rotate(ctx, first)
+	require.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	_, _, _, err = issuer.Rotate(ctx, second)
+	require.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestRefreshTokenIssuer_Errors(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	issuer, _ := newTestRefreshTokenIssuer(&now)
+
+	token, _, err := issuer.Issue(ctx, &Claims{Email: "admin@email.com"})
+	require.NoError(t, err)
+
+	_, _, _, err = issuer.Rotate(ctx, "unknown")
+	require.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	_, _, _, err = issuer.Rotate(ctx, "")
+	require.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	now = now.Add(2 * time.Hour)
+	_, _, _, err = issuer.Rotate(ctx, token)
+	require.ErrorIs(t, err, ErrRefreshTokenExpired)
+}
+
+func TestRefreshTokenIssuer_Revoke(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	issuer, _ := newTestRefreshTokenIssuer(&now)
+
+	token, _, err := issuer.Issue(ctx, &Claims{Email: "admin@email.com"})
+	require.NoError(t, err)
+
+	require.NoError(t, issuer.Revoke(ctx, token))
+
+	_, _, _, err = issuer.Rotate(ctx, token)
+	require.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestRefreshTokenIssuer_SQLStore(t *testing.T) {
+	ctx := context.Background()
+
+	issuer := NewRefreshTokenIssuer(
+		RefreshTokenIssuerParams{ExpireAt: time.Hour},
+		NewSQLRefreshTokenStore(newTestDatabase(t)),
+	)
+
+	first, _, err := issuer.Issue(ctx, &Claims{Subject: "user-1", Roles: []string{"ADMIN"}})
+	require.NoError(t, err)
+
+	second, _, claims, err := issuer.Rotate(ctx, first)
+	require.NoError(t, err)
+	require.Equal(t, "user-1", claims.Subject)
+	require.Equal(t, []string{"ADMIN"}, claims.Roles)
+
+	_, _, _, err = issuer.Rotate(ctx, first)
+	require.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	_, _, _, err = issuer.Rotate(ctx, second)
+	require.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestRefreshTokenIssuer_RevokeSubject(t *testing.T) {
+	ctx := context.Background()
+
+	stores := map[string]RefreshTokenStore{
+		"memory": NewMemoryRefreshTokenStore(),
+		"sql":    NewSQLRefreshTokenStore(newTestDatabase(t)),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			issuer := NewRefreshTokenIssuer(RefreshTokenIssuerParams{ExpireAt: time.Hour}, store)
+
+			first, _, err := issuer.Issue(ctx, &Claims{Subject: "user-1"})
+			require.NoError(t, err)
+			second, _, err := issuer.Issue(ctx, &Claims{Subject: "user-1"})
+			require.NoError(t, err)
+			other, _, err := issuer.Issue(ctx, &Claims{Subject: "user-2"})
+			require.NoError(t, err)
+
+			require.NoError(t, issuer.RevokeSubject(ctx, "user-1"))
+
+			_, _, _, err = issuer.Rotate(ctx, first)
+			require.ErrorIs(t, err, ErrInvalidRefreshToken)
+			_, _, _, err = issuer.Rotate(ctx, second)
+			require.ErrorIs(t, err, ErrInvalidRefreshToken)
+			_, _, _, err = issuer.Rotate(ctx, other)
+			require.NoError(t, err)
+
+			third, _, err := issuer.Issue(ctx, &Claims{Subject: "user-1"})
+			require.NoError(t, err)
+			_, _, _, err = issuer.Rotate(ctx, third)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRefreshTokenIssuer_SQLStoreSaveFailure(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	issuer := NewRefreshTokenIssuer(
+		RefreshTokenIssuerParams{ExpireAt: time.Hour},
+		NewSQLRefreshTokenStore(db),
+	)
+
+	first, _, err := issuer.Issue(ctx, &Claims{Subject: "user-1"})
+	require.NoError(t, err)
+
+	_, err = db.Executor(ctx).ExecContext(ctx,
+		`CREATE TRIGGER fail_refresh_token_insert BEFORE INSERT ON refresh_tokens BEGIN SELECT RAISE(ABORT, 'save failed'); END`,
+	)
+	require.NoError(t, err)
+
+	_, _, _, err = issuer.Rotate(ctx, first)
+	require.ErrorContains(t, err, "save failed")
+
+	_, err = db.Executor(ctx).ExecContext(ctx, `DROP TRIGGER fail_refresh_token_insert`)
+	require.NoError(t, err)
+
+	second, _, claims, err := issuer.Rotate(ctx, first)
+	require.NoError(t, err)
+	require.Equal(t, "user-1", claims.Subject)
+
+	_, _, _, err = issuer.Rotate(ctx, second)
+	require.NoError(t, err)
+}
@@ -0,0 +1,200 @@
+package security
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/v2code/b16/internal/database"
+)
+
+// RevocationStore is a denylist of access tokens. Single tokens are revoked
+// by their jti; RevokeSubject rejects every token of a subject issued before
+// the given instant, e.g. after a password change. Since iat only has second
+// precision, the instant is truncated to the second: tokens issued during
+// that second stay valid, so a login right after the revocation is not
+// rejected.
+type RevocationStore interface {
+	Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error
+	RevokeSubject(ctx context.Context, subject string, before time.Time) error
+	IsRevoked(ctx context.Context, claims *Claims) (bool, error)
+}
+
+func isRevokedBySubject(claims *Claims, before time.Time) bool {
+	return claims.IssuedAt.IsZero() || claims.IssuedAt.Truncate(time.Second).Before(before.Truncate(time.Second))
+}
+
+type subjectRevocation struct {
+	before    time.Time
+	expiresAt time.Time
+}
+
+// MemoryRevocationStore keeps revocations in memory. Revoked token IDs are
+// evicted once the token itself expires; subject revocations are evicted
+// after ttl, which must be at least the access token lifetime.
+type MemoryRevocationStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	tokens   map[string]time.Time
+	subjects map[string]subjectRevocation
+	now      func() time.Time
+}
+
+func NewMemoryRevocationStore(ttl time.Duration) *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		ttl:      ttl,
+		tokens:   map[string]time.Time{},
+		subjects: map[string]subjectRevocation{},
+		now:      time.Now,
+	}
+}
+
+func (s *MemoryRevocationStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if tokenID == "" {
+		return ErrInvalidToken
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evict()
+	s.tokens[tokenID] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeSubject(ctx context.Context, subject string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evict()
+	s.subjects[subject] = subjectRevocation{
+		before:    before.Truncate(time.Second),
+		expiresAt: before.Add(s.ttl),
+	}
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	if expiresAt, ok := s.tokens[claims.ID]; ok && now.Before(expiresAt) {
+		return true, nil
+	}
+
+	if revocation, ok := s.subjects[claims.Subject]; ok && now.Before(revocation.expiresAt) {
+		return isRevokedBySubject(claims, revocation.before), nil
+	}
+
+	return false, nil
+}
+
+func (s *MemoryRevocationStore) evict() {
+	now := s.now()
+
+	for id, expiresAt := range s.tokens {
+		if !now.Before(expiresAt) {
+			delete(s.tokens, id)
+		}
+	}
+
+	for subject, revocation := range s.subjects {
+		if !now.Before(revocation.expiresAt) {
+			delete(s.subjects, subject)
+		}
+	}
+}
+
+// SQLRevocationStore keeps revocations in the revoked_tokens and
+// revoked_subjects tables. Expired rows are ignored and can be removed with
+// Purge. Timestamps are stored in UTC.
+type SQLRevocationStore struct {
+	db  database.Database
+	ttl time.Duration
+	now func() time.Time
+}
+
+func NewSQLRevocationStore(db database.Database, ttl time.Duration) *SQLRevocationStore {
+	return &SQLRevocationStore{
+		db:  db,
+		ttl: ttl,
+		now: time.Now,
+	}
+}
+
+func (s *SQLRevocationStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if tokenID == "" {
+		return ErrInvalidToken
+	}
+
+	_, err := s.db.Executor(ctx).ExecContext(ctx,
+		`INSERT INTO revoked_tokens (id, expires_at) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`,
+		tokenID, expiresAt.UTC(),
+	)
+	return err
+}
+
+func (s *SQLRevocationStore) RevokeSubject(ctx context.Context, subject string, before time.Time) error {
+	_, err := s.db.Executor(ctx).ExecContext(ctx,
+		`INSERT INTO revoked_subjects (subject, revoked_before, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (subject) DO UPDATE SET revoked_before = EXCLUDED.revoked_before, expires_at = EXCLUDED.expires_at`,
+		subject, before.Truncate(time.Second).UTC(), before.Add(s.ttl).UTC(),
+	)
+	return err
+}
+
+func (s *SQLRevocationStore) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	executor := s.db.Executor(ctx)
+	now := s.now().UTC()
+
+	if claims.ID != "" {
+		var id string
+		err := executor.QueryRowContext(ctx,
+			`SELECT id FROM revoked_tokens WHERE id = $1 AND expires_at > $2`,
+			claims.ID, now,
+		).Scan(&id)
+
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return false, err
+		}
+	}
+
+	if claims.Subject == "" {
+		return false, nil
+	}
+
+	var before time.Time
+	err := executor.QueryRowContext(ctx,
+		`SELECT revoked_before FROM revoked_subjects WHERE subject = $1 AND expires_at > $2`,
+		claims.Subject, now,
+	).Scan(&before)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return isRevokedBySubject(claims, before), nil
+}
+
+// Purge deletes revocations that outlived the tokens they refer to.
+func (s *SQLRevocationStore) Purge(ctx context.Context) error {
+	executor := s.db.Executor(ctx)
+	now := s.now().UTC()
+
+	if _, err := executor.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= $1`, now); err != nil {
+		return err
+	}
+
+	_, err := executor.ExecContext(ctx, `DELETE FROM revoked_subjects WHERE expires_at <= $1`, now)
+	return err
+}
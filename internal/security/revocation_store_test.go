@@ -0,0 +1,134 @@
+package security
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type TestRevocationParams struct {
+	Name          string
+	Claims        *Claims
+	ExpectRevoked bool
+}
+
+func TestMemoryRevocationStore_IsRevoked(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	store := NewMemoryRevocationStore(time.Hour)
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Revoke(ctx, "revoked-id", now.Add(time.Hour)))
+	require.NoError(t, store.RevokeSubject(ctx, "user-1", now.Truncate(time.Second).Add(700*time.Millisecond)))
+
+	cases := []TestRevocationParams{
+		{
+			Name:          "revoked token id",
+			Claims:        &Claims{ID: "revoked-id", Subject: "user-2", IssuedAt: now},
+			ExpectRevoked: true,
+		},
+		{
+			Name:          "token issued before subject revocation",
+			Claims:        &Claims{ID: "other-id", Subject: "user-1", IssuedAt: now.Add(-time.Minute)},
+			ExpectRevoked: true,
+		},
+		{
+			Name:          "token issued after subject revocation",
+			Claims:        &Claims{ID: "other-id", Subject: "user-1", IssuedAt: now.Add(time.Minute)},
+			ExpectRevoked: false,
+		},
+		{
+			Name:          "token issued in the second of the revocation",
+			Claims:        &Claims{ID: "other-id", Subject: "user-1", IssuedAt: now.Truncate(time.Second).Add(900 * time.Millisecond)},
+			ExpectRevoked: false,
+		},
+		{
+			Name:          "token issued in the previous second",
+			Claims:        &Claims{ID: "other-id", Subject: "user-1", IssuedAt: now.Truncate(time.Second).Add(-100 * time.Millisecond)},
+			ExpectRevoked: true,
+		},
+		{
+			Name:          "unrelated token",
+			Claims:        &Claims{ID: "other-id", Subject: "user-2", IssuedAt: now},
+			ExpectRevoked: false,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			revoked, err := store.IsRevoked(ctx, tt.Claims)
+			require.NoError(t, err)
+			require.Equal(t, tt.ExpectRevoked, revoked)
+		})
+	}
+}
+
+func TestMemoryRevocationStore_Eviction(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	store := NewMemoryRevocationStore(time.Hour)
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Revoke(ctx, "revoked-id", now.Add(time.Minute)))
+	require.NoError(t, store.RevokeSubject(ctx, "user-1", now))
+
+	now = now.Add(2 * time.Hour)
+
+	revoked, err := store.IsRevoked(ctx, &Claims{ID: "revoked-id", Subject: "user-1", IssuedAt: now.Add(-3 * time.Hour)})
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	require.NoError(t, store.Revoke(ctx, "another-id", now.Add(time.Minute)))
+	require.Len(t, store.tokens, 1)
+	require.Empty(t, store.subjects)
+}
+
+func TestSQLRevocationStore_IsRevoked(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	store := NewSQLRevocationStore(newTestDatabase(t), time.Hour)
+
+	require.NoError(t, store.Revoke(ctx, "revoked-id", now.Add(time.Hour)))
+	require.NoError(t, store.Revoke(ctx, "revoked-id", now.Add(time.Hour)))
+	require.NoError(t, store.Revoke(ctx, "expired-id", now.Add(-time.Minute)))
+	require.NoError(t, store.RevokeSubject(ctx, "user-1", now.Add(-time.Hour)))
+	require.NoError(t, store.RevokeSubject(ctx, "user-1", now))
+
+	cases := []TestRevocationParams{
+		{
+			Name:          "revoked token id",
+			Claims:        &Claims{ID: "revoked-id", Subject: "user-2", IssuedAt: now},
+			ExpectRevoked: true,
+		},
+		{
+			Name:          "revocation of expired token",
+			Claims:        &Claims{ID: "expired-id", Subject: "user-2", IssuedAt: now},
+			ExpectRevoked: false,
+		},
+		{
+			Name:          "token issued before latest subject revocation",
+			Claims:        &Claims{ID: "other-id", Subject: "user-1", IssuedAt: now.Add(-time.Minute)},
+			ExpectRevoked: true,
+		},
+		{
+			Name:          "token issued after subject revocation",
+			Claims:        &Claims{ID: "other-id", Subject: "user-1", IssuedAt: now.Add(time.Minute)},
+			ExpectRevoked: false,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			revoked, err := store.IsRevoked(ctx, tt.Claims)
+			require.NoError(t, err)
+			require.Equal(t, tt.ExpectRevoked, revoked)
+		})
+	}
+
+	require.NoError(t, store.Purge(ctx))
+}
@@ -1,7 +1,9 @@
 package security
 
 import (
+	"crypto"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -10,53 +12,139 @@ import (
 var (
 	ErrInvalidSigningMethod = errors.New("invalid signing method")
 	ErrInvalidToken         = errors.New("invalid token")
+	ErrVerifyOnlyIssuer     = errors.New("issuer has no signing key")
+	ErrInvalidTokenType     = errors.New("invalid token type")
 )
 
-type Claims struct {
-	Email string
-	Roles []string
-}
-
-type internalClaims struct {
-	Email string
-	Roles []string
-	jwt.RegisteredClaims
-}
+// DefaultTokenType is the typ header of access tokens.
+const DefaultTokenType = "JWT"
 
 type JwtIssuer struct {
-	secretKey     []byte
+	keySet        *KeySet
+	signingKey    any
+	verifyKey     any
 	expireAt      time.Duration
 	issuer        string
+	audience      []string
+	leeway        time.Duration
+	tokenType     string
 	signingMethod jwt.SigningMethod
 }
 
+// JwtIssuerParams configures either a shared secret (HS256) or an asymmetric
+// key pair. With a PrivateKey the algorithm is derived from the key type
+// (RS256, ES256/384/512 or EdDSA) unless SigningMethod overrides it; with only
+// a PublicKey the issuer can verify tokens but not create them. A KeySet takes
+// precedence over the other keys and stamps the kid header on every token.
+//
+// Audience is stamped on tokens whose claims carry none, and Decode requires
+// tokens to name at least one of them. Leeway is the clock skew tolerated
+// when checking exp, nbf and iat.
+//
+// Type is the typ header stamped on created tokens and required on decoded
+// ones, so tokens meant for another purpose cannot pass as access tokens even
+// when they share the signing key. It defaults to DefaultTokenType, and only
+// then are tokens without typ accepted.
 type JwtIssuerParams struct {
-	SecretKey []byte
-	ExpireAt  time.Duration
-	Issuer    string
+	KeySet        *KeySet
+	SecretKey     []byte
+	PrivateKey    crypto.PrivateKey
+	PublicKey     crypto.PublicKey
+	SigningMethod jwt.SigningMethod
+	ExpireAt      time.Duration
+	Issuer        string
+	Audience      []string
+	Leeway        time.Duration
+	Type          string
 }
 
 func NewJwtIssuer(params JwtIssuerParams) TokenIssuer[*Claims] {
-	return &JwtIssuer{
-		secretKey:     params.SecretKey,
+	issuer := &JwtIssuer{
+		keySet:        params.KeySet,
 		expireAt:      params.ExpireAt,
 		issuer:        params.Issuer,
-		signingMethod: jwt.SigningMethodHS256,
+		audience:      params.Audience,
+		leeway:        params.Leeway,
+		tokenType:     params.Type,
+		signingMethod: params.SigningMethod,
+	}
+
+	if issuer.tokenType == "" {
+		issuer.tokenType = DefaultTokenType
+	}
+
+	switch {
+	case params.PrivateKey != nil:
+		issuer.signingKey = params.PrivateKey
+		issuer.verifyKey = PublicKeyOf(params.PrivateKey)
+	case params.PublicKey != nil:
+		issuer.verifyKey = params.PublicKey
+	default:
+		issuer.signingKey = params.SecretKey
+		issuer.verifyKey = params.SecretKey
+		if issuer.signingMethod == nil {
+			issuer.signingMethod = jwt.SigningMethodHS256
+		}
+	}
+
+	if issuer.signingMethod == nil {
+		issuer.signingMethod = SigningMethodForKey(issuer.verifyKey)
 	}
+
+	return issuer
 }
 
 func (j *JwtIssuer) Create(claims *Claims) (string, error) {
 
-	token := jwt.NewWithClaims(j.signingMethod, internalClaims{
-		Roles: claims.Roles,
-		Email: claims.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    j.issuer,
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.expireAt)),
-		},
-	})
+	signingMethod, signingKey, keyID := j.signingMethod, j.signingKey, ""
 
-	signedToken, err := token.SignedString(j.secretKey)
+	if j.keySet != nil {
+		key, err := j.keySet.Active()
+		if err != nil {
+			return "", err
+		}
+		signingMethod, signingKey, keyID = key.Method, key.PrivateKey, key.ID
+	}
+
+	if signingMethod == nil {
+		return "", ErrInvalidSigningMethod
+	}
+
+	if signingKey == nil {
+		return "", ErrVerifyOnlyIssuer
+	}
+
+	tokenID := claims.ID
+	if tokenID == "" {
+		var err error
+		if tokenID, err = randomHex(16); err != nil {
+			return "", err
+		}
+	}
+
+	audience := claims.Audience
+	if len(audience) == 0 {
+		audience = j.audience
+	}
+
+	now := time.Now()
+
+	token := jwt.NewWithClaims(signingMethod, newInternalClaims(claims, jwt.RegisteredClaims{
+		ID:        tokenID,
+		Subject:   claims.Subject,
+		Issuer:    j.issuer,
+		Audience:  audience,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(j.expireAt)),
+		NotBefore: numericDateOrNil(claims.NotBefore),
+	}))
+
+	token.Header["typ"] = j.tokenType
+	if keyID != "" {
+		token.Header["kid"] = keyID
+	}
+
+	signedToken, err := token.SignedString(signingKey)
 
 	if err != nil {
 		return "", err
@@ -67,14 +155,64 @@ func (j *JwtIssuer) Create(claims *Claims) (string, error) {
 
 func (j *JwtIssuer) Decode(rawToken string) (*Claims, error) {
 
-	internalClaims := &internalClaims{}
+	options := validationOptions(j.issuer, j.audience, j.leeway)
 
-	token, err := jwt.ParseWithClaims(rawToken, internalClaims, func(token *jwt.Token) (any, error) {
-		if token.Method != j.signingMethod {
+	if j.keySet != nil {
+		return decodeClaims(rawToken, j.tokenType, keySetKeyfunc(j.keySet.Lookup), options...)
+	}
+
+	if j.signingMethod == nil {
+		return nil, ErrInvalidSigningMethod
+	}
+
+	return decodeClaims(rawToken, j.tokenType, func(token *jwt.Token) (any, error) {
+		if token.Method.Alg() != j.signingMethod.Alg() {
+			return nil, ErrInvalidSigningMethod
+		}
+		return j.verifyKey, nil
+	}, append(options, jwt.WithValidMethods([]string{j.signingMethod.Alg()}))...)
+}
+
+func validationOptions(issuer string, audience []string, leeway time.Duration) []jwt.ParserOption {
+	options := []jwt.ParserOption{jwt.WithLeeway(leeway), jwt.WithExpirationRequired()}
+
+	if issuer != "" {
+		options = append(options, jwt.WithIssuer(issuer))
+	}
+	if len(audience) > 0 {
+		options = append(options, jwt.WithAudience(audience...))
+	}
+
+	return options
+}
+
+// keySetKeyfunc resolves the verification key from the kid header and
+// refuses tokens whose algorithm differs from the one bound to that key.
+func keySetKeyfunc(lookup func(keyID string) (*SigningKey, error)) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		keyID, _ := token.Header["kid"].(string)
+		if keyID == "" {
+			return nil, ErrKeyNotFound
+		}
+
+		key, err := lookup(keyID)
+		if err != nil {
+			return nil, err
+		}
+
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, ErrInvalidSigningMethod
 		}
-		return j.secretKey, nil
-	})
+
+		return key.PublicKey, nil
+	}
+}
+
+func decodeClaims(rawToken string, tokenType string, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (*Claims, error) {
+
+	internalClaims := &internalClaims{}
+
+	token, err := jwt.ParseWithClaims(rawToken, internalClaims, keyFunc, options...)
 
 	if err != nil {
 		return nil, err
@@ -84,8 +222,10 @@ func (j *JwtIssuer) Decode(rawToken string) (*Claims, error) {
 		return nil, ErrInvalidToken
 	}
 
-	return &Claims{
-		Email: internalClaims.Email,
-		Roles: internalClaims.Roles,
-	}, nil
+	typ, _ := token.Header["typ"].(string)
+	if !strings.EqualFold(typ, tokenType) && (typ != "" || tokenType != DefaultTokenType) {
+		return nil, ErrInvalidTokenType
+	}
+
+	return internalClaims.toClaims(), nil
 }
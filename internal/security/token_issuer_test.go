@@ -0,0 +1,281 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJwtIssuer_CreateDecode(t *testing.T) {
+	issuer := NewJwtIssuer(JwtIssuerParams{
+		SecretKey: []byte("secret"),
+		ExpireAt:  time.Hour,
+		Issuer:    "b16",
+	})
+
+	token, err := issuer.Create(&Claims{
+		Subject: "user-1",
+		Email:   "admin@email.com",
+		Roles:   []string{"ADMIN"},
+	})
+	require.NoError(t, err)
+
+	claims, err := issuer.Decode(token)
+	require.NoError(t, err)
+	require.NotEmpty(t, claims.ID)
+	require.Equal(t, "user-1", claims.Subject)
+	require.Equal(t, "admin@email.com", claims.Email)
+	require.Equal(t, []string{"ADMIN"}, claims.Roles)
+	require.WithinDuration(t, time.Now(), claims.IssuedAt, time.Minute)
+	require.WithinDuration(t, time.Now().Add(time.Hour), claims.ExpiresAt, time.Minute)
+
+	other, err := issuer.Create(&Claims{Subject: "user-1"})
+	require.NoError(t, err)
+
+	otherClaims, err := issuer.Decode(other)
+	require.NoError(t, err)
+	require.NotEqual(t, claims.ID, otherClaims.ID)
+}
+
+func TestJwtIssuer_DecodeInvalid(t *testing.T) {
+	issuer := NewJwtIssuer(JwtIssuerParams{
+		SecretKey: []byte("secret"),
+		ExpireAt:  time.Hour,
+		Issuer:    "b16",
+	})
+
+	other := NewJwtIssuer(JwtIssuerParams{
+		SecretKey: []byte("other"),
+		ExpireAt:  time.Hour,
+		Issuer:    "b16",
+	})
+
+	token, err := other.Create(&Claims{Subject: "user-1"})
+	require.NoError(t, err)
+
+	_, err = issuer.Decode(token)
+	require.Error(t, err)
+
+	expired := NewJwtIssuer(JwtIssuerParams{
+		SecretKey: []byte("secret"),
+		ExpireAt:  -time.Hour,
+		Issuer:    "b16",
+	})
+
+	token, err = expired.Create(&Claims{Subject: "user-1"})
+	require.NoError(t, err)
+
+	_, err = issuer.Decode(token)
+	require.Error(t, err)
+}
+
+type TestAsymmetricIssuerParams struct {
+	Name       string
+	PrivateKey crypto.PrivateKey
+	ExpectAlg  string
+}
+
+func TestJwtIssuer_Asymmetric(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	cases := []TestAsymmetricIssuerParams{
+		{Name: "rsa", PrivateKey: rsaKey, ExpectAlg: "RS256"},
+		{Name: "ecdsa", PrivateKey: ecdsaKey, ExpectAlg: "ES256"},
+		{Name: "ed25519", PrivateKey: ed25519Key, ExpectAlg: "EdDSA"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			signer := NewJwtIssuer(JwtIssuerParams{
+				PrivateKey: tt.PrivateKey,
+				ExpireAt:   time.Hour,
+				Issuer:     "b16",
+			})
+
+			verifier := NewJwtIssuer(JwtIssuerParams{
+				PublicKey: PublicKeyOf(tt.PrivateKey),
+				ExpireAt:  time.Hour,
+				Issuer:    "b16",
+			})
+
+			token, err := signer.Create(&Claims{Subject: "user-1"})
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			require.NoError(t, err)
+			require.Equal(t, tt.ExpectAlg, parsed.Method.Alg())
+
+			claims, err := verifier.Decode(token)
+			require.NoError(t, err)
+			require.Equal(t, "user-1", claims.Subject)
+
+			_, err = verifier.Create(&Claims{Subject: "user-1"})
+			require.ErrorIs(t, err, ErrVerifyOnlyIssuer)
+		})
+	}
+}
+
+func TestJwtIssuer_RejectsOtherAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	verifier := NewJwtIssuer(JwtIssuerParams{
+		PublicKey: &rsaKey.PublicKey,
+		ExpireAt:  time.Hour,
+		Issuer:    "b16",
+	})
+
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+
+	hmacToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user-1"}).
+		SignedString(publicKeyDER)
+	require.NoError(t, err)
+
+	_, err = verifier.Decode(hmacToken)
+	require.Error(t, err)
+
+	noneToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "user-1"}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	_, err = verifier.Decode(noneToken)
+	require.Error(t, err)
+}
+
+func TestJwtIssuer_RegisteredClaims(t *testing.T) {
+	issuer := NewJwtIssuer(JwtIssuerParams{
+		SecretKey: []byte("secret"),
+		ExpireAt:  time.Hour,
+		Issuer:    "b16",
+		Audience:  []string{"b16-api"},
+	})
+
+	notBefore := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	token, err := issuer.Create(&Claims{
+		ID:        "token-id",
+		Subject:   "user-1",
+		Email:     "admin@email.com",
+		NotBefore: notBefore,
+		Custom: map[string]any{
+			"tenant": "acme",
+			"sub":    "ignored",
+		},
+	})
+	require.NoError(t, err)
+
+	claims, err := issuer.Decode(token)
+	require.NoError(t, err)
+	require.Equal(t, "token-id", claims.ID)
+	require.Equal(t, "user-1", claims.Subject)
+	require.Equal(t, "b16", claims.Issuer)
+	require.Equal(t, []string{"b16-api"}, claims.Audience)
+	require.True(t, claims.HasAudience("b16-api"))
+	require.True(t, claims.NotBefore.Equal(notBefore))
+
+	tenant, ok := claims.Claim("tenant")
+	require.True(t, ok)
+	require.Equal(t, "acme", tenant)
+
+	_, ok = claims.Claim("sub")
+	require.False(t, ok)
+}
+
+type TestDecodeValidationParams struct {
+	Name      string
+	Signer    JwtIssuerParams
+	Claims    *Claims
+	ExpectErr error
+}
+
+func TestJwtIssuer_DecodeValidation(t *testing.T) {
+	verifier := NewJwtIssuer(JwtIssuerParams{
+		SecretKey: []byte("secret"),
+		ExpireAt:  time.Hour,
+		Issuer:    "b16",
+		Audience:  []string{"b16-api"},
+		Leeway:    time.Minute,
+	})
+
+	cases := []TestDecodeValidationParams{
+		{
+			Name:   "valid audience",
+			Signer: JwtIssuerParams{SecretKey: []byte("secret"), ExpireAt: time.Hour, Issuer: "b16"},
+			Claims: &Claims{Audience: []string{"other", "b16-api"}},
+		},
+		{
+			Name:      "wrong issuer",
+			Signer:    JwtIssuerParams{SecretKey: []byte("secret"), ExpireAt: time.Hour, Issuer: "other"},
+			Claims:    &Claims{Audience: []string{"b16-api"}},
+			ExpectErr: jwt.ErrTokenInvalidIssuer,
+		},
+		{
+			Name:      "wrong audience",
+			Signer:    JwtIssuerParams{SecretKey: []byte("secret"), ExpireAt: time.Hour, Issuer: "b16"},
+			Claims:    &Claims{Audience: []string{"other"}},
+			ExpectErr: jwt.ErrTokenInvalidAudience,
+		},
+		{
+			Name:      "missing audience",
+			Signer:    JwtIssuerParams{SecretKey: []byte("secret"), ExpireAt: time.Hour, Issuer: "b16"},
+			Claims:    &Claims{},
+			ExpectErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			Name:   "expired within leeway",
+			Signer: JwtIssuerParams{SecretKey: []byte("secret"), ExpireAt: -30 * time.Second, Issuer: "b16"},
+			Claims: &Claims{Audience: []string{"b16-api"}},
+		},
+		{
+			Name:      "expired beyond leeway",
+			Signer:    JwtIssuerParams{SecretKey: []byte("secret"), ExpireAt: -2 * time.Minute, Issuer: "b16"},
+			Claims:    &Claims{Audience: []string{"b16-api"}},
+			ExpectErr: jwt.ErrTokenExpired,
+		},
+		{
+			Name:      "other token type",
+			Signer:    JwtIssuerParams{SecretKey: []byte("secret"), ExpireAt: time.Hour, Issuer: "b16", Type: "refresh+jwt"},
+			Claims:    &Claims{Audience: []string{"b16-api"}},
+			ExpectErr: ErrInvalidTokenType,
+		},
+		{
+			Name:      "not yet valid",
+			Signer:    JwtIssuerParams{SecretKey: []byte("secret"), ExpireAt: time.Hour, Issuer: "b16"},
+			Claims:    &Claims{Audience: []string{"b16-api"}, NotBefore: time.Now().Add(time.Hour)},
+			ExpectErr: jwt.ErrTokenNotValidYet,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			token, err := NewJwtIssuer(tt.Signer).Create(tt.Claims)
+			require.NoError(t, err)
+
+			_, err = verifier.Decode(token)
+
+			if tt.ExpectErr != nil {
+				require.ErrorIs(t, err, tt.ExpectErr)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidTOTPSecret = errors.New("invalid totp secret")
+	ErrInvalidTOTPCode   = errors.New("invalid totp code")
+	ErrTOTPCodeReused    = errors.New("totp code already used")
+)
+
+const totpSecretSize = 20
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TOTPParams struct {
+	// Issuer names the account in authenticator apps.
+	Issuer string
+	// Digits defaults to 6.
+	Digits int
+	// Period defaults to 30 seconds.
+	Period time.Duration
+	// Skew is how many periods before and after the current one are
+	// accepted, to tolerate clock drift. Zero accepts only the current one.
+	Skew int
+}
+
+// TOTP generates and checks RFC 6238 time-based one-time passwords with
+// HMAC-SHA1, the variant every authenticator app supports.
+type TOTP struct {
+	issuer string
+	digits int
+	period time.Duration
+	skew   int
+	now    func() time.Time
+}
+
+func NewTOTP(params TOTPParams) *TOTP {
+	t := &TOTP{
+		issuer: params.Issuer,
+		digits: params.Digits,
+		period: params.Period,
+		skew:   params.Skew,
+		now:    time.Now,
+	}
+
+	if t.digits <= 0 {
+		t.digits = 6
+	}
+	if t.period <= 0 {
+		t.period = 30 * time.Second
+	}
+
+	return t
+}
+
+// GenerateTOTPSecret returns a random 160-bit secret in unpadded base32, the
+// format expected by authenticator apps.
+func GenerateTOTPSecret() (string, error) {
+	buffer := make([]byte, totpSecretSize)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buffer), nil
+}
+
+// URI returns the otpauth:// URI to show as a QR code during enrollment.
+func (t *TOTP) URI(secret string, account string) string {
+	label := account
+	if t.issuer != "" {
+		label = t.issuer + ":" + account
+	}
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	if t.issuer != "" {
+		query.Set("issuer", t.issuer)
+	}
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(t.digits))
+	query.Set("period", strconv.Itoa(int(t.period.Seconds())))
+
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + label,
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+// Code returns the code of secret for the period containing at.
+func (t *TOTP) Code(secret string, at time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return t.hotp(key, t.step(at)), nil
+}
+
+// Verify checks code against the periods around now and returns the time
+// step it matched. Passing the step returned by the last successful call as
+// lastStep rejects codes of that step or earlier with ErrTOTPCodeReused, so a
+// code cannot be used twice.
+func (t *TOTP) Verify(secret string, code string, lastStep int64) (int64, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(code) != t.digits {
+		return 0, ErrInvalidTOTPCode
+	}
+
+	current := t.step(t.now())
+
+	for offset := -t.skew; offset <= t.skew; offset++ {
+		step := current + int64(offset)
+		if step < 0 {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(t.hotp(key, step)), []byte(code)) == 1 {
+			if step <= lastStep {
+				return 0, ErrTOTPCodeReused
+			}
+			return step, nil
+		}
+	}
+
+	return 0, ErrInvalidTOTPCode
+}
+
+func (t *TOTP) step(at time.Time) int64 {
+	return at.Unix() / int64(t.period.Seconds())
+}
+
+// hotp is the RFC 4226 HMAC-based one-time password of counter.
+func (t *TOTP) hotp(key []byte, counter int64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for range t.digits {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", t.digits, value%modulo)
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	normalized = strings.TrimRight(normalized, "=")
+
+	key, err := totpEncoding.DecodeString(normalized)
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidTOTPSecret
+	}
+	return key, nil
+}
+
+// GenerateRecoveryCodes returns n single-use codes formatted as
+// "xxxxx-xxxxx", each with 50 bits of entropy.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+
+	for i := range codes {
+		buffer := make([]byte, 7)
+		if _, err := rand.Read(buffer); err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(totpEncoding.EncodeToString(buffer))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode returns the SHA-256 hash under which a recovery code is
+// stored. Case, spaces and dashes are ignored.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
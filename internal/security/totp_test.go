@@ -0,0 +1,127 @@
+package security
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors,
+// "12345678901234567890", in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+type TestTOTPCodeParams struct {
+	Name       string
+	Unix       int64
+	ExpectCode string
+}
+
+func TestTOTP_Code(t *testing.T) {
+	totp := NewTOTP(TOTPParams{Digits: 8})
+
+	cases := []TestTOTPCodeParams{
+		{Name: "59", Unix: 59, ExpectCode: "94287082"},
+		{Name: "1111111109", Unix: 1111111109, ExpectCode: "07081804"},
+		{Name: "1111111111", Unix: 1111111111, ExpectCode: "14050471"},
+		{Name: "1234567890", Unix: 1234567890, ExpectCode: "89005924"},
+		{Name: "2000000000", Unix: 2000000000, ExpectCode: "69279037"},
+		{Name: "20000000000", Unix: 20000000000, ExpectCode: "65353130"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			code, err := totp.Code(rfc6238Secret, time.Unix(tt.Unix, 0))
+			require.NoError(t, err)
+			require.Equal(t, tt.ExpectCode, code)
+		})
+	}
+}
+
+type TestTOTPVerifyParams struct {
+	Name        string
+	Skew        int
+	CodeAt      time.Duration
+	LastStep    int64
+	ExpectError error
+}
+
+func TestTOTP_Verify(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / 30
+
+	cases := []TestTOTPVerifyParams{
+		{Name: "current period", CodeAt: 0},
+		{Name: "previous period within skew", Skew: 1, CodeAt: -30 * time.Second},
+		{Name: "next period within skew", Skew: 1, CodeAt: 30 * time.Second},
+		{Name: "previous period without skew", CodeAt: -30 * time.Second, ExpectError: ErrInvalidTOTPCode},
+		{Name: "outside skew", Skew: 1, CodeAt: -90 * time.Second, ExpectError: ErrInvalidTOTPCode},
+		{Name: "replayed step", CodeAt: 0, LastStep: current, ExpectError: ErrTOTPCodeReused},
+		{Name: "step older than last used", Skew: 1, CodeAt: -30 * time.Second, LastStep: current, ExpectError: ErrTOTPCodeReused},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			totp := NewTOTP(TOTPParams{Skew: tt.Skew})
+			totp.now = func() time.Time { return now }
+
+			code, err := totp.Code(rfc6238Secret, now.Add(tt.CodeAt))
+			require.NoError(t, err)
+
+			step, err := totp.Verify(rfc6238Secret, code, tt.LastStep)
+			if tt.ExpectError != nil {
+				require.ErrorIs(t, err, tt.ExpectError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, now.Add(tt.CodeAt).Unix()/30, step)
+		})
+	}
+}
+
+func TestTOTP_VerifyRejectsMalformedInput(t *testing.T) {
+	totp := NewTOTP(TOTPParams{})
+
+	_, err := totp.Verify(rfc6238Secret, "12345", 0)
+	require.ErrorIs(t, err, ErrInvalidTOTPCode)
+
+	_, err = totp.Verify("not base32!", "123456", 0)
+	require.ErrorIs(t, err, ErrInvalidTOTPSecret)
+}
+
+func TestTOTP_URI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	require.Len(t, secret, 32)
+
+	totp := NewTOTP(TOTPParams{Issuer: "b16"})
+
+	uri, err := url.Parse(totp.URI(secret, "user@email.com"))
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", uri.Scheme)
+	require.Equal(t, "totp", uri.Host)
+	require.Equal(t, "/b16:user@email.com", uri.Path)
+
+	query := uri.Query()
+	require.Equal(t, secret, query.Get("secret"))
+	require.Equal(t, "b16", query.Get("issuer"))
+	require.Equal(t, "SHA1", query.Get("algorithm"))
+	require.Equal(t, "6", query.Get("digits"))
+	require.Equal(t, "30", query.Get("period"))
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+
+	for _, code := range codes {
+		require.Regexp(t, regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`), code)
+	}
+	require.NotEqual(t, codes[0], codes[1])
+
+	require.Equal(t, HashRecoveryCode(codes[0]), HashRecoveryCode(" "+codes[0][:5]+codes[0][6:]+" "))
+	require.NotEqual(t, HashRecoveryCode(codes[0]), HashRecoveryCode(codes[1]))
+}
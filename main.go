@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/v2code/b16/internal/account"
 	"github.com/v2code/b16/internal/auth"
+	"github.com/v2code/b16/internal/auth/handler"
 	"github.com/v2code/b16/internal/auth/manager"
 	"github.com/v2code/b16/internal/auth/middleware"
 	"github.com/v2code/b16/internal/auth/policy"
 	"github.com/v2code/b16/internal/config"
+	"github.com/v2code/b16/internal/database"
 	"github.com/v2code/b16/internal/logger"
 	"github.com/v2code/b16/internal/mailer"
+	"github.com/v2code/b16/internal/repository"
 	"github.com/v2code/b16/internal/security"
+	"golang.org/x/crypto/bcrypt"
+	_ "modernc.org/sqlite"
 )
 
 func BasicAuthHandler(w http.ResponseWriter, r *http.Request, principal auth.Principal[*manager.BasicAuthPrincipal]) {
@@ -23,21 +31,167 @@ func TokenAuthHandler(w http.ResponseWriter, r *http.Request, principal auth.Pri
 	fmt.Fprintf(w, "Hello %v\n", principal.Principal().Email)
 }
 
+// OpenDatabase opens the SQLite database at dsn and applies the pending
+// migrations.
+func OpenDatabase(dsn string) database.Database {
+	sqlDB, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		panic(err)
+	}
+
+	// SQLite allows one writer at a time; a single connection queues the
+	// writes instead of failing them with SQLITE_BUSY.
+	sqlDB.SetMaxOpenConns(1)
+
+	db := database.NewDatabase(sqlDB)
+
+	migrator, err := database.NewMigrator(db, database.SQLiteDialect, database.Migrations)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := migrator.Up(context.Background()); err != nil {
+		panic(err)
+	}
+
+	return db
+}
+
+// RegisterAccountHandlers mounts the login, refresh, email verification,
+// password reset and two-factor endpoints on mux and starts the relay that
+// sends the emails they store in the outbox.
+func RegisterAccountHandlers(mux *http.ServeMux, env *config.Account, db database.Database, tokenAuthManager *manager.TokenAuthManager) {
+	users := repository.NewSQLUserRepository(db)
+	passwordHasher := security.NewBCryptPasswordHasher(bcrypt.DefaultCost)
+
+	templates, err := mailer.DefaultTemplates()
+	if err != nil {
+		panic(err)
+	}
+
+	smtpMailer := mailer.NewDefaultMailer(mailer.MailerParams{
+		Host:     env.SMTPHost,
+		Port:     env.SMTPPort,
+		From:     env.SMTPFrom,
+		Username: env.SMTPUsername,
+		Password: env.SMTPPassword,
+	}, mailer.NewDefaultClient())
+
+	catalogue := mailer.NewCatalogue(templates, smtpMailer)
+	outbox := mailer.NewOutbox(db)
+
+	relay := mailer.NewOutboxRelay(mailer.OutboxRelayParams{
+		DB:      db,
+		Dialect: database.SQLiteDialect,
+		Mailer:  smtpMailer,
+	})
+	go relay.Run(context.Background())
+
+	twoFactor, err := account.NewTwoFactor(account.TwoFactorParams{
+		DB:   db,
+		TOTP: security.NewTOTP(security.TOTPParams{Issuer: "b16", Skew: 1}),
+		Key:  env.MFAKey,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	tokenHandler, err := handler.NewTokenHandler(handler.TokenHandlerParams{
+		Users:          users,
+		PasswordHasher: passwordHasher,
+		TokenManager:   tokenAuthManager,
+		TwoFactor:      twoFactor,
+	})
+	if err != nil {
+		panic(err)
+	}
+	tokenHandler.Register(mux)
+
+	handler.NewMFAHandler(handler.MFAHandlerParams{
+		TwoFactor:    twoFactor,
+		TokenManager: tokenAuthManager,
+	}).Register(mux)
+
+	handler.NewVerificationHandler(handler.VerificationHandlerParams{
+		Verifier: account.NewEmailVerifier(account.EmailVerifierParams{
+			DB:        db,
+			Users:     users,
+			Catalogue: catalogue,
+			Outbox:    outbox,
+			Secret:    env.VerificationSecret,
+		}),
+	}).Register(mux)
+
+	handler.NewPasswordResetHandler(handler.PasswordResetHandlerParams{
+		Resetter: account.NewPasswordResetter(account.PasswordResetterParams{
+			DB:             db,
+			Users:          users,
+			PasswordHasher: passwordHasher,
+			Catalogue:      catalogue,
+			Outbox:         outbox,
+			Sessions:       tokenAuthManager,
+			ResetURL:       env.PasswordResetURL,
+		}),
+	}).Register(mux)
+}
+
 func main() {
 
 	env := config.LoadEnvironment()
 
-	jwtIssuer := security.NewJwtIssuer(security.JwtIssuerParams{
+	jwtIssuerParams := security.JwtIssuerParams{
 		SecretKey: env.TokenAuthEnv.Secret,
+		PublicKey: env.TokenAuthEnv.PublicKey,
 		ExpireAt:  time.Hour * 2,
 		Issuer:    "b16",
-	})
+	}
+
+	mux := http.NewServeMux()
+
+	if env.TokenAuthEnv.PrivateKey != nil {
+		signingKey, err := security.NewSigningKey(env.TokenAuthEnv.PrivateKey)
+		if err != nil {
+			panic(err)
+		}
+
+		keySet, err := security.NewKeySet(signingKey)
+		if err != nil {
+			panic(err)
+		}
+
+		jwtIssuerParams.KeySet = keySet
+
+		mux.Handle("GET /.well-known/jwks.json", security.NewJWKSHandler(keySet))
+	}
+
+	jwtIssuer := security.NewJwtIssuer(jwtIssuerParams)
 
 	basicAuthManager := manager.NewBasicAuthManager(env.BasicAuthEnv.Users)
 
-	tokenAuthManager := manager.NewTokenAuthManager(jwtIssuer)
+	var db database.Database
+	tokenAuthManagerOptions := []manager.TokenAuthManagerOption{}
 
-	mux := http.NewServeMux()
+	if env.AccountEnv != nil {
+		db = OpenDatabase(env.AccountEnv.DatabaseDSN)
+
+		mfaPendingIssuerParams := jwtIssuerParams
+		mfaPendingIssuerParams.ExpireAt = 5 * time.Minute
+
+		tokenAuthManagerOptions = append(tokenAuthManagerOptions,
+			manager.WithRefreshTokenIssuer(security.NewRefreshTokenIssuer(
+				security.RefreshTokenIssuerParams{ExpireAt: 30 * 24 * time.Hour},
+				security.NewSQLRefreshTokenStore(db),
+			)),
+			manager.WithRevocationStore(security.NewSQLRevocationStore(db, jwtIssuerParams.ExpireAt)),
+			manager.WithMFAPendingIssuer(mfaPendingIssuerParams),
+		)
+	}
+
+	tokenAuthManager := manager.NewTokenAuthManager(jwtIssuer, tokenAuthManagerOptions...)
+
+	if env.AccountEnv != nil {
+		RegisterAccountHandlers(mux, env.AccountEnv, db, tokenAuthManager)
+	}
 
 	mux.HandleFunc(
 		"GET /basic-auth",
@@ -65,22 +219,5 @@ func main() {
 
 	logger.Debug("server is running", "url", "http://0.0.0.0:8000")
 
-	c := mailer.NewDefaultClient()
-
-	m := mailer.NewDefaultMailer(mailer.MailerParams{
-		Host:     "localhost",
-		Port:     1025,
-		From:     "b16@email.com",
-		Username: "",
-		Password: "",
-	}, c)
-
-	body := mailer.RenderVerificationCodeTemplate("123456")
-
-	err := m.Send("Verification Code", body, "recipient@example.com")
-	if err != nil {
-		logger.Error("failed to send email", "error", err)
-	}
-
 	http.ListenAndServe(":8000", mux)
 }